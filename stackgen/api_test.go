@@ -25,7 +25,8 @@ func TestMeetingSchedulerIntegration(t *testing.T) {
 	router.HandleFunc("/events/{id}/availability/{user_id}", handleUserAvailability).Methods("POST", "PUT")
 	router.HandleFunc("/events/{id}/recommendations", getRecommendations).Methods("GET")
 
-	// Test 1: Create an event
+	// Test 1: Create an event, keeping the organizer key it returns
+	var organizerKey string
 	t.Run("Create Event", func(t *testing.T) {
 		eventData := map[string]interface{}{
 			"title":         "Team Meeting",
@@ -46,6 +47,11 @@ func TestMeetingSchedulerIntegration(t *testing.T) {
 		var response Response
 		json.Unmarshal(resp.Body.Bytes(), &response)
 		assert.True(t, response.Success)
+
+		created, _ := json.Marshal(response.Data)
+		var event CreatedEvent
+		json.Unmarshal(created, &event)
+		organizerKey = event.OrganizerKey
 	})
 
 	// Test 2: Add user availability for 3 users in different timezones
@@ -96,6 +102,7 @@ func TestMeetingSchedulerIntegration(t *testing.T) {
 		// Add availability for each user
 		for _, user := range users {
 			req := createJSONRequest("POST", "/events/test-event-123/availability/"+user.id, user.slots)
+			req.Header.Set("X-Organizer-Key", organizerKey)
 			resp := httptest.NewRecorder()
 			router.ServeHTTP(resp, req)
 
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultBatchTimeBudget is how long the batch search may run when the request does not say
+const defaultBatchTimeBudget = 2 * time.Second
+
+// maxBatchTimeBudget caps the time budget a request can ask for
+const maxBatchTimeBudget = 10 * time.Second
+
+type BatchScheduleRequest struct {
+	EventIDs     []string           `json:"event_ids"`
+	Weights      map[string]float64 `json:"weights,omitempty"` // Per event ID, defaults to 1
+	TimeBudgetMs int                `json:"time_budget_ms,omitempty"`
+}
+
+type BatchAssignment struct {
+	EventID        string              `json:"event_id"`
+	Recommendation *SlotRecommendation `json:"recommendation"` // nil when no conflict-free slot was found
+}
+
+type BatchScheduleResult struct {
+	Assignments []BatchAssignment `json:"assignments"`
+	TotalScore  float64           `json:"total_score"`
+	Complete    bool              `json:"complete"` // false when the time budget cut the search short
+}
+
+// validateBatchWeights checks that every weight is a finite number of at
+// least zero; the search's pruning relies on no candidate lowering the total
+func validateBatchWeights(weights map[string]float64) error {
+	for id, weight := range weights {
+		if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+			return fmt.Errorf("invalid weight for %s: must be a finite number of at least 0", id)
+		}
+	}
+	return nil
+}
+
+// batchCandidate is one possible slot for one event in the batch
+type batchCandidate struct {
+	recommendation SlotRecommendation
+	users          map[string]bool
+	score          float64
+	// Span the attendees must keep free, including the event's buffers
+	busyStart time.Time
+	busyEnd   time.Time
+}
+
+// batchEvent holds the candidates of one event, best score first
+type batchEvent struct {
+	index      int
+	candidates []batchCandidate
+}
+
+// scheduleBatch picks one slot per event so that no user is booked into two
+// overlapping events, maximising total weighted attendance. Finding the
+// candidates and the search both stop at the time budget, returning the best
+// assignment found so far; once the context is done it stops with its error.
+func scheduleBatch(ctx context.Context, events []Event, weights map[string]float64, budget time.Duration) (BatchScheduleResult, error) {
+	deadline := time.Now().Add(budget)
+	budgetCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	// Events left without candidates when the budget runs out stay unscheduled
+	complete := true
+	batch := make([]batchEvent, len(events))
+	for i, event := range events {
+		batch[i] = batchEvent{index: i}
+		if !complete {
+			continue
+		}
+		weight := 1.0
+		if w, ok := weights[event.ID]; ok {
+			weight = w
+		}
+		candidates, err := batchCandidates(budgetCtx, event, weight)
+		if err != nil && (ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded)) {
+			return BatchScheduleResult{}, err
+		}
+		if err != nil {
+			complete = false
+			continue
+		}
+		batch[i].candidates = candidates
+	}
+
+	// Events with few options are the most constrained, decide them first
+	sort.SliceStable(batch, func(i, j int) bool {
+		return len(batch[i].candidates) < len(batch[j].candidates)
+	})
+
+	// Upper bound on what the remaining events can still add
+	remainingBest := make([]float64, len(batch)+1)
+	for i := len(batch) - 1; i >= 0; i-- {
+		remainingBest[i] = remainingBest[i+1]
+		if len(batch[i].candidates) > 0 {
+			remainingBest[i] += max(0, batch[i].candidates[0].score)
+		}
+	}
+
+	chosen := make([]*batchCandidate, len(batch))
+	bestChoice := make([]*batchCandidate, len(batch))
+	bestScore := -1.0
+
+	var search func(depth int, score float64)
+	search = func(depth int, score float64) {
+		if !complete {
+			return
+		}
+		if time.Now().After(deadline) {
+			complete = false
+			return
+		}
+		if score+remainingBest[depth] <= bestScore {
+			return
+		}
+		if depth == len(batch) {
+			bestScore = score
+			copy(bestChoice, chosen)
+			return
+		}
+
+		for i := range batch[depth].candidates {
+			candidate := &batch[depth].candidates[i]
+			if conflictsWithChosen(candidate, chosen[:depth]) {
+				continue
+			}
+			chosen[depth] = candidate
+			search(depth+1, score+candidate.score)
+		}
+
+		// Leaving the event unscheduled keeps a result possible when every slot conflicts
+		chosen[depth] = nil
+		search(depth+1, score)
+	}
+	search(0, 0)
+
+	result := BatchScheduleResult{
+		Assignments: make([]BatchAssignment, len(events)),
+		TotalScore:  max(0, bestScore),
+		Complete:    complete,
+	}
+	for i, event := range events {
+		result.Assignments[i] = BatchAssignment{EventID: event.ID}
+	}
+	for i, candidate := range bestChoice {
+		if candidate != nil {
+			rec := candidate.recommendation
+			result.Assignments[batch[i].index].Recommendation = &rec
+		}
+	}
+
+	return result, nil
+}
+
+// batchCandidates lists the candidate slots of an event's best
+// recommendations, best score first
+func batchCandidates(ctx context.Context, event Event, weight float64) ([]batchCandidate, error) {
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+	bufferBefore := time.Duration(event.BufferBefore) * time.Minute
+	bufferAfter := time.Duration(event.BufferAfter) * time.Minute
+
+	recommendations, err := findOptimalSlots(ctx, event, 0)
+	if err != nil {
+		return nil, err
+	}
+	slots := candidateSlots(recommendations, meetingDuration)
+
+	candidates := make([]batchCandidate, 0, len(slots))
+	for _, rec := range slots {
+		users := make(map[string]bool, len(rec.AvailableUsers))
+		for _, user := range rec.AvailableUsers {
+			users[user] = true
+		}
+		candidates = append(candidates, batchCandidate{
+			recommendation: rec,
+			users:          users,
+			score:          weight * float64(len(rec.AvailableUsers)),
+			busyStart:      rec.Slot.Start_UTC.Add(-bufferBefore),
+			busyEnd:        rec.Slot.End_UTC.Add(bufferAfter),
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	return candidates, nil
+}
+
+// conflictsWithChosen reports whether a candidate would double-book a user
+// already attending one of the chosen slots
+func conflictsWithChosen(candidate *batchCandidate, chosen []*batchCandidate) bool {
+	for _, other := range chosen {
+		if other == nil {
+			continue
+		}
+		// A meeting may not fall into another meeting's span or buffers
+		overlaps := candidate.recommendation.Slot.Start_UTC.Before(other.busyEnd) && other.busyStart.Before(candidate.recommendation.Slot.End_UTC) ||
+			other.recommendation.Slot.Start_UTC.Before(candidate.busyEnd) && candidate.busyStart.Before(other.recommendation.Slot.End_UTC)
+		if !overlaps {
+			continue
+		}
+		for user := range candidate.users {
+			if other.users[user] {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleBatch(t *testing.T) {
+	planning := Event{
+		ID:           "planning",
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 12:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 10:00", "2025-01-15 11:00")),
+		},
+	}
+	retro := Event{
+		ID:           "retro",
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 12:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 10:00", "2025-01-15 12:00")),
+			userAvailability("carol", utcSlot("2025-01-15 10:00", "2025-01-15 12:00")),
+		},
+	}
+
+	result := batchSchedule(t, []Event{planning, retro}, nil, time.Second)
+
+	assert.True(t, result.Complete)
+	assert.Equal(t, 4.0, result.TotalScore)
+	assert.Equal(t, "planning", result.Assignments[0].EventID)
+
+	// Both want alice at 10:00, so the two meetings must not overlap
+	first := result.Assignments[0].Recommendation.Slot
+	second := result.Assignments[1].Recommendation.Slot
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 11:00"), first)
+	assert.Equal(t, utcSlot("2025-01-15 11:00", "2025-01-15 12:00"), second)
+}
+
+func TestScheduleBatchWeights(t *testing.T) {
+	event := func(id string) Event {
+		return Event{
+			ID:           id,
+			DurationMins: 60,
+			Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 10:00")},
+			UserSlots: []UserAvailability{
+				userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 10:00")),
+			},
+		}
+	}
+
+	result := batchSchedule(t, []Event{event("minor"), event("major")}, map[string]float64{"major": 3}, time.Second)
+
+	// Only one of them can have alice, the heavier one wins
+	assert.Nil(t, result.Assignments[0].Recommendation)
+	assert.NotNil(t, result.Assignments[1].Recommendation)
+	assert.Equal(t, 3.0, result.TotalScore)
+}
+
+func TestScheduleBatchBudget(t *testing.T) {
+	// Finding candidates counts against the budget, and what it cuts short is left unscheduled
+	busy := staircaseEvent(1000)
+	busy.ID = "busy"
+	result := batchSchedule(t, []Event{busy}, nil, time.Millisecond)
+	assert.False(t, result.Complete)
+	assert.Nil(t, result.Assignments[0].Recommendation)
+
+	// A request that is gone is an error rather than a partial schedule
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := scheduleBatch(ctx, []Event{busy}, nil, time.Second)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestValidateBatchWeights(t *testing.T) {
+	assert.NoError(t, validateBatchWeights(nil))
+	assert.NoError(t, validateBatchWeights(map[string]float64{"planning": 0, "retro": 2.5}))
+	for _, weight := range []float64{-1, math.NaN(), math.Inf(1)} {
+		assert.Error(t, validateBatchWeights(map[string]float64{"planning": weight}), weight)
+	}
+}
+
+// batchSchedule runs scheduleBatch without a deadline
+func batchSchedule(t *testing.T, events []Event, weights map[string]float64, budget time.Duration) BatchScheduleResult {
+	t.Helper()
+	result, err := scheduleBatch(context.Background(), events, weights, budget)
+	assert.NoError(t, err)
+	return result
+}
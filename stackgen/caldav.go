@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// calDAVConnector runs a CalDAV free-busy-query REPORT (RFC 4791 section 7.10)
+// against the account's calendar collection
+type calDAVConnector struct {
+	client *http.Client
+}
+
+func newCalDAVConnector() *calDAVConnector {
+	return &calDAVConnector{client: publicHTTPClient(10 * time.Second)}
+}
+
+const freeBusyQuery = `<?xml version="1.0" encoding="utf-8" ?>
+<C:free-busy-query xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <C:time-range start="%s" end="%s"/>
+</C:free-busy-query>
+`
+
+func (c *calDAVConnector) FreeBusy(ctx context.Context, account CalendarAccount, from, to time.Time) ([]TimeSlot, error) {
+	body := fmt.Sprintf(freeBusyQuery, formatICSTime(from), formatICSTime(to))
+	req, err := http.NewRequestWithContext(ctx, "REPORT", account.URL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	req.Header.Set("Depth", "1")
+	req.SetBasicAuth(account.Username, account.Password)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("caldav server answered %s", resp.Status)
+	}
+
+	root, err := parseICS(io.LimitReader(resp.Body, maxICSUpload))
+	if err != nil {
+		return nil, fmt.Errorf("caldav response: %v", err)
+	}
+	if len(root.find("VFREEBUSY")) == 0 {
+		return nil, fmt.Errorf("caldav response has no VFREEBUSY")
+	}
+
+	busy, err := icsBusyRuns(root, time.UTC, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("caldav response: %v", err)
+	}
+	slots := make([]TimeSlot, 0, len(busy))
+	for _, run := range busy {
+		slots = append(slots, TimeSlot{Start_UTC: nanosToTime(run.start), End_UTC: nanosToTime(run.end)})
+	}
+	return slots, nil
+}
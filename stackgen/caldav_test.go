@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// calDAVStandIn answers free-busy-query REPORTs for one calendar, like a
+// CalDAV server would, from a fixed list of busy periods
+func calDAVStandIn(username, password string, busy []TimeSlot) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != username || pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != "REPORT" || r.URL.Path != "/calendars/alice/work/" || r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var query struct {
+			XMLName   xml.Name `xml:"urn:ietf:params:xml:ns:caldav free-busy-query"`
+			TimeRange struct {
+				Start string `xml:"start,attr"`
+				End   string `xml:"end,attr"`
+			} `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&query); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		from, err1 := time.Parse("20060102T150405Z", query.TimeRange.Start)
+		to, err2 := time.Parse("20060102T150405Z", query.TimeRange.End)
+		if err1 != nil || err2 != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/calendar")
+		fmt.Fprint(w, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VFREEBUSY\r\n")
+		fmt.Fprintf(w, "DTSTART:%s\r\nDTEND:%s\r\n", formatICSTime(from), formatICSTime(to))
+		for _, slot := range busy {
+			if slot.Start_UTC.Before(to) && slot.End_UTC.After(from) {
+				fmt.Fprintf(w, "FREEBUSY:%s/%s\r\n", formatICSTime(slot.Start_UTC), formatICSTime(slot.End_UTC))
+			}
+		}
+		fmt.Fprint(w, "END:VFREEBUSY\r\nEND:VCALENDAR\r\n")
+	}))
+}
+
+func TestCalDAVSync(t *testing.T) {
+	server := calDAVStandIn("alice", "s3cret", []TimeSlot{
+		utcSlot("2025-01-15 10:00", "2025-01-15 11:00"),
+		utcSlot("2025-01-16 13:00", "2025-01-16 18:00"),
+		utcSlot("2025-02-01 09:00", "2025-02-01 10:00"), // Outside the event
+	})
+	defer server.Close()
+
+	// The stand-in listens on loopback, which the real connector refuses to dial
+	RegisterConnector("caldav", &calDAVConnector{client: server.Client()})
+	defer RegisterConnector("caldav", newCalDAVConnector())
+
+	event := Event{Slots: []TimeSlot{
+		utcSlot("2025-01-15 09:00", "2025-01-15 17:00"),
+		utcSlot("2025-01-16 09:00", "2025-01-16 17:00"),
+	}}
+	account := CalendarAccount{UserID: "alice", Provider: "caldav", URL: server.URL + "/calendars/alice/work/", Username: "alice", Password: "s3cret"}
+
+	availability, err := syncAvailability(context.Background(), event, account, time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", availability.UserID)
+	slots := []TimeSlot{}
+	for _, slot := range availability.Slots {
+		slots = append(slots, TimeSlot{Start_UTC: slot.Start_UTC, End_UTC: slot.End_UTC})
+	}
+	assert.Equal(t, []TimeSlot{
+		utcSlot("2025-01-15 09:00", "2025-01-15 10:00"),
+		utcSlot("2025-01-15 11:00", "2025-01-15 17:00"),
+		utcSlot("2025-01-16 09:00", "2025-01-16 13:00"),
+	}, slots)
+
+	// Wrong credentials surface as an error instead of an empty calendar
+	account.Password = "wrong"
+	_, err = syncAvailability(context.Background(), event, account, time.UTC)
+	assert.ErrorContains(t, err, "401")
+
+	account.Provider = "exchange"
+	_, err = syncAvailability(context.Background(), event, account, time.UTC)
+	assert.Error(t, err)
+}
+
+type fakeConnector struct {
+	busy []TimeSlot
+}
+
+func (f fakeConnector) FreeBusy(ctx context.Context, account CalendarAccount, from, to time.Time) ([]TimeSlot, error) {
+	return f.busy, nil
+}
+
+func TestRegisterConnector(t *testing.T) {
+	RegisterConnector("fake", fakeConnector{busy: []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 12:00")}})
+	defer func() {
+		connectorsMu.Lock()
+		delete(connectors, "fake")
+		connectorsMu.Unlock()
+	}()
+
+	event := Event{Slots: []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")}}
+	availability, err := syncAvailability(context.Background(), event, CalendarAccount{UserID: "bob", Provider: "fake"}, time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, availability.Slots, 1)
+	assert.Equal(t, utcSlot("2025-01-15 12:00", "2025-01-15 17:00").Start_UTC, availability.Slots[0].Start_UTC)
+}
+
+func TestCredentialSealing(t *testing.T) {
+	defer setCredentialsKey("")
+
+	// Without a key passwords are not stored at all
+	setCredentialsKey("")
+	_, err := sealCredential("s3cret")
+	assert.Equal(t, errNoCredentialsKey, err)
+
+	// Those stored before sealing was required still open
+	opened, err := openCredential("s3cret")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", opened)
+
+	setCredentialsKey("correct horse battery staple")
+	stored, err := sealCredential("s3cret")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stored, credentialPrefix))
+	assert.NotContains(t, stored, "s3cret")
+	opened, err = openCredential(stored)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", opened)
+
+	setCredentialsKey("another key")
+	_, err = openCredential(stored)
+	assert.Error(t, err)
+	setCredentialsKey("")
+	_, err = openCredential(stored)
+	assert.Error(t, err)
+}
+
+func TestValidateCalendarAccount(t *testing.T) {
+	valid := CalendarAccount{Provider: "caldav", URL: "https://dav.example.com/cal/", Username: "alice", Password: "x"}
+	assert.NoError(t, validateCalendarAccount(valid))
+
+	invalid := valid
+	invalid.URL = "ftp://dav.example.com"
+	assert.Error(t, validateCalendarAccount(invalid))
+	invalid = valid
+	invalid.Provider = "exchange"
+	assert.Error(t, validateCalendarAccount(invalid))
+	invalid = valid
+	invalid.Password = ""
+	assert.Error(t, validateCalendarAccount(invalid))
+
+	// Calendars cannot point back inside the network
+	for _, internal := range []string{"http://localhost:8080/cal/", "http://127.0.0.1/cal/", "http://[::1]/cal/", "http://10.0.0.5/cal/", "http://169.254.169.254/latest/"} {
+		invalid = valid
+		invalid.URL = internal
+		assert.ErrorContains(t, validateCalendarAccount(invalid), "not a public host", internal)
+	}
+}
+
+func TestCalendarAccountOwner(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer func(events, accounts *mongo.Collection) {
+		eventsCollection, calendarAccountsCollection = events, accounts
+	}(eventsCollection, calendarAccountsCollection)
+
+	now := time.Now()
+	event := Event{ID: "review"}
+	alice, _ := issueInvite(&event, "alice", 0, now)
+	bob, _ := issueInvite(&event, "bob", 0, now)
+	// Anyone can make an event and invite alice to it
+	other := Event{ID: "mallory-event"}
+	forged, _ := issueInvite(&other, "alice", 0, now)
+
+	raw, _ := bson.Marshal(event)
+	var stored bson.D
+	bson.Unmarshal(raw, &stored)
+	account := bson.D{{Key: "_id", Value: calendarAccountID("review", "alice")}, {Key: "event_id", Value: "review"}, {Key: "user_id", Value: "alice"}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}/availability/{user_id}/calendar", getCalendarAccount).Methods("GET")
+	router.HandleFunc("/events/{id}/availability/{user_id}/calendar", deleteCalendarAccount).Methods("DELETE")
+
+	for _, given := range []struct {
+		name   string
+		method string
+		token  string
+		status int
+	}{
+		{"Owner", "GET", alice.Token, http.StatusOK},
+		{"No Token", "GET", "", http.StatusUnauthorized},
+		{"Another User", "GET", bob.Token, http.StatusForbidden},
+		{"Another Event", "GET", forged.Token, http.StatusForbidden},
+		{"Another Event Delete", "DELETE", forged.Token, http.StatusForbidden},
+	} {
+		mt.Run(given.name, func(mt *mtest.T) {
+			eventsCollection, calendarAccountsCollection = mt.Coll, mt.Coll
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, stored),
+				mtest.CreateCursorResponse(0, "db.calendar_accounts", mtest.FirstBatch, account),
+			)
+
+			r := httptest.NewRequest(given.method, "/events/review/availability/alice/calendar", nil)
+			if given.token != "" {
+				r.Header.Set("Authorization", "Bearer "+given.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Equal(mt, given.status, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// calendarEntry is one VEVENT of an exported calendar
+type calendarEntry struct {
+	UID              string
+	Sequence         int // Revision of the UID; clients ignore re-exports that don't raise it
+	Slot             TimeSlot
+	Status           string // CONFIRMED or TENTATIVE
+	Description      string
+	Location         string
+	AvailableUsers   []string
+	UnavailableUsers []string
+}
+
+// eventUID is the UID of an event's meeting. It stays the same whichever slot
+// is exported, so re-importing moves the meeting instead of duplicating it.
+func eventUID(eventID string) string {
+	return eventID + "@stackgen-scheduler"
+}
+
+// scheduledEntry exports the slot an event has been scheduled for
+func scheduledEntry(event Event) calendarEntry {
+	slot := *event.ScheduledSlot
+
+	// Notice and not_before are about choosing a slot, not about who can make the chosen one
+	event.NotBefore, event.now = nil, time.Time{}
+	index := buildAvailabilityIndex(event)
+	available, unavailable := index.usersFree(slot.Start_UTC.UnixNano(), slot.End_UTC.UnixNano())
+
+	status := "CONFIRMED"
+	if event.Status == StatusCancelled {
+		status = "CANCELLED"
+	}
+
+	return calendarEntry{
+		UID:              eventUID(event.ID),
+		Sequence:         event.Sequence,
+		Slot:             slot,
+		Status:           status,
+		AvailableUsers:   available,
+		UnavailableUsers: unavailable,
+	}
+}
+
+// recommendationEntries exports recommendations as tentative events. A single
+// recommendation stands in for the meeting and takes the event's UID; several
+// are alternatives and each get their own.
+func recommendationEntries(event Event, recommendations []SlotRecommendation) []calendarEntry {
+	entries := make([]calendarEntry, 0, len(recommendations))
+	for i, rec := range recommendations {
+		entry := calendarEntry{
+			UID:              eventUID(event.ID),
+			Sequence:         event.Sequence,
+			Slot:             rec.Slot,
+			Status:           "TENTATIVE",
+			AvailableUsers:   rec.AvailableUsers,
+			UnavailableUsers: rec.UnavailableUsers,
+		}
+		total := len(rec.AvailableUsers) + len(rec.UnavailableUsers)
+		if len(recommendations) > 1 {
+			entry.UID = rec.ID + "." + eventUID(event.ID)
+			entry.Description = fmt.Sprintf("Candidate %d of %d: %d of %d participants available",
+				i+1, len(recommendations), len(rec.AvailableUsers), total)
+		} else {
+			entry.Description = fmt.Sprintf("Recommended slot: %d of %d participants available", len(rec.AvailableUsers), total)
+		}
+		if rec.Resource != nil {
+			entry.Location = rec.Resource.Name
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// writeEventCalendar renders entries as a VCALENDAR. Times are written in UTC,
+// or with loc's TZID and a matching VTIMEZONE when loc is not UTC.
+func writeEventCalendar(event Event, entries []calendarEntry, loc *time.Location, stamp time.Time) string {
+	w := &icsWriter{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//stackgen//meeting-scheduler//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	if event.Title != "" {
+		w.line("X-WR-CALNAME", escapeICSText(event.Title))
+	}
+
+	zoned := loc != nil && loc != time.UTC && loc.String() != "UTC" && len(entries) > 0
+	if zoned {
+		from, to := entries[0].Slot.Start_UTC, entries[0].Slot.End_UTC
+		for _, entry := range entries {
+			if entry.Slot.Start_UTC.Before(from) {
+				from = entry.Slot.Start_UTC
+			}
+			if entry.Slot.End_UTC.After(to) {
+				to = entry.Slot.End_UTC
+			}
+		}
+		writeVTimezone(w, loc, from, to)
+	}
+
+	for _, entry := range entries {
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", entry.UID)
+		w.line("DTSTAMP", formatICSTime(stamp))
+		w.line("SEQUENCE", strconv.Itoa(entry.Sequence))
+		if zoned {
+			tzid := "TZID=" + quoteICSParam(loc.String())
+			w.line("DTSTART", entry.Slot.Start_UTC.In(loc).Format("20060102T150405"), tzid)
+			w.line("DTEND", entry.Slot.End_UTC.In(loc).Format("20060102T150405"), tzid)
+		} else {
+			w.line("DTSTART", formatICSTime(entry.Slot.Start_UTC))
+			w.line("DTEND", formatICSTime(entry.Slot.End_UTC))
+		}
+		w.line("SUMMARY", escapeICSText(event.Title))
+		if entry.Description != "" {
+			w.line("DESCRIPTION", escapeICSText(entry.Description))
+		}
+		if entry.Location != "" {
+			w.line("LOCATION", escapeICSText(entry.Location))
+		}
+		w.line("STATUS", entry.Status)
+
+		// Tentative alternatives should not block anyone's calendar
+		if entry.Status == "TENTATIVE" {
+			w.line("TRANSP", "TRANSPARENT")
+		} else {
+			w.line("TRANSP", "OPAQUE")
+		}
+
+		for _, user := range entry.AvailableUsers {
+			w.line("ATTENDEE", calendarAddress(user), "CN="+quoteICSParam(user), "PARTSTAT=NEEDS-ACTION")
+		}
+		for _, user := range entry.UnavailableUsers {
+			w.line("ATTENDEE", calendarAddress(user), "CN="+quoteICSParam(user), "PARTSTAT=DECLINED")
+		}
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.String()
+}
+
+// calendarAddress turns a user ID into an attendee address: a mailto for
+// e-mail addresses, otherwise a URN that keeps the ID. User IDs are free-form,
+// so control characters are dropped.
+func calendarAddress(userID string) string {
+	userID = stripICSControls(userID)
+	if strings.Contains(userID, "@") {
+		return "mailto:" + userID
+	}
+	return "urn:x-stackgen:user:" + userID
+}
+
+// writeVTimezone describes loc from the start of from's year to the end of
+// to's year: the observance in force on 1 January, then every transition
+func writeVTimezone(w *icsWriter, loc *time.Location, from, to time.Time) {
+	start := time.Date(from.In(loc).Year(), time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(to.In(loc).Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", loc.String())
+
+	name, offset := start.Zone()
+	writeObservance(w, start, offset, offset, name, start.IsDST())
+
+	for day := start; day.Before(end); {
+		next := day.AddDate(0, 0, 1)
+		if _, nextOffset := next.Zone(); nextOffset != offset {
+			// Narrow the change down to the second
+			lo, hi := day.Unix(), next.Unix()
+			for hi-lo > 1 {
+				mid := lo + (hi-lo)/2
+				if _, midOffset := time.Unix(mid, 0).In(loc).Zone(); midOffset == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			transition := time.Unix(hi, 0).In(loc)
+			newName, newOffset := transition.Zone()
+			writeObservance(w, transition, offset, newOffset, newName, transition.IsDST())
+			offset = newOffset
+		}
+		day = next
+	}
+
+	w.line("END", "VTIMEZONE")
+}
+
+// writeObservance writes a STANDARD or DAYLIGHT block. Its DTSTART is the
+// local time of the change under the offset that was in force before it.
+func writeObservance(w *icsWriter, at time.Time, offsetFrom, offsetTo int, name string, daylight bool) {
+	kind := "STANDARD"
+	if daylight {
+		kind = "DAYLIGHT"
+	}
+	w.line("BEGIN", kind)
+	w.line("DTSTART", at.UTC().Add(time.Duration(offsetFrom)*time.Second).Format("20060102T150405"))
+	w.line("TZOFFSETFROM", formatUTCOffset(offsetFrom))
+	w.line("TZOFFSETTO", formatUTCOffset(offsetTo))
+	w.line("TZNAME", name)
+	w.line("END", kind)
+}
+
+// formatUTCOffset writes seconds east of UTC as +HHMM, or +HHMMSS when needed
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	formatted := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		formatted += fmt.Sprintf("%02d", offset%60)
+	}
+	return formatted
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteEventCalendar(t *testing.T) {
+	event := Event{
+		ID:            "standup",
+		Title:         "Standup; weekly, with everyone",
+		ScheduledSlot: &TimeSlot{},
+		Slots:         []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice@example.com", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 13:00", "2025-01-15 17:00")),
+		},
+	}
+	*event.ScheduledSlot = utcSlot("2025-01-15 10:00", "2025-01-15 11:00")
+	stamp := utcSlot("2025-01-10 08:00", "2025-01-10 08:00").Start_UTC
+
+	ics := writeEventCalendar(event, []calendarEntry{scheduledEntry(event)}, nil, stamp)
+	assert.True(t, strings.HasSuffix(ics, "END:VCALENDAR\r\n"))
+	assert.Contains(t, ics, "UID:standup@stackgen-scheduler\r\n")
+	assert.Contains(t, ics, "DTSTAMP:20250110T080000Z\r\n")
+	assert.Contains(t, ics, "DTSTART:20250115T100000Z\r\n")
+	assert.Contains(t, ics, "DTEND:20250115T110000Z\r\n")
+	assert.Contains(t, ics, "STATUS:CONFIRMED\r\n")
+	assert.Contains(t, ics, "SEQUENCE:0\r\n")
+	assert.NotContains(t, ics, "VTIMEZONE")
+
+	// Cancelling re-exports the same UID as a newer revision
+	cancelled := event
+	assert.NoError(t, transitionEvent(&cancelled, StatusCancelled))
+	cancelledICS := writeEventCalendar(cancelled, []calendarEntry{scheduledEntry(cancelled)}, nil, stamp)
+	assert.Contains(t, cancelledICS, "UID:standup@stackgen-scheduler\r\n")
+	assert.Contains(t, cancelledICS, "SEQUENCE:1\r\n")
+	assert.Contains(t, cancelledICS, "STATUS:CANCELLED\r\n")
+
+	// Round trip through the parser
+	root, err := parseICS(strings.NewReader(ics))
+	assert.NoError(t, err)
+	events := root.find("VEVENT")
+	assert.Len(t, events, 1)
+	summary, _ := events[0].property("SUMMARY")
+	assert.Equal(t, event.Title, unescapeICSText(summary.Value))
+
+	attendees := events[0].properties("ATTENDEE")
+	assert.Len(t, attendees, 2)
+	assert.Equal(t, "mailto:alice@example.com", attendees[0].Value)
+	assert.Equal(t, "NEEDS-ACTION", attendees[0].Params["PARTSTAT"])
+	assert.Equal(t, "urn:x-stackgen:user:bob", attendees[1].Value)
+	assert.Equal(t, "DECLINED", attendees[1].Params["PARTSTAT"])
+}
+
+func TestWriteEventCalendarEscapes(t *testing.T) {
+	// User IDs and titles are free-form, and line breaks in them must not
+	// start lines of their own
+	hostile := "mallory\r\nATTENDEE:mailto:boss@example.com\rEND:VEVENT"
+	event := Event{
+		ID:            "standup",
+		Title:         "Standup\rBEGIN:VALARM",
+		ScheduledSlot: &TimeSlot{},
+		Slots:         []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots:     []UserAvailability{userAvailability(hostile, utcSlot("2025-01-15 09:00", "2025-01-15 12:00"))},
+	}
+	*event.ScheduledSlot = utcSlot("2025-01-15 10:00", "2025-01-15 11:00")
+
+	ics := writeEventCalendar(event, []calendarEntry{scheduledEntry(event)}, nil, time.Now())
+	for _, line := range strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n") {
+		assert.NotContains(t, line, "\r")
+		assert.NotContains(t, line, "\n")
+	}
+	assert.Contains(t, ics, "SUMMARY:Standup\\nBEGIN:VALARM\r\n")
+
+	root, err := parseICS(strings.NewReader(ics))
+	assert.NoError(t, err)
+	events := root.find("VEVENT")
+	assert.Len(t, events, 1)
+	attendees := events[0].properties("ATTENDEE")
+	assert.Len(t, attendees, 1)
+	assert.Equal(t, "mailto:malloryATTENDEE:mailto:boss@example.comEND:VEVENT", attendees[0].Value)
+}
+
+func TestWriteEventCalendarTimeZone(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	event := Event{ID: "review", Title: "Review"}
+	entries := []calendarEntry{{UID: eventUID(event.ID), Slot: utcSlot("2025-07-15 09:00", "2025-07-15 10:00"), Status: "CONFIRMED"}}
+
+	ics := writeEventCalendar(event, entries, london, time.Now())
+	assert.Contains(t, ics, "DTSTART;TZID=Europe/London:20250715T100000\r\n")
+	assert.Contains(t, ics, "DTEND;TZID=Europe/London:20250715T110000\r\n")
+
+	root, err := parseICS(strings.NewReader(ics))
+	assert.NoError(t, err)
+	timezones := root.find("VTIMEZONE")
+	assert.Len(t, timezones, 1)
+
+	// January in GMT, then both 2025 changes
+	standard := timezones[0].find("STANDARD")
+	daylight := timezones[0].find("DAYLIGHT")
+	assert.Len(t, standard, 2)
+	assert.Len(t, daylight, 1)
+	start, _ := daylight[0].property("DTSTART")
+	from, _ := daylight[0].property("TZOFFSETFROM")
+	to, _ := daylight[0].property("TZOFFSETTO")
+	assert.Equal(t, "20250330T010000", start.Value)
+	assert.Equal(t, "+0000", from.Value)
+	assert.Equal(t, "+0100", to.Value)
+	start, _ = standard[1].property("DTSTART")
+	assert.Equal(t, "20251026T020000", start.Value)
+
+	// The event's times resolve to the same instants
+	vevent := root.find("VEVENT")[0]
+	dtstart, _ := vevent.property("DTSTART")
+	parsed, _, err := parseICSTime(dtstart, time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, parsed.Equal(entries[0].Slot.Start_UTC))
+}
+
+func TestRecommendationEntries(t *testing.T) {
+	event := Event{ID: "planning"}
+	recs := []SlotRecommendation{
+		{ID: "a1", Slot: utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), AvailableUsers: []string{"alice", "bob"}},
+		{ID: "b2", Slot: utcSlot("2025-01-16 09:00", "2025-01-16 10:00"), AvailableUsers: []string{"alice"}, UnavailableUsers: []string{"bob"},
+			Resource: &AssignedResource{ID: "room-1", Name: "Room 1"}},
+	}
+
+	// The top pick stands in for the meeting itself
+	top := recommendationEntries(event, recs[:1])
+	assert.Equal(t, "planning@stackgen-scheduler", top[0].UID)
+	assert.Equal(t, "TENTATIVE", top[0].Status)
+
+	// Alternatives each need their own UID
+	all := recommendationEntries(event, recs)
+	assert.Equal(t, "a1.planning@stackgen-scheduler", all[0].UID)
+	assert.Equal(t, "b2.planning@stackgen-scheduler", all[1].UID)
+	assert.Equal(t, "Candidate 2 of 2: 1 of 2 participants available", all[1].Description)
+	assert.Equal(t, "Room 1", all[1].Location)
+
+	ics := writeEventCalendar(event, all, nil, time.Now())
+	assert.Equal(t, 2, strings.Count(ics, "TRANSP:TRANSPARENT\r\n"))
+	assert.Contains(t, ics, "LOCATION:Room 1\r\n")
+}
+
+func TestICSLineFolding(t *testing.T) {
+	w := &icsWriter{}
+	value := strings.Repeat("Planning ünïcode ", 12)
+	w.line("SUMMARY", value)
+
+	for _, line := range strings.Split(strings.TrimSuffix(w.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+	root, err := parseICS(strings.NewReader(w.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, value, root.Properties[0].Value)
+}
+
+func TestICSRouteMatchesBeforeEvent(t *testing.T) {
+	var matched string
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}.ics", func(w http.ResponseWriter, r *http.Request) {
+		matched = "ics:" + mux.Vars(r)["id"]
+	}).Methods("GET")
+	router.HandleFunc("/events/{id}", func(w http.ResponseWriter, r *http.Request) {
+		matched = "event:" + mux.Vars(r)["id"]
+	}).Methods("GET")
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events/team.sync.ics", nil))
+	assert.Equal(t, "ics:team.sync", matched)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events/team.sync", nil))
+	assert.Equal(t, "event:team.sync", matched)
+}
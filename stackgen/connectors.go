@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CalendarConnector fetches a user's busy time from an external calendar
+type CalendarConnector interface {
+	// FreeBusy returns the busy periods overlapping [from, to)
+	FreeBusy(ctx context.Context, account CalendarAccount, from, to time.Time) ([]TimeSlot, error)
+}
+
+// CalendarAccount is the access a user has granted to their calendar for
+// syncing their availability to one event
+type CalendarAccount struct {
+	ID       string `json:"-" bson:"_id"` // See calendarAccountID
+	EventID  string `json:"event_id" bson:"event_id"`
+	UserID   string `json:"user_id" bson:"user_id"`
+	Provider string `json:"provider" bson:"provider"` // Registered connector, "caldav" by default
+	URL      string `json:"url" bson:"url"`           // Calendar collection to query
+	Username string `json:"username" bson:"username"`
+	Password string `json:"password,omitempty" bson:"password"` // Sealed at rest, never returned
+}
+
+// credentialPrefix marks passwords sealed with the credentials key
+const credentialPrefix = "sealed:"
+
+var (
+	connectorsMu sync.RWMutex
+	connectors   = map[string]CalendarConnector{
+		"caldav": newCalDAVConnector(),
+	}
+
+	// credentialsKey seals stored passwords; set from CALENDAR_CREDENTIALS_KEY
+	credentialsKey []byte
+)
+
+// errNoCredentialsKey is returned when a password would be stored unsealed
+var errNoCredentialsKey = fmt.Errorf("calendar accounts need CALENDAR_CREDENTIALS_KEY to be set")
+
+// RegisterConnector makes a calendar connector available to accounts under
+// the given provider name, replacing any connector of the same name
+func RegisterConnector(name string, connector CalendarConnector) {
+	connectorsMu.Lock()
+	defer connectorsMu.Unlock()
+	connectors[name] = connector
+}
+
+// connectorFor looks up the connector of an account's provider
+func connectorFor(provider string) (CalendarConnector, error) {
+	connectorsMu.RLock()
+	defer connectorsMu.RUnlock()
+	connector, ok := connectors[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown calendar provider: %s", provider)
+	}
+	return connector, nil
+}
+
+// connectorNames lists the registered providers
+func connectorNames() []string {
+	connectorsMu.RLock()
+	defer connectorsMu.RUnlock()
+	names := make([]string, 0, len(connectors))
+	for name := range connectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// calendarAccountID keys an account by its event and user. Path segments
+// cannot hold a slash, so the pair is unambiguous.
+func calendarAccountID(eventID, userID string) string {
+	return eventID + "/" + userID
+}
+
+// validateCalendarAccount checks an account before it is stored
+func validateCalendarAccount(account CalendarAccount) error {
+	if _, err := connectorFor(account.Provider); err != nil {
+		return fmt.Errorf("%v (available: %s)", err, strings.Join(connectorNames(), ", "))
+	}
+	parsed, err := url.Parse(account.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("calendar url must be an http or https URL")
+	}
+	if err := checkPublicHost(parsed.Hostname()); err != nil {
+		return fmt.Errorf("calendar url: %v", err)
+	}
+	if account.Username == "" || account.Password == "" {
+		return fmt.Errorf("calendar username and password cannot be empty")
+	}
+	return nil
+}
+
+// setCredentialsKey derives the sealing key from a configured secret
+func setCredentialsKey(secret string) {
+	if secret == "" {
+		credentialsKey = nil
+		return
+	}
+	key := sha256.Sum256([]byte(secret))
+	credentialsKey = key[:]
+}
+
+// sealCredential encrypts a password with AES-GCM before it is stored.
+// Without a configured key it refuses, rather than store it in plain text.
+func sealCredential(password string) (string, error) {
+	if credentialsKey == nil {
+		return "", errNoCredentialsKey
+	}
+	gcm, err := credentialsCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(password), nil)
+	return credentialPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openCredential reverses sealCredential. Passwords stored before sealing
+// was required are returned as they are.
+func openCredential(stored string) (string, error) {
+	if !strings.HasPrefix(stored, credentialPrefix) {
+		return stored, nil
+	}
+	if credentialsKey == nil {
+		return "", fmt.Errorf("stored credentials are sealed but no credentials key is configured")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, credentialPrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := credentialsCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("stored credentials are corrupt")
+	}
+	password, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("stored credentials cannot be opened with the configured key")
+	}
+	return string(password), nil
+}
+
+func credentialsCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(credentialsKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// availabilityFromBusy is the event's slots minus the busy periods, shown in loc
+func availabilityFromBusy(event Event, userID string, busy []freeRun, loc *time.Location) UserAvailability {
+	eventWindows := mergeRuns(slotsToRuns(event.Slots))
+
+	availability := UserAvailability{UserID: userID, Slots: []TimeSlot{}}
+	for _, run := range subtractRuns(eventWindows, mergeRuns(busy)) {
+		start, end := nanosToTime(run.start), nanosToTime(run.end)
+		availability.Slots = append(availability.Slots, TimeSlot{
+			Start_UTC: start,
+			End_UTC:   end,
+			StartStr:  start.In(loc).Format("2 Jan 2006, 3:04PM"),
+			EndStr:    end.In(loc).Format("2 Jan 2006, 3:04PM"),
+			TimeZone:  loc.String(),
+		})
+	}
+	return availability
+}
+
+// syncAvailability asks the account's connector for busy time across the
+// event's slots and returns what is left as the user's availability
+func syncAvailability(ctx context.Context, event Event, account CalendarAccount, loc *time.Location) (UserAvailability, error) {
+	connector, err := connectorFor(account.Provider)
+	if err != nil {
+		return UserAvailability{}, err
+	}
+	eventWindows := mergeRuns(slotsToRuns(event.Slots))
+	if len(eventWindows) == 0 {
+		return UserAvailability{}, fmt.Errorf("event has no slots to sync availability into")
+	}
+	from, to := nanosToTime(eventWindows[0].start), nanosToTime(eventWindows[len(eventWindows)-1].end)
+
+	busySlots, err := connector.FreeBusy(ctx, account, from, to)
+	if err != nil {
+		return UserAvailability{}, err
+	}
+	busy := slotsToRuns(busySlots)
+	return availabilityFromBusy(event, account.UserID, busy, loc), nil
+}
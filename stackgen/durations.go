@@ -0,0 +1,146 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+type DurationTradeoff struct {
+	DurationMins   int                `json:"duration_mins"`
+	Recommendation SlotRecommendation `json:"recommendation"`
+}
+
+type DurationOptions struct {
+	LongestFullAttendance *DurationTradeoff  `json:"longest_full_attendance"` // nil when everyone is never free together long enough, or invitees have not answered
+	Tradeoffs             []DurationTradeoff `json:"tradeoffs"`               // Longest meeting for each attendance level, most attendees first
+}
+
+// hasFlexibleDuration reports whether the event accepts more than one meeting length
+func hasFlexibleDuration(event Event) bool {
+	return len(event.DurationsMins) > 0 || event.MinDuration > 0 || event.MaxDuration > 0
+}
+
+// validateDurations checks the flexible duration settings of an event
+func validateDurations(event Event) error {
+	for _, duration := range event.DurationsMins {
+		if duration <= 0 {
+			return fmt.Errorf("durations_mins must be positive")
+		}
+	}
+	if event.MinDuration < 0 || event.MaxDuration < 0 {
+		return fmt.Errorf("min_duration_mins and max_duration_mins cannot be negative")
+	}
+	if event.MaxDuration > 0 && event.MinDuration > event.MaxDuration {
+		return fmt.Errorf("min_duration_mins cannot exceed max_duration_mins")
+	}
+
+	// An explicit duration_mins has to be one of the acceptable lengths
+	if event.DurationMins == 0 {
+		return nil
+	}
+	if len(event.DurationsMins) > 0 && !slices.Contains(event.DurationsMins, event.DurationMins) {
+		return fmt.Errorf("duration_mins must be one of durations_mins")
+	}
+	if event.DurationMins < event.MinDuration {
+		return fmt.Errorf("duration_mins cannot be below min_duration_mins")
+	}
+	if event.MaxDuration > 0 && event.DurationMins > event.MaxDuration {
+		return fmt.Errorf("duration_mins cannot exceed max_duration_mins")
+	}
+	return nil
+}
+
+// shortestDuration is the shortest acceptable meeting length in minutes
+func shortestDuration(event Event) int {
+	if len(event.DurationsMins) > 0 {
+		return slices.Min(event.DurationsMins)
+	}
+	return max(event.MinDuration, 1)
+}
+
+// longestDurationWithin returns the longest acceptable meeting, in minutes,
+// that fits in the given number of minutes, or 0 if none does
+func longestDurationWithin(event Event, available int) int {
+	if len(event.DurationsMins) > 0 {
+		best := 0
+		for _, duration := range event.DurationsMins {
+			if duration <= available {
+				best = max(best, duration)
+			}
+		}
+		return best
+	}
+	if available < shortestDuration(event) {
+		return 0
+	}
+	if event.MaxDuration > 0 {
+		return min(available, event.MaxDuration)
+	}
+	return available
+}
+
+// findDurationTradeoffs finds, for every attendance level, the longest
+// acceptable meeting that many users can make, keeping only the options that
+// are not beaten on both length and attendance. It stops with the context's
+// error once the context is done.
+func findDurationTradeoffs(ctx context.Context, event Event) (DurationOptions, error) {
+	index := buildAvailabilityIndex(event)
+	options := DurationOptions{Tradeoffs: []DurationTradeoff{}}
+
+	minAttendees := index.quorum(event)
+	if err := index.sweep(ctx, int64(time.Duration(shortestDuration(event))*time.Minute), minAttendees); err != nil {
+		return DurationOptions{}, err
+	}
+
+	type option struct {
+		window   availabilityWindow
+		duration int
+	}
+	candidates := []option{}
+	for _, window := range index.windows {
+		if window.count < minAttendees {
+			continue
+		}
+		duration := longestDurationWithin(event, int(time.Duration(window.end-window.start).Minutes()))
+		if duration > 0 {
+			candidates = append(candidates, option{window: window, duration: duration})
+		}
+	}
+
+	// Most attendees first, then longest, then earliest
+	slices.SortFunc(candidates, func(a, b option) int {
+		return cmp.Or(
+			cmp.Compare(b.window.count, a.window.count),
+			cmp.Compare(b.duration, a.duration),
+			cmp.Compare(a.window.start, b.window.start),
+		)
+	})
+
+	longest := 0
+	for _, candidate := range candidates {
+		if candidate.duration <= longest {
+			continue
+		}
+		longest = candidate.duration
+
+		candidate.window.slotStart = candidate.window.start
+		candidate.window.score = float64(candidate.window.count)
+		meetingDuration := time.Duration(candidate.duration) * time.Minute
+		options.Tradeoffs = append(options.Tradeoffs, DurationTradeoff{
+			DurationMins:   candidate.duration,
+			Recommendation: index.recommendation(candidate.window, meetingDuration),
+		})
+	}
+
+	// Invitees who never answered may not make it, so they rule out full attendance too
+	if len(options.Tradeoffs) > 0 {
+		top := options.Tradeoffs[0].Recommendation
+		if len(top.UnavailableUsers) == 0 && len(top.PendingUsers) == 0 {
+			options.LongestFullAttendance = &options.Tradeoffs[0]
+		}
+	}
+	return options, nil
+}
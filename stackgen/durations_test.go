@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindDurationTradeoffs(t *testing.T) {
+	event := Event{
+		MinDuration: 30,
+		MaxDuration: 120,
+		Slots:       []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 13:00")),
+			userAvailability("bob", utcSlot("2025-01-15 10:00", "2025-01-15 12:30")),
+			userAvailability("carol", utcSlot("2025-01-15 11:00", "2025-01-15 12:00")),
+		},
+	}
+
+	options := durationTradeoffs(t, event)
+
+	// 60 min with everyone, 120 min with two (capped at the maximum), nothing longer with fewer
+	assert.Len(t, options.Tradeoffs, 2)
+	assert.Equal(t, 60, options.LongestFullAttendance.DurationMins)
+	assert.Equal(t, utcSlot("2025-01-15 11:00", "2025-01-15 12:00"), options.LongestFullAttendance.Recommendation.Slot)
+
+	assert.Equal(t, 120, options.Tradeoffs[1].DurationMins)
+	assert.Equal(t, []string{"alice", "bob"}, options.Tradeoffs[1].Recommendation.AvailableUsers)
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 12:00"), options.Tradeoffs[1].Recommendation.Slot)
+
+	t.Run("Fixed Durations", func(t *testing.T) {
+		event.MinDuration, event.MaxDuration = 0, 0
+		event.DurationsMins = []int{45, 90, 240}
+		options := durationTradeoffs(t, event)
+
+		assert.Equal(t, 45, options.LongestFullAttendance.DurationMins)
+		assert.Equal(t, 90, options.Tradeoffs[1].DurationMins)
+		assert.Equal(t, 240, options.Tradeoffs[2].DurationMins)
+		assert.Equal(t, []string{"alice"}, options.Tradeoffs[2].Recommendation.AvailableUsers)
+	})
+
+	t.Run("Pending Invitee", func(t *testing.T) {
+		// Nobody declined, but dave never answered
+		event.Invitees = []string{"alice", "bob", "carol", "dave"}
+		options := durationTradeoffs(t, event)
+
+		assert.Nil(t, options.LongestFullAttendance)
+		assert.NotEmpty(t, options.Tradeoffs)
+		assert.Empty(t, options.Tradeoffs[0].Recommendation.UnavailableUsers)
+		assert.Equal(t, []string{"dave"}, options.Tradeoffs[0].Recommendation.PendingUsers)
+	})
+}
+
+func TestValidateDurations(t *testing.T) {
+	assert.NoError(t, validateDurations(Event{MinDuration: 30, MaxDuration: 90}))
+	assert.Error(t, validateDurations(Event{MinDuration: 90, MaxDuration: 30}))
+	assert.Error(t, validateDurations(Event{DurationsMins: []int{30, 0}}))
+
+	// duration_mins has to be an acceptable length
+	assert.NoError(t, validateDurations(Event{DurationMins: 60, MinDuration: 30, MaxDuration: 90}))
+	assert.ErrorContains(t, validateDurations(Event{DurationMins: 90, MaxDuration: 60}), "max_duration_mins")
+	assert.ErrorContains(t, validateDurations(Event{DurationMins: 15, MinDuration: 30}), "min_duration_mins")
+	assert.NoError(t, validateDurations(Event{DurationMins: 45, DurationsMins: []int{30, 45}}))
+	assert.ErrorContains(t, validateDurations(Event{DurationMins: 60, DurationsMins: []int{30, 45}}), "durations_mins")
+	assert.NoError(t, validateDurations(Event{MinDuration: 30, MaxDuration: 60}))
+}
+
+// durationTradeoffs runs findDurationTradeoffs without a deadline
+func durationTradeoffs(t *testing.T, event Event) DurationOptions {
+	t.Helper()
+	options, err := findDurationTradeoffs(context.Background(), event)
+	assert.NoError(t, err)
+	return options
+}
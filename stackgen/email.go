@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Email kinds, which are also their outbox message types
+const (
+	EmailInvitation   = "email.invitation"
+	EmailReminder     = "email.reminder"
+	EmailConfirmation = "email.confirmation"
+)
+
+var emailKinds = []string{EmailInvitation, EmailReminder, EmailConfirmation}
+
+// SMTP connection security
+const (
+	SMTPStartTLS = "starttls" // Plain connection upgraded with STARTTLS, usually port 587
+	SMTPTLS      = "tls"      // TLS from the start, usually port 465
+	SMTPNone     = "none"     // Unencrypted, for local relays
+)
+
+// Email is a rendered message, stored as the payload of its outbox message
+type Email struct {
+	To          string            `json:"to"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text"`
+	HTML        string            `json:"html"`
+	Attachments []EmailAttachment `json:"attachments,omitempty"`
+	// The invite whose token goes in place of inviteTokenPlaceholder. Only
+	// the claims are stored; the token is signed when the email is sent.
+	Invite *inviteClaims `json:"invite,omitempty"`
+}
+
+// inviteTokenPlaceholder stands in for the token in a queued invite link
+const inviteTokenPlaceholder = "__invite_token__"
+
+type EmailAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     string `json:"content"`
+}
+
+// EmailRequest is the body of the invitation and reminder endpoints
+type EmailRequest struct {
+	Emails  []string `json:"emails"`
+	Message string   `json:"message,omitempty"` // Personal note from the organizer
+}
+
+// emailData is what the templates see
+type emailData struct {
+	Title     string
+	EventID   string
+	Recipient string
+	Duration  int
+	Window    string // Span of the event's slots
+	When      string // The scheduled slot, empty until there is one
+	Message   string
+	Link      string
+}
+
+//go:embed templates/email/*
+var bundledEmailTemplates embed.FS
+
+// emailTemplates holds, for each kind, "<kind>.txt" with a "<kind>.subject"
+// block and "<kind>.html"; kinds are named without the "email." prefix
+type emailTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var mailTemplates = mustParseEmailTemplates(bundledEmailTemplates, "templates/email")
+
+// parseEmailTemplates reads the templates of every email kind from dir
+func parseEmailTemplates(fsys fs.FS, dir string) (*emailTemplates, error) {
+	templates := &emailTemplates{}
+	var err error
+	if templates.text, err = texttemplate.ParseFS(fsys, dir+"/*.txt"); err != nil {
+		return nil, err
+	}
+	if templates.html, err = htmltemplate.ParseFS(fsys, dir+"/*.html"); err != nil {
+		return nil, err
+	}
+	for _, kind := range emailKinds {
+		name := strings.TrimPrefix(kind, "email.")
+		if templates.text.Lookup(name+".txt") == nil || templates.text.Lookup(name+".subject") == nil || templates.html.Lookup(name+".html") == nil {
+			return nil, fmt.Errorf("missing %s.txt, %s.subject or %s.html template", name, name, name)
+		}
+	}
+	return templates, nil
+}
+
+func mustParseEmailTemplates(fsys fs.FS, dir string) *emailTemplates {
+	templates, err := parseEmailTemplates(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// render fills in the subject and both bodies of an email
+func (t *emailTemplates) render(kind string, data emailData) (Email, error) {
+	name := strings.TrimPrefix(kind, "email.")
+	email := Email{To: data.Recipient}
+
+	var b bytes.Buffer
+	if err := t.text.ExecuteTemplate(&b, name+".subject", data); err != nil {
+		return email, err
+	}
+	email.Subject = strings.Join(strings.Fields(b.String()), " ")
+
+	b.Reset()
+	if err := t.text.ExecuteTemplate(&b, name+".txt", data); err != nil {
+		return email, err
+	}
+	email.Text = b.String()
+
+	b.Reset()
+	if err := t.html.ExecuteTemplate(&b, name+".html", data); err != nil {
+		return email, err
+	}
+	email.HTML = b.String()
+	return email, nil
+}
+
+// publicURL is where links in emails point, e.g. https://scheduler.example.com
+var publicURL string
+
+// newEmailData describes an event for the templates
+func newEmailData(event Event, recipient, message string) emailData {
+	data := emailData{
+		Title:     event.Title,
+		EventID:   event.ID,
+		Recipient: recipient,
+		Duration:  event.DurationMins,
+		Message:   message,
+		Link:      strings.TrimSuffix(publicURL, "/") + "/events/" + event.ID,
+	}
+	if data.Title == "" {
+		data.Title = event.ID
+	}
+	if len(event.Slots) > 0 {
+		first, last := event.Slots[0], event.Slots[0]
+		for _, slot := range event.Slots {
+			if slot.Start_UTC.Before(first.Start_UTC) {
+				first = slot
+			}
+			if slot.End_UTC.After(last.End_UTC) {
+				last = slot
+			}
+		}
+		data.Window = formatTimeForDisplay(first.Start_UTC, first.TimeZone) + " and " + formatTimeForDisplay(last.End_UTC, last.TimeZone)
+	}
+	if event.ScheduledSlot != nil {
+		data.When = formatTimeForDisplay(event.ScheduledSlot.Start_UTC, event.ScheduledSlot.TimeZone)
+	}
+	return data
+}
+
+// validateEmailRecipients checks addresses and drops repeats
+func validateEmailRecipients(recipients []string) ([]string, error) {
+	valid := []string{}
+	for _, recipient := range recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address: %s", recipient)
+		}
+		if !slices.Contains(valid, address.Address) {
+			valid = append(valid, address.Address)
+		}
+	}
+	return valid, nil
+}
+
+// participantEmails are the participants whose user ID is an email address
+func participantEmails(event Event) []string {
+	return userEmails(eventParticipants(event))
+}
+
+// checkEventRecipients rejects addresses that are not participants of the
+// event, so its emails cannot be sent to strangers
+func checkEventRecipients(event Event, recipients []string) error {
+	participants := participantEmails(event)
+	for _, recipient := range recipients {
+		if !slices.Contains(participants, recipient) {
+			return fmt.Errorf("%s is not a participant of this event; add them to invitees first", recipient)
+		}
+	}
+	return nil
+}
+
+// userEmails keeps the user IDs that are email addresses, sorted
+func userEmails(users []string) []string {
+	recipients := []string{}
+	for _, user := range users {
+		if address, err := mail.ParseAddress(user); err == nil && !slices.Contains(recipients, address.Address) {
+			recipients = append(recipients, address.Address)
+		}
+	}
+	slices.Sort(recipients)
+	return recipients
+}
+
+// emailMessages renders one email per recipient as outbox messages, so each
+// is retried on its own. A recipient with an invite gets its invite link in
+// place of the event link. Confirmations carry the meeting as invite.ics.
+func emailMessages(kind string, event Event, recipients []string, message string, invites map[string]Invite) ([]OutboxMessage, error) {
+	var attachments []EmailAttachment
+	if kind == EmailConfirmation && event.ScheduledSlot != nil {
+		calendar := writeEventCalendar(event, []calendarEntry{scheduledEntry(event)}, nil, clock())
+		attachments = append(attachments, EmailAttachment{
+			Filename:    "invite.ics",
+			ContentType: "text/calendar; charset=utf-8; method=PUBLISH",
+			Content:     calendar,
+		})
+	}
+
+	now := clock()
+	messages := make([]OutboxMessage, 0, len(recipients))
+	for _, recipient := range recipients {
+		data := newEmailData(event, recipient, message)
+		invite, invited := invites[recipient]
+		if invited {
+			data.Link = inviteLink(event.ID, inviteTokenPlaceholder)
+		}
+		email, err := mailTemplates.render(kind, data)
+		if err != nil {
+			return nil, err
+		}
+		email.Attachments = attachments
+		if invited {
+			claims := invite.claims(event.ID)
+			email.Invite = &claims
+		}
+		outboxMessage, err := newOutboxMessage(kind, event.ID, recipient, email, now)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, outboxMessage)
+	}
+	return messages, nil
+}
+
+// smtpMailer sends email through an SMTP server
+type smtpMailer struct {
+	host     string
+	port     string
+	security string // starttls, tls or none
+	username string
+	password string
+	from     string
+	timeout  time.Duration
+}
+
+// mailer is configured from SMTP_HOST; while it is nil no email is queued
+var mailer *smtpMailer
+
+// newSMTPMailer checks the SMTP settings. The port defaults to the usual one
+// for the connection security.
+func newSMTPMailer(host, port, security, username, password, from string) (*smtpMailer, error) {
+	if security == "" {
+		security = SMTPStartTLS
+	}
+	if port == "" {
+		port = map[string]string{SMTPStartTLS: "587", SMTPTLS: "465", SMTPNone: "25"}[security]
+	}
+	if !slices.Contains([]string{SMTPStartTLS, SMTPTLS, SMTPNone}, security) {
+		return nil, fmt.Errorf("SMTP_TLS must be starttls, tls or none")
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid SMTP_FROM address: %s", from)
+	}
+	// smtp.PlainAuth only sends credentials in the clear to localhost
+	if security == SMTPNone && username != "" && !slices.Contains([]string{"localhost", "127.0.0.1", "::1"}, host) {
+		return nil, fmt.Errorf("SMTP_USERNAME needs SMTP_TLS starttls or tls unless SMTP_HOST is localhost")
+	}
+	return &smtpMailer{
+		host:     host,
+		port:     port,
+		security: security,
+		username: username,
+		password: password,
+		from:     from,
+		timeout:  30 * time.Second,
+	}, nil
+}
+
+// send delivers one email. The Message-ID is derived from id, so a resend
+// after a crash can be recognised as the same message.
+func (m *smtpMailer) send(ctx context.Context, id string, email Email) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+	body, err := buildEmailMessage(m.from, id, email, clock())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.host, m.port)
+	dialer := &net.Dialer{Timeout: m.timeout}
+	var conn net.Conn
+	if m.security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(m.timeout))
+
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(email.To); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildEmailMessage writes a multipart/mixed message: a text and HTML
+// alternative, then the attachments
+func buildEmailMessage(from, id string, email Email, date time.Time) ([]byte, error) {
+	var alternative bytes.Buffer
+	bodies := multipart.NewWriter(&alternative)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		w, err := bodies.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(strings.ReplaceAll(part.content, "\n", "\r\n")))
+		qp.Close()
+	}
+	bodies.Close()
+
+	var b bytes.Buffer
+	mixed := multipart.NewWriter(&b)
+	header := func(name, value string) { fmt.Fprintf(&b, "%s: %s\r\n", name, value) }
+	header("From", from)
+	header("To", email.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+id+"@stackgen-scheduler>")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+	b.WriteString("\r\n")
+
+	w, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + bodies.Boundary()}})
+	if err != nil {
+		return nil, err
+	}
+	w.Write(alternative.Bytes())
+
+	for _, attachment := range email.Attachments {
+		w, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(attachment.Content))
+		for len(encoded) > 76 {
+			w.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		w.Write([]byte(encoded + "\r\n"))
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// emailSink sends the email messages of the outbox and ignores the rest
+type emailSink struct {
+	mailer *smtpMailer
+}
+
+func (emailSink) Name() string { return "email" }
+
+func (s emailSink) Deliver(ctx context.Context, message OutboxMessage) error {
+	if !slices.Contains(emailKinds, message.Type) {
+		return nil
+	}
+	var email Email
+	if err := json.Unmarshal([]byte(message.Payload), &email); err != nil {
+		return err
+	}
+	if email.Invite != nil {
+		token := url.QueryEscape(signInvite(*email.Invite))
+		email.Text = strings.ReplaceAll(email.Text, inviteTokenPlaceholder, token)
+		email.HTML = strings.ReplaceAll(email.HTML, inviteTokenPlaceholder, token)
+	}
+	return s.mailer.send(ctx, message.ID, email)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receivedEmail is what the SMTP stand-in was handed for one message
+type receivedEmail struct {
+	Auth string
+	From string
+	To   []string
+	Data string
+}
+
+// smtpStandIn is a minimal SMTP server on localhost that keeps what it receives
+type smtpStandIn struct {
+	listener net.Listener
+	mu       sync.Mutex
+	received []receivedEmail
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &smtpStandIn{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	c := textproto.NewConn(conn)
+	defer c.Close()
+
+	var current receivedEmail
+	c.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := c.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			c.PrintfLine("250-localhost")
+			c.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			current.Auth = arg
+			c.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			current.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			c.PrintfLine("250 OK")
+		case "RCPT":
+			current.To = append(current.To, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			c.PrintfLine("250 OK")
+		case "DATA":
+			c.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := c.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			current.Data = string(data)
+			s.mu.Lock()
+			s.received = append(s.received, current)
+			s.mu.Unlock()
+			current = receivedEmail{Auth: current.Auth}
+			c.PrintfLine("250 OK")
+		case "QUIT":
+			c.PrintfLine("221 Bye")
+			return
+		default:
+			c.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpStandIn) mailer(t *testing.T, security string) *smtpMailer {
+	host, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	m, err := newSMTPMailer(host, port, security, "scheduler", "s3cret", "Scheduler <scheduler@example.com>")
+	assert.NoError(t, err)
+	m.timeout = 5 * time.Second
+	return m
+}
+
+func (s *smtpStandIn) messages() []receivedEmail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedEmail(nil), s.received...)
+}
+
+func confirmedEvent() Event {
+	slot := utcSlot("2025-01-15 14:00", "2025-01-15 15:00")
+	return Event{
+		ID:            "review",
+		Title:         "Design <review>",
+		DurationMins:  60,
+		Status:        StatusConfirmed,
+		ScheduledSlot: &slot,
+		Slots:         []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("bob@example.com", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+			userAvailability("carol", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+			userAvailability("alice@example.com", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+		},
+	}
+}
+
+func TestEmailMessages(t *testing.T) {
+	event := confirmedEvent()
+	recipients := participantEmails(event)
+	assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, recipients)
+	assert.NoError(t, checkEventRecipients(event, recipients))
+	assert.ErrorContains(t, checkEventRecipients(event, []string{"bob@example.com", "stranger@example.com"}), "stranger@example.com")
+
+	messages, err := emailMessages(EmailConfirmation, event, recipients, "Bring the mockups", nil)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+
+	var email Email
+	assert.NoError(t, json.Unmarshal([]byte(messages[0].Payload), &email))
+	assert.Equal(t, EmailConfirmation, messages[0].Type)
+	assert.Equal(t, "alice@example.com", messages[0].UserID)
+	assert.Equal(t, "alice@example.com", email.To)
+	assert.Equal(t, "Confirmed: Design <review> on 15 Jan 2025, 2:00PM UTC", email.Subject)
+	assert.Contains(t, email.Text, "Bring the mockups")
+	assert.Contains(t, email.HTML, "Design &lt;review&gt;")
+
+	assert.Len(t, email.Attachments, 1)
+	assert.Equal(t, "invite.ics", email.Attachments[0].Filename)
+	assert.Contains(t, email.Attachments[0].Content, "STATUS:CONFIRMED")
+	assert.Contains(t, email.Attachments[0].Content, "mailto:alice@example.com")
+
+	// Invitations carry no calendar
+	messages, err = emailMessages(EmailInvitation, event, []string{"dave@example.com"}, "", nil)
+	assert.NoError(t, err)
+	var invitation Email
+	assert.NoError(t, json.Unmarshal([]byte(messages[0].Payload), &invitation))
+	assert.Empty(t, invitation.Attachments)
+	assert.Equal(t, "Invitation: Design <review>", invitation.Subject)
+	assert.Contains(t, invitation.Text, "/events/review")
+}
+
+func TestSMTPMailerSends(t *testing.T) {
+	server := newSMTPStandIn(t)
+	m := server.mailer(t, SMTPNone)
+
+	messages, err := emailMessages(EmailConfirmation, confirmedEvent(), []string{"bob@example.com"}, "", nil)
+	assert.NoError(t, err)
+	var email Email
+	assert.NoError(t, json.Unmarshal([]byte(messages[0].Payload), &email))
+	assert.NoError(t, m.send(context.Background(), messages[0].ID, email))
+
+	received := server.messages()
+	assert.Len(t, received, 1)
+	assert.Equal(t, "scheduler@example.com", received[0].From)
+	assert.Equal(t, []string{"bob@example.com"}, received[0].To)
+	credentials, _ := base64.StdEncoding.DecodeString(received[0].Auth[len("PLAIN "):])
+	assert.Equal(t, "\x00scheduler\x00s3cret", string(credentials))
+
+	msg, err := mail.ReadMessage(strings.NewReader(received[0].Data))
+	assert.NoError(t, err)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.Equal(t, email.Subject, subject)
+	assert.Equal(t, "<"+messages[0].ID+"@stackgen-scheduler>", msg.Header.Get("Message-ID"))
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	assert.Equal(t, "multipart/mixed", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	alternative, err := parts.NextPart()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(alternative.Header.Get("Content-Type"), "multipart/alternative"))
+
+	attachment, err := parts.NextPart()
+	assert.NoError(t, err)
+	assert.Equal(t, "invite.ics", attachment.FileName())
+	encoded, _ := io.ReadAll(attachment)
+	calendar, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	assert.NoError(t, err)
+	assert.Equal(t, email.Attachments[0].Content, string(calendar))
+}
+
+func TestSMTPMailerRequiresStartTLS(t *testing.T) {
+	server := newSMTPStandIn(t)
+	m := server.mailer(t, SMTPStartTLS)
+
+	err := m.send(context.Background(), "id", Email{To: "bob@example.com", Subject: "Hi"})
+	assert.ErrorContains(t, err, "STARTTLS")
+	assert.Empty(t, server.messages())
+}
+
+func TestEmailSinkThroughOutbox(t *testing.T) {
+	server := newSMTPStandIn(t)
+	messages, err := emailMessages(EmailReminder, confirmedEvent(), []string{"alice@example.com", "bob@example.com"}, "", nil)
+	assert.NoError(t, err)
+	other, _ := newOutboxMessage(WebhookEventUpdated, "review", "", nil, time.Now())
+
+	store := newMemoryOutboxStore(append(messages, other)...)
+	dispatcher := &outboxDispatcher{store: store, sinks: []OutboxSink{emailSink{server.mailer(t, SMTPNone)}}, batch: 10, lease: time.Minute, maxAttempts: 5, backoff: time.Second}
+	_, err = dispatcher.dispatchOnce(context.Background())
+	assert.NoError(t, err)
+
+	// One email per recipient; other messages are not mail
+	received := server.messages()
+	assert.Len(t, received, 2)
+	for _, message := range append(messages, other) {
+		assert.Equal(t, OutboxDispatched, store.messages[message.ID].Status)
+	}
+	assert.Contains(t, received[0].Data+received[1].Data, "Subject: Reminder: Design <review> on 15 Jan 2025, 2:00PM UTC")
+}
+
+func TestInvitationTokenSignedOnDelivery(t *testing.T) {
+	server := newSMTPStandIn(t)
+	event := confirmedEvent()
+	issued, err := issueInvite(&event, "dave@example.com", 0, time.Now())
+	assert.NoError(t, err)
+
+	messages, err := emailMessages(EmailInvitation, event, []string{"dave@example.com"}, "", map[string]Invite{"dave@example.com": issued.Invite})
+	assert.NoError(t, err)
+
+	// The outbox keeps which invite it is, never a working token
+	assert.NotContains(t, messages[0].Payload, issued.Token)
+	assert.Contains(t, messages[0].Payload, issued.TokenID)
+
+	assert.NoError(t, emailSink{server.mailer(t, SMTPNone)}.Deliver(context.Background(), messages[0]))
+	received := server.messages()
+	assert.Len(t, received, 1)
+	body := regexp.MustCompile(`=\r?\n`).ReplaceAllString(received[0].Data, "") // Undo quoted-printable line wrapping
+	assert.NotContains(t, body, inviteTokenPlaceholder)
+	match := regexp.MustCompile(`token=3D([A-Za-z0-9_.-]+)`).FindStringSubmatch(body)
+	assert.Len(t, match, 2)
+	claims, err := parseInvite(match[1], time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, issued.TokenID, claims.TokenID)
+	assert.Equal(t, "dave@example.com", claims.UserID)
+}
+
+func TestSMTPMailerSettings(t *testing.T) {
+	m, err := newSMTPMailer("smtp.example.com", "", "", "", "", "scheduler@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, SMTPStartTLS, m.security)
+	assert.Equal(t, "587", m.port)
+
+	m, err = newSMTPMailer("smtp.example.com", "", SMTPTLS, "", "", "scheduler@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "465", m.port)
+
+	_, err = newSMTPMailer("smtp.example.com", "", "ssl", "", "", "scheduler@example.com")
+	assert.Error(t, err)
+	_, err = newSMTPMailer("smtp.example.com", "", "", "", "", "not an address")
+	assert.Error(t, err)
+
+	// Credentials only go unencrypted to a relay on the same host
+	_, err = newSMTPMailer("smtp.example.com", "", SMTPNone, "scheduler", "s3cret", "scheduler@example.com")
+	assert.ErrorContains(t, err, "SMTP_USERNAME")
+	_, err = newSMTPMailer("localhost", "", SMTPNone, "scheduler", "s3cret", "scheduler@example.com")
+	assert.NoError(t, err)
+	_, err = newSMTPMailer("smtp.example.com", "", SMTPNone, "", "", "scheduler@example.com")
+	assert.NoError(t, err)
+
+	recipients, err := validateEmailRecipients([]string{"bob@example.com", "Bob <bob@example.com>"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bob@example.com"}, recipients)
+	_, err = validateEmailRecipients([]string{"bob"})
+	assert.Error(t, err)
+}
+
+func TestParseEmailTemplates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"invitation.txt":  {Data: []byte(`{{define "invitation.subject"}}Join {{.Title}}{{end}}{{.Link}}`)},
+		"invitation.html": {Data: []byte(`<a href="{{.Link}}">{{.Title}}</a>`)},
+	}
+	_, err := parseEmailTemplates(fsys, ".")
+	assert.ErrorContains(t, err, "reminder")
+
+	for _, name := range []string{"reminder", "confirmation"} {
+		fsys[name+".txt"] = &fstest.MapFile{Data: []byte(`{{define "` + name + `.subject"}}{{.Title}}{{end}}{{.Title}}`)}
+		fsys[name+".html"] = &fstest.MapFile{Data: []byte(`{{.Title}}`)}
+	}
+	templates, err := parseEmailTemplates(fsys, ".")
+	assert.NoError(t, err)
+	email, err := templates.render(EmailInvitation, emailData{Title: "Standup", Link: "https://example.com/events/standup"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Join Standup", email.Subject)
+	assert.Equal(t, "https://example.com/events/standup", email.Text)
+}
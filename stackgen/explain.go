@@ -0,0 +1,280 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// maxRejectedWindows bounds how many better attended windows an explanation lists
+const maxRejectedWindows = 10
+
+type UserExplanation struct {
+	UserID    string     `json:"user_id"`
+	Available bool       `json:"available"`
+	Intervals []TimeSlot `json:"intervals"`        // The user's availability overlapping the slot
+	Reason    string     `json:"reason,omitempty"` // Why the user cannot attend
+}
+
+type RejectedWindow struct {
+	Window         TimeSlot `json:"window"`
+	AvailableUsers []string `json:"available_users"`
+	Reason         string   `json:"reason"`
+}
+
+type ScoreBreakdown struct {
+	AvailableUsers int     `json:"available_users"`
+	TotalUsers     int     `json:"total_users"`
+	MinAttendees   int     `json:"min_attendees"`
+	Score          float64 `json:"score"` // Ranking score when recommended
+}
+
+type Explanation struct {
+	Slot        TimeSlot          `json:"slot"`
+	Rank        int               `json:"rank"` // Position among the recommendations, 0 if not recommended
+	Score       ScoreBreakdown    `json:"score"`
+	Users       []UserExplanation `json:"users"`
+	Constraints []string          `json:"constraints"`
+	Rejected    []RejectedWindow  `json:"rejected"` // Best attended windows with more attendees than the slot, most first
+}
+
+// explainSlot describes why a candidate slot is, or is not, among an event's
+// recommendations. It reads the same free runs the scheduler ranks, so a user
+// is available exactly when the scheduler would count them. The slot is the
+// chosen recommendation, or, without one, a bare start. Ranks are counted
+// from the window scores rather than by materialising every recommendation.
+// It stops with the context's error once the context is done.
+func explainSlot(ctx context.Context, event Event, resources []Resource, slot TimeSlot, chosen *SlotRecommendation) (Explanation, error) {
+	start, end := slot.Start_UTC.UnixNano(), slot.End_UTC.UnixNano()
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+
+	explanation := Explanation{
+		Slot:        slot,
+		Users:       []UserExplanation{},
+		Constraints: []string{fmt.Sprintf("duration_mins: %d", event.DurationMins)},
+		Rejected:    []RejectedWindow{},
+	}
+
+	inEventSlot := runsCover(mergeRuns(slotsToRuns(event.Slots)), start, end)
+	if !inEventSlot {
+		explanation.Constraints = append(explanation.Constraints, "slot lies outside the event's slots")
+	}
+
+	tooSoon := false
+	earliest := earliestStart(event)
+	if !earliest.IsZero() {
+		explanation.Constraints = append(explanation.Constraints, "earliest start: "+earliest.UTC().Format(time.RFC3339))
+		tooSoon = slot.Start_UTC.Before(earliest)
+	}
+
+	// The user's own free time, with adjacent slots joined but before buffers,
+	// notice, holidays and declined times are applied
+	raw := event
+	raw.BufferBefore, raw.BufferAfter = 0, 0
+	raw.NotBefore, raw.now = nil, time.Time{}
+	raw.HolidayPolicy = HolidayPolicyIgnore
+	raw.RejectedSlots = nil
+	rawIndex := buildAvailabilityIndex(raw)
+
+	index, scored, err := scoredWindows(ctx, event)
+	if err != nil {
+		return Explanation{}, err
+	}
+	regions := userRegions(event)
+	locations := userTimezones(event)
+	excluding := event.HolidayPolicy == "" || event.HolidayPolicy == HolidayPolicyExclude
+
+	// Per user: what they offered around the slot and whether it is enough
+	available := 0
+	for i, user := range index.users {
+		userExplanation := UserExplanation{UserID: user, Intervals: []TimeSlot{}}
+		for _, entry := range event.UserSlots {
+			if entry.UserID != user {
+				continue
+			}
+			for _, userSlot := range entry.Slots {
+				if userSlot.Start_UTC.Before(slot.End_UTC) && slot.Start_UTC.Before(userSlot.End_UTC) {
+					userExplanation.Intervals = append(userExplanation.Intervals, userSlot)
+				}
+			}
+		}
+		userExplanation.Available = runsCover(index.runs[i], start, end)
+		loc, ok := locations[user]
+		if !ok {
+			loc = time.UTC
+		}
+
+		switch {
+		case userExplanation.Available:
+			available++
+		case !inEventSlot:
+			userExplanation.Reason = "slot lies outside the event's slots"
+		case tooSoon:
+			userExplanation.Reason = "slot starts before the earliest allowed start"
+		case len(userExplanation.Intervals) == 0:
+			userExplanation.Reason = "no availability overlapping the slot"
+		case !runsCover(rawIndex.runs[i], start, end):
+			userExplanation.Reason = "only free for part of the slot"
+		case excluding && regions[user] != "" && onHoliday(regions[user], loc, slot):
+			userExplanation.Reason = "slot falls on a public holiday in " + regions[user]
+		case declinedDuring(event, user, slot):
+			userExplanation.Reason = "declined this time when it was confirmed"
+		default:
+			userExplanation.Reason = "free for the meeting but not for the required buffers"
+		}
+		explanation.Users = append(explanation.Users, userExplanation)
+	}
+
+	minAttendees := index.quorum(event)
+	if event.MinAttendees != nil {
+		explanation.Constraints = append(explanation.Constraints, fmt.Sprintf("min_attendees: %d of %d", minAttendees, index.eligibleUsers()))
+	}
+	if event.BufferBefore > 0 || event.BufferAfter > 0 {
+		explanation.Constraints = append(explanation.Constraints,
+			fmt.Sprintf("buffers: %d mins before, %d mins after", event.BufferBefore, event.BufferAfter))
+	}
+	if event.Resource != nil {
+		explanation.Constraints = append(explanation.Constraints, "resource: "+event.Resource.Type)
+	}
+	explanation.Constraints = append(explanation.Constraints, "strategy: "+eventStrategy(event))
+
+	explanation.Score = ScoreBreakdown{
+		AvailableUsers: available,
+		TotalUsers:     index.eligibleUsers(),
+		MinAttendees:   minAttendees,
+	}
+
+	// The chosen recommendation is found by its window. Several recommendations
+	// can share a start, so a bare start is matched to the one whose attendees
+	// are everyone free for it.
+	target := -1
+	if chosen != nil {
+		windowStart, windowEnd := chosen.Window.Start_UTC.UnixNano(), chosen.Window.End_UTC.UnixNano()
+		target = slices.IndexFunc(scored, func(window availabilityWindow) bool {
+			return window.start == windowStart && window.end == windowEnd
+		})
+	} else {
+		target = slices.IndexFunc(scored, func(window availabilityWindow) bool {
+			if window.count != available || window.start > start || window.end < end {
+				return false
+			}
+			rec, ok := index.bookedRecommendation(event, resources, window, meetingDuration)
+			return ok && rec.Slot.Start_UTC.Equal(slot.Start_UTC) && rec.Slot.End_UTC.Equal(slot.End_UTC)
+		})
+	}
+	if target >= 0 {
+		rank, err := index.windowRank(ctx, event, resources, scored, scored[target])
+		if err != nil {
+			return Explanation{}, err
+		}
+		if rank > 0 {
+			explanation.Rank = rank
+			explanation.Score.Score = scored[target].score
+		}
+	}
+
+	// Look for windows where more people were free, including those too short
+	// to have been ranked, and say why they lost. Only the best attended are
+	// kept, as a busy event has far more.
+	if err := index.sweep(ctx, 0, available+1); err != nil {
+		return Explanation{}, err
+	}
+	windows := index.windows
+	slices.SortFunc(windows, func(a, b availabilityWindow) int {
+		return cmp.Or(
+			cmp.Compare(b.count, a.count),
+			cmp.Compare(a.start, b.start),
+			cmp.Compare(a.end, b.end),
+		)
+	})
+	if len(windows) > maxRejectedWindows {
+		windows = windows[:maxRejectedWindows]
+	}
+
+	for _, window := range windows {
+		windowRank := 0
+		if i := slices.IndexFunc(scored, func(s availabilityWindow) bool { return s.start == window.start && s.end == window.end }); i >= 0 {
+			if windowRank, err = index.windowRank(ctx, event, resources, scored, scored[i]); err != nil {
+				return Explanation{}, err
+			}
+		}
+		users, _ := index.usersFree(window.start, window.end)
+		explanation.Rejected = append(explanation.Rejected, RejectedWindow{
+			Window:         TimeSlot{Start_UTC: nanosToTime(window.start), End_UTC: nanosToTime(window.end)},
+			AvailableUsers: users,
+			Reason:         rejectionReason(event, window, windowRank, explanation.Rank, minAttendees, earliest),
+		})
+	}
+
+	return explanation, nil
+}
+
+// windowRank is where a scored window comes among the recommendations: one
+// more than the better windows that are recommended too. It is 0 when the
+// window is not recommended, for want of a resource or for being past
+// maxCandidateWindows.
+func (index *availabilityIndex) windowRank(ctx context.Context, event Event, resources []Resource, scored []availabilityWindow, target availabilityWindow) (int, error) {
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+	bookable := func(window availabilityWindow) bool {
+		_, ok := index.bookedRecommendation(event, resources, window, meetingDuration)
+		return ok
+	}
+	if event.Resource != nil && !bookable(target) {
+		return 0, nil
+	}
+
+	rank := 1
+	for i, window := range scored {
+		if i%candidateCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		if compareWindows(window, target) >= 0 || (event.Resource != nil && !bookable(window)) {
+			continue
+		}
+		if rank++; rank > maxCandidateWindows {
+			return 0, nil
+		}
+	}
+	return rank, nil
+}
+
+// rejectionReason says why a better attended window did not beat the
+// explained slot, from where, if anywhere, it was ranked. windowRank is the
+// window's rank and rank the explained slot's, 0 when not recommended.
+func rejectionReason(event Event, window availabilityWindow, windowRank, rank, minAttendees int, earliest time.Time) string {
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+	buffers := time.Duration(event.BufferBefore+event.BufferAfter) * time.Minute
+	length := time.Duration(window.end - window.start)
+
+	if windowRank > 0 {
+		if rank == 0 || windowRank < rank {
+			return fmt.Sprintf("ranked %d, above this slot", windowRank)
+		}
+		return fmt.Sprintf("ranked %d, below this slot by the %s strategy", windowRank, eventStrategy(event))
+	}
+
+	switch {
+	case length < meetingDuration && !earliest.IsZero() && window.start == earliest.UnixNano():
+		return fmt.Sprintf("%d minutes are left after the earliest allowed start, less than the %d minute meeting", int(length.Minutes()), event.DurationMins)
+	case length < meetingDuration && buffers > 0 && length+buffers >= meetingDuration:
+		return fmt.Sprintf("%d minute window is only long enough for the meeting without the buffers", int(length.Minutes()))
+	case length < meetingDuration:
+		return fmt.Sprintf("%d minute window is shorter than the %d minute meeting", int(length.Minutes()), event.DurationMins)
+	case window.count < minAttendees:
+		return fmt.Sprintf("%d attendees are fewer than the %d min_attendees requires", window.count, minAttendees)
+	case event.Resource != nil:
+		return fmt.Sprintf("no %s is free for the meeting in this window", event.Resource.Type)
+	}
+	return "not among the recommendations"
+}
+
+// runsCover reports whether one of the sorted, merged runs holds the whole span
+func runsCover(runs []freeRun, start, end int64) bool {
+	i := sort.Search(len(runs), func(k int) bool { return runs[k].end >= end })
+	return i < len(runs) && runs[i].start <= start
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainSlot(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 11:00")),
+			userAvailability("carol", utcSlot("2025-01-15 10:30", "2025-01-15 13:00")),
+		},
+	}
+
+	explanation := explainedSlot(t, event, nil, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), nil)
+
+	assert.Equal(t, 1, explanation.Rank)
+	assert.Equal(t, 2, explanation.Score.AvailableUsers)
+	assert.Equal(t, 3, explanation.Score.TotalUsers)
+
+	assert.True(t, explanation.Users[0].Available)
+	assert.True(t, explanation.Users[1].Available)
+	assert.False(t, explanation.Users[2].Available)
+	assert.Equal(t, "no availability overlapping the slot", explanation.Users[2].Reason)
+
+	// Everyone overlaps from 10:30 to 11:00, too short for the meeting
+	assert.Len(t, explanation.Rejected, 1)
+	assert.Equal(t, utcSlot("2025-01-15 10:30", "2025-01-15 11:00"), explanation.Rejected[0].Window)
+	assert.Equal(t, "30 minute window is shorter than the 60 minute meeting", explanation.Rejected[0].Reason)
+}
+
+func TestExplainSlotMatchesScheduler(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		Invitees:     []string{"alice", "bob", "carol", "dave"},
+		MinAttendees: &AttendeeThreshold{Percent: 50},
+		UserSlots: []UserAvailability{
+			// A meeting across the two slots is fine: they are one stretch of free time
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 09:30"), utcSlot("2025-01-15 09:30", "2025-01-15 11:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 11:00")),
+		},
+	}
+	slot := utcSlot("2025-01-15 09:00", "2025-01-15 10:00")
+
+	explanation := explainedSlot(t, event, nil, slot, nil)
+	assert.Equal(t, 1, explanation.Rank)
+	assert.True(t, explanation.Users[0].Available)
+	assert.Equal(t, 2, explanation.Score.AvailableUsers)
+
+	// Pending invitees count towards the quorum, as they do when ranking
+	assert.Equal(t, 4, explanation.Score.TotalUsers)
+	assert.Equal(t, 2, explanation.Score.MinAttendees)
+	assert.Contains(t, explanation.Constraints, "min_attendees: 2 of 4")
+
+	// A slot without a free room is not ranked
+	event.Resource = &ResourceRequirement{Type: "room"}
+	rooms := []Resource{{ID: "huddle", Type: "room", Capacity: 4, Slots: []TimeSlot{utcSlot("2025-01-15 10:00", "2025-01-15 11:00")}}}
+	recommendations := slotsWithResources(t, event, rooms, 0)
+	assert.Equal(t, 0, explainedSlot(t, event, rooms, slot, nil).Rank)
+	assert.Equal(t, 1, explainedSlot(t, event, rooms, recommendations[0].Slot, &recommendations[0]).Rank)
+}
+
+func TestExplainSlotSharedStart(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 10:00")),
+		},
+	}
+	recommendations := optimalSlots(t, event, 0)
+	assert.Len(t, recommendations, 2)
+	assert.Equal(t, recommendations[0].Slot, recommendations[1].Slot)
+
+	// Both start at 9:00; the ID tells them apart
+	explanation := explainedSlot(t, event, nil, recommendations[1].Slot, &recommendations[1])
+	assert.Equal(t, 2, explanation.Rank)
+	assert.Equal(t, recommendations[1].Score, explanation.Score.Score)
+
+	// A bare start is the recommendation with everyone free for it
+	assert.Equal(t, 1, explainedSlot(t, event, nil, recommendations[1].Slot, nil).Rank)
+
+	// Better attended windows are described by where they were ranked
+	explanation = explainedSlot(t, event, nil, utcSlot("2025-01-15 13:00", "2025-01-15 14:00"), nil)
+	assert.Equal(t, 0, explanation.Rank)
+	assert.Len(t, explanation.Rejected, 2)
+	assert.Equal(t, []string{"alice", "bob"}, explanation.Rejected[0].AvailableUsers)
+	assert.Equal(t, "ranked 1, above this slot", explanation.Rejected[0].Reason)
+	assert.Equal(t, "ranked 2, above this slot", explanation.Rejected[1].Reason)
+}
+
+func TestExplainSlotRejectedFromRanking(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Resource:     &ResourceRequirement{Type: "room"},
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 10:00")),
+		},
+	}
+	rooms := []Resource{{ID: "huddle", Type: "room", Capacity: 4, Slots: []TimeSlot{utcSlot("2025-01-15 10:00", "2025-01-15 12:00")}}}
+	recommendations := slotsWithResources(t, event, rooms, 0)
+
+	// The window alice and bob share is long enough but has no room, so it was never ranked
+	explanation := explainedSlot(t, event, rooms, recommendations[0].Slot, &recommendations[0])
+	assert.Equal(t, 1, explanation.Rank)
+	assert.Len(t, explanation.Rejected, 1)
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), explanation.Rejected[0].Window)
+	assert.Equal(t, "no room is free for the meeting in this window", explanation.Rejected[0].Reason)
+}
+
+func TestExplainSlotBoundsRejected(t *testing.T) {
+	event := staircaseEvent(40)
+	slot := utcSlot("2025-01-19 09:00", "2025-01-19 10:00") // Nobody is free
+
+	explanation := explainedSlot(t, event, nil, slot, nil)
+	assert.Len(t, explanation.Rejected, maxRejectedWindows)
+	for i := 1; i < len(explanation.Rejected); i++ {
+		assert.GreaterOrEqual(t, len(explanation.Rejected[i-1].AvailableUsers), len(explanation.Rejected[i].AvailableUsers))
+	}
+	assert.Len(t, explanation.Rejected[0].AvailableUsers, 40)
+}
+
+func TestExplainSlotRankFromScores(t *testing.T) {
+	// Ranks counted from the scores agree with the order recommendations come in
+	event := largeEvent(50, 5)
+	recommendations := optimalSlots(t, event, 0)
+	for _, i := range []int{0, 1, len(recommendations) / 2, len(recommendations) - 1} {
+		explanation := explainedSlot(t, event, nil, recommendations[i].Slot, &recommendations[i])
+		assert.Equal(t, i+1, explanation.Rank)
+		assert.Equal(t, recommendations[i].Score, explanation.Score.Score)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := explainSlot(ctx, event, nil, recommendations[0].Slot, &recommendations[0])
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// explainedSlot runs explainSlot without a deadline
+func explainedSlot(t *testing.T, event Event, resources []Resource, slot TimeSlot, chosen *SlotRecommendation) Explanation {
+	t.Helper()
+	explanation, err := explainSlot(context.Background(), event, resources, slot, chosen)
+	assert.NoError(t, err)
+	return explanation
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Local times of day, in minutes, that are comfortable or merely tolerable to
+// meet at. Anything outside the tolerable range counts as antisocial.
+const (
+	comfortableFrom = 8 * 60
+	comfortableTo   = 18 * 60
+	tolerableFrom   = 7 * 60
+	tolerableTo     = 21 * 60
+)
+
+// fairnessWeight is how many attendees one point of weighted inconvenience is worth
+const fairnessWeight = 0.5
+
+type ParticipantInconvenience struct {
+	UserID                  string `json:"user_id"`
+	Occurrences             int    `json:"occurrences"`              // Scheduled occurrences the user could attend
+	InconvenientOccurrences int    `json:"inconvenient_occurrences"` // Of those, how many fell outside comfortable hours
+	Inconvenience           int    `json:"inconvenience"`            // 1 per early/late occurrence, 2 per antisocial one
+}
+
+// slotInconvenience rates a slot for someone in loc: 0 inside comfortable
+// hours, 1 when it runs early or late, 2 when it is antisocial
+func slotInconvenience(slot TimeSlot, loc *time.Location) int {
+	local := slot.Start_UTC.In(loc)
+	from := local.Hour()*60 + local.Minute()
+	to := from + int(slot.End_UTC.Sub(slot.Start_UTC).Minutes())
+
+	switch {
+	case from >= comfortableFrom && to <= comfortableTo:
+		return 0
+	case from >= tolerableFrom && to <= tolerableTo:
+		return 1
+	}
+	return 2
+}
+
+// userTimezones picks each user's timezone from the availability they submitted
+func userTimezones(event Event) map[string]*time.Location {
+	locations := make(map[string]*time.Location)
+	for _, user := range event.UserSlots {
+		for _, slot := range user.Slots {
+			if slot.TimeZone == "" {
+				continue
+			}
+			if loc, err := time.LoadLocation(slot.TimeZone); err == nil {
+				locations[user.UserID] = loc
+				break
+			}
+		}
+	}
+	return locations
+}
+
+// summariseInconvenience adds up, per participant, how inconvenient the
+// scheduled occurrences of a recurring meeting were
+func summariseInconvenience(occurrences []Event) []ParticipantInconvenience {
+	byUser := make(map[string]*ParticipantInconvenience)
+
+	for _, occurrence := range occurrences {
+		if occurrence.ScheduledSlot == nil {
+			continue
+		}
+		scheduled := *occurrence.ScheduledSlot
+		locations := userTimezones(occurrence)
+
+		for _, user := range occurrence.UserSlots {
+			summary, ok := byUser[user.UserID]
+			if !ok {
+				summary = &ParticipantInconvenience{UserID: user.UserID}
+				byUser[user.UserID] = summary
+			}
+
+			// Only occurrences the user was free for count against them
+			attended := slices.ContainsFunc(user.Slots, func(slot TimeSlot) bool {
+				return !slot.Start_UTC.After(scheduled.Start_UTC) && !slot.End_UTC.Before(scheduled.End_UTC)
+			})
+			loc, known := locations[user.UserID]
+			if !attended || !known {
+				continue
+			}
+
+			summary.Occurrences++
+			if level := slotInconvenience(scheduled, loc); level > 0 {
+				summary.InconvenientOccurrences++
+				summary.Inconvenience += level
+			}
+		}
+	}
+
+	summaries := make([]ParticipantInconvenience, 0, len(byUser))
+	for _, summary := range byUser {
+		summaries = append(summaries, *summary)
+	}
+	slices.SortFunc(summaries, func(a, b ParticipantInconvenience) int {
+		return cmp.Or(cmp.Compare(b.Inconvenience, a.Inconvenience), cmp.Compare(a.UserID, b.UserID))
+	})
+	return summaries
+}
+
+// fairnessScorer places each meeting at its least inconvenient start and
+// lowers its score by the attendees' inconvenience. Users who have already
+// taken more than their share of bad hours weigh heavier, so the burden rotates.
+type fairnessScorer struct {
+	locations    map[string]*time.Location
+	history      map[string]int
+	leastHistory int
+}
+
+func newFairnessScorer(event Event) Scorer {
+	scorer := fairnessScorer{
+		locations: userTimezones(event),
+		history:   event.inconvenienceHistory,
+	}
+
+	// Only inconvenience above the least burdened user matters
+	scorer.leastHistory = -1
+	for _, user := range event.UserSlots {
+		if scorer.leastHistory == -1 || scorer.history[user.UserID] < scorer.leastHistory {
+			scorer.leastHistory = scorer.history[user.UserID]
+		}
+	}
+	return scorer
+}
+
+func (s fairnessScorer) ScoresPlacement() bool { return true }
+
+func (s fairnessScorer) Score(candidate *Candidate) float64 {
+	penalty := 0.0
+	for _, user := range candidate.AvailableUsers() {
+		if loc, ok := s.locations[user]; ok {
+			weight := 1 + s.history[user] - s.leastHistory
+			penalty += float64(slotInconvenience(candidate.Slot, loc) * weight)
+		}
+	}
+	return float64(candidate.AvailableCount) - fairnessWeight*penalty
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func zonedAvailability(userID, timezone string, slots ...TimeSlot) UserAvailability {
+	for i := range slots {
+		slots[i].TimeZone = timezone
+	}
+	return UserAvailability{UserID: userID, Slots: slots}
+}
+
+func TestSlotInconvenience(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	newYork, _ := time.LoadLocation("America/New_York")
+
+	// 14:00-15:00 UTC is 09:00 in New York and 23:00 in Tokyo
+	slot := utcSlot("2025-01-15 14:00", "2025-01-15 15:00")
+	assert.Equal(t, 0, slotInconvenience(slot, newYork))
+	assert.Equal(t, 2, slotInconvenience(slot, tokyo))
+
+	// 12:00-13:00 UTC is 07:00 in New York
+	assert.Equal(t, 1, slotInconvenience(utcSlot("2025-01-15 12:00", "2025-01-15 13:00"), newYork))
+}
+
+func TestFairnessRotatesInconvenience(t *testing.T) {
+	event := Event{
+		ID:           "sync-3",
+		DurationMins: 60,
+		RecurringID:  "weekly-sync",
+		Slots:        []TimeSlot{utcSlot("2025-01-15 00:00", "2025-01-16 00:00")},
+		UserSlots: []UserAvailability{
+			// 12:00 UTC is early for maria, 20:00 UTC is late for oliver
+			zonedAvailability("maria", "America/New_York",
+				utcSlot("2025-01-15 12:00", "2025-01-15 13:00"),
+				utcSlot("2025-01-15 20:00", "2025-01-15 21:00"),
+			),
+			zonedAvailability("oliver", "Europe/London",
+				utcSlot("2025-01-15 12:00", "2025-01-15 13:00"),
+				utcSlot("2025-01-15 20:00", "2025-01-15 21:00"),
+			),
+		},
+	}
+
+	// Without history both are equally inconvenient and the earlier one wins
+	first := optimalSlots(t, event, 1)[0]
+	assert.Equal(t, utcSlot("2025-01-15 12:00", "2025-01-15 13:00"), first.Slot)
+	assert.Equal(t, 1.5, first.Score)
+
+	// Earlier occurrences were all early for maria, so her burden now weighs more
+	occurrences := []Event{}
+	for _, day := range []string{"2025-01-01", "2025-01-08"} {
+		scheduled := utcSlot(day+" 12:00", day+" 13:00")
+		occurrences = append(occurrences, Event{
+			ScheduledSlot: &scheduled,
+			UserSlots: []UserAvailability{
+				zonedAvailability("maria", "America/New_York", utcSlot(day+" 12:00", day+" 13:00")),
+				zonedAvailability("oliver", "Europe/London", utcSlot(day+" 12:00", day+" 13:00")),
+			},
+		})
+	}
+
+	summary := summariseInconvenience(occurrences)
+	assert.Equal(t, ParticipantInconvenience{UserID: "maria", Occurrences: 2, InconvenientOccurrences: 2, Inconvenience: 2}, summary[0])
+	assert.Equal(t, ParticipantInconvenience{UserID: "oliver", Occurrences: 2}, summary[1])
+
+	event.inconvenienceHistory = map[string]int{"maria": 2}
+	second := optimalSlots(t, event, 1)[0]
+	assert.Equal(t, utcSlot("2025-01-15 20:00", "2025-01-15 21:00"), second.Slot)
+}
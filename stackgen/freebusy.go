@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxICSUpload caps the size of an uploaded calendar
+const maxICSUpload = 5 << 20
+
+// icsTimeZone picks the zone for floating and all-day times: the requested
+// one, else the calendar's X-WR-TIMEZONE, else UTC
+func icsTimeZone(root *icsComponent, requested string) (*time.Location, error) {
+	name := requested
+	if name == "" {
+		for _, vcalendar := range root.find("VCALENDAR") {
+			if prop, ok := vcalendar.property("X-WR-TIMEZONE"); ok {
+				name = prop.Value
+				break
+			}
+		}
+	}
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone: %s", name)
+	}
+	return loc, nil
+}
+
+// icsBusyRuns collects the busy time of a calendar that overlaps [from, to):
+// opaque VEVENTs, with RRULE/RDATE expanded and EXDATE and moved instances
+// removed, and the busy periods of VFREEBUSY blocks. The result is merged.
+func icsBusyRuns(root *icsComponent, loc *time.Location, from, to time.Time) ([]freeRun, error) {
+	busy := []freeRun{}
+	add := func(start, end time.Time) {
+		if start.Before(to) && end.After(from) && start.Before(end) {
+			busy = append(busy, freeRun{start: start.UnixNano(), end: end.UnixNano()})
+		}
+	}
+
+	vevents := root.find("VEVENT")
+
+	// Instances moved or cancelled by a RECURRENCE-ID override are dropped from their series
+	moved := make(map[string]map[int64]bool)
+	for _, vevent := range vevents {
+		prop, ok := vevent.property("RECURRENCE-ID")
+		if !ok {
+			continue
+		}
+		at, _, err := parseICSTime(prop, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RECURRENCE-ID: %s", prop.Value)
+		}
+		uid, _ := vevent.property("UID")
+		if moved[uid.Value] == nil {
+			moved[uid.Value] = make(map[int64]bool)
+		}
+		moved[uid.Value][at.Unix()] = true
+	}
+
+	for _, vevent := range vevents {
+		if status, _ := vevent.property("STATUS"); strings.EqualFold(status.Value, "CANCELLED") {
+			continue
+		}
+		if transp, _ := vevent.property("TRANSP"); strings.EqualFold(transp.Value, "TRANSPARENT") {
+			continue
+		}
+
+		dtstart, ok := vevent.property("DTSTART")
+		if !ok {
+			return nil, fmt.Errorf("VEVENT without DTSTART")
+		}
+		start, allDay, err := parseICSTime(dtstart, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DTSTART: %s", dtstart.Value)
+		}
+
+		var length time.Duration
+		if dtend, ok := vevent.property("DTEND"); ok {
+			end, _, err := parseICSTime(dtend, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DTEND: %s", dtend.Value)
+			}
+			length = end.Sub(start)
+		} else if duration, ok := vevent.property("DURATION"); ok {
+			if length, err = parseICSDuration(duration.Value); err != nil {
+				return nil, err
+			}
+		} else if allDay {
+			length = 24 * time.Hour
+		}
+
+		uid, _ := vevent.property("UID")
+		_, override := vevent.property("RECURRENCE-ID")
+
+		starts := []time.Time{start}
+		if !override {
+			if rrule, ok := vevent.property("RRULE"); ok {
+				rule, err := parseRRule(rrule.Value, start.Location())
+				if err != nil {
+					return nil, err
+				}
+				starts = rule.occurrences(start, to)
+			}
+			for _, rdate := range vevent.properties("RDATE") {
+				times, err := parseICSTimeList(rdate, loc)
+				if err != nil {
+					return nil, err
+				}
+				starts = append(starts, times...)
+			}
+		}
+
+		excluded := make(map[int64]bool)
+		for _, exdate := range vevent.properties("EXDATE") {
+			times, err := parseICSTimeList(exdate, loc)
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range times {
+				excluded[t.Unix()] = true
+			}
+		}
+		for _, at := range starts {
+			if excluded[at.Unix()] || (!override && moved[uid.Value][at.Unix()]) {
+				continue
+			}
+			add(at, at.Add(length))
+		}
+	}
+
+	for _, vfreebusy := range root.find("VFREEBUSY") {
+		for _, prop := range vfreebusy.properties("FREEBUSY") {
+			if strings.EqualFold(prop.Params["FBTYPE"], "FREE") {
+				continue
+			}
+			for _, period := range strings.Split(prop.Value, ",") {
+				startValue, endValue, ok := strings.Cut(strings.TrimSpace(period), "/")
+				if !ok {
+					return nil, fmt.Errorf("invalid FREEBUSY period: %s", period)
+				}
+				start, _, err := parseICSTime(icsProperty{Value: startValue}, loc)
+				if err != nil {
+					return nil, fmt.Errorf("invalid FREEBUSY period: %s", period)
+				}
+				var end time.Time
+				if strings.HasPrefix(strings.TrimLeft(endValue, "+-"), "P") {
+					length, err := parseICSDuration(endValue)
+					if err != nil {
+						return nil, err
+					}
+					end = start.Add(length)
+				} else if end, _, err = parseICSTime(icsProperty{Value: endValue}, loc); err != nil {
+					return nil, fmt.Errorf("invalid FREEBUSY period: %s", period)
+				}
+				add(start, end)
+			}
+		}
+	}
+
+	return mergeRuns(busy), nil
+}
+
+// parseICSTimeList parses a comma separated EXDATE or RDATE value
+func parseICSTimeList(prop icsProperty, loc *time.Location) ([]time.Time, error) {
+	times := []time.Time{}
+	for _, value := range strings.Split(prop.Value, ",") {
+		single := prop
+		single.Value = value
+		t, _, err := parseICSTime(single, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", prop.Name, value)
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+// availabilityFromICS turns a calendar into a user's availability: the
+// event's slots minus everything the calendar marks as busy
+func availabilityFromICS(event Event, userID string, r io.Reader, timezone string) (UserAvailability, error) {
+	root, err := parseICS(r)
+	if err != nil {
+		return UserAvailability{}, err
+	}
+	if len(root.find("VCALENDAR")) == 0 {
+		return UserAvailability{}, fmt.Errorf("no VCALENDAR found")
+	}
+	loc, err := icsTimeZone(root, timezone)
+	if err != nil {
+		return UserAvailability{}, err
+	}
+
+	eventWindows := mergeRuns(slotsToRuns(event.Slots))
+	if len(eventWindows) == 0 {
+		return UserAvailability{}, fmt.Errorf("event has no slots to import availability into")
+	}
+	from, to := nanosToTime(eventWindows[0].start), nanosToTime(eventWindows[len(eventWindows)-1].end)
+
+	busy, err := icsBusyRuns(root, loc, from, to)
+	if err != nil {
+		return UserAvailability{}, err
+	}
+
+	return availabilityFromBusy(event, userID, busy, loc), nil
+}
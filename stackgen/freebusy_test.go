@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+X-WR-TIMEZONE:Europe/London
+BEGIN:VEVENT
+UID:standup
+DTSTART:20250113T100000Z
+DTEND:20250113T103000Z
+RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+EXDATE:20250115T100000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:standup
+RECURRENCE-ID:20250116T100000Z
+DTSTART:20250116T140000Z
+DURATION:PT30M
+END:VEVENT
+BEGIN:VEVENT
+UID:focus
+DTSTART:20250114T120000Z
+DTEND:20250114T160000Z
+TRANSP:TRANSPARENT
+END:VEVENT
+BEGIN:VEVENT
+UID:offsite
+DTSTART:20250114T130000Z
+DTEND:20250114T150000Z
+STATUS:CANCELLED
+END:VEVENT
+BEGIN:VEVENT
+UID:lunch
+DTSTART:20250113T120000
+DTEND:20250113T130000
+END:VEVENT
+END:VCALENDAR
+BEGIN:VCALENDAR
+BEGIN:VFREEBUSY
+FREEBUSY;FBTYPE=BUSY-UNAVAILABLE:20250114T150000Z/PT1H,20250115T090000Z/20250115T093000Z
+FREEBUSY;FBTYPE=FREE:20250115T120000Z/20250115T130000Z
+END:VFREEBUSY
+END:VCALENDAR
+`
+
+func TestAvailabilityFromICS(t *testing.T) {
+	event := Event{
+		Slots: []TimeSlot{
+			utcSlot("2025-01-13 09:00", "2025-01-13 17:00"),
+			utcSlot("2025-01-14 09:00", "2025-01-14 17:00"),
+			utcSlot("2025-01-15 09:00", "2025-01-15 17:00"),
+			utcSlot("2025-01-16 09:00", "2025-01-16 17:00"),
+		},
+	}
+
+	availability, err := availabilityFromICS(event, "alice", strings.NewReader(testCalendar), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", availability.UserID)
+
+	slots := []TimeSlot{}
+	for _, slot := range availability.Slots {
+		assert.Equal(t, "Europe/London", slot.TimeZone)
+		slots = append(slots, TimeSlot{Start_UTC: slot.Start_UTC, End_UTC: slot.End_UTC})
+	}
+	assert.Equal(t, []TimeSlot{
+		// Monday: standup and lunch (floating, read in the calendar's zone)
+		utcSlot("2025-01-13 09:00", "2025-01-13 10:00"),
+		utcSlot("2025-01-13 10:30", "2025-01-13 12:00"),
+		utcSlot("2025-01-13 13:00", "2025-01-13 17:00"),
+		// Tuesday: standup and a free/busy block; focus time and the cancelled offsite don't count
+		utcSlot("2025-01-14 09:00", "2025-01-14 10:00"),
+		utcSlot("2025-01-14 10:30", "2025-01-14 15:00"),
+		utcSlot("2025-01-14 16:00", "2025-01-14 17:00"),
+		// Wednesday: no standup (EXDATE), busy first thing
+		utcSlot("2025-01-15 09:30", "2025-01-15 17:00"),
+		// Thursday: standup moved to the afternoon
+		utcSlot("2025-01-16 09:00", "2025-01-16 14:00"),
+		utcSlot("2025-01-16 14:30", "2025-01-16 17:00"),
+	}, slots)
+	assert.Equal(t, "13 Jan 2025, 9:00AM", availability.Slots[0].StartStr)
+}
+
+func TestAvailabilityFromICSErrors(t *testing.T) {
+	event := Event{Slots: []TimeSlot{utcSlot("2025-01-13 09:00", "2025-01-13 17:00")}}
+
+	for name, body := range map[string]string{
+		"NotACalendar": "hello",
+		"Unbalanced":   "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR\n",
+		"NoStart":      "BEGIN:VCALENDAR\nBEGIN:VEVENT\nUID:x\nEND:VEVENT\nEND:VCALENDAR\n",
+		"BadRule":      "BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:20250113T100000Z\nRRULE:FREQ=SECONDLY\nEND:VEVENT\nEND:VCALENDAR\n",
+	} {
+		_, err := availabilityFromICS(event, "alice", strings.NewReader(body), "")
+		assert.Error(t, err, name)
+	}
+
+	_, err := availabilityFromICS(event, "alice", strings.NewReader("BEGIN:VCALENDAR\nEND:VCALENDAR\n"), "Mars/Olympus")
+	assert.Error(t, err)
+
+	// Nothing busy leaves the event's slots
+	availability, err := availabilityFromICS(event, "alice", strings.NewReader("BEGIN:VCALENDAR\nEND:VCALENDAR\n"), "")
+	assert.NoError(t, err)
+	assert.Len(t, availability.Slots, 1)
+	assert.Equal(t, "UTC", availability.Slots[0].TimeZone)
+}
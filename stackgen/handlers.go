@@ -3,7 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -25,6 +31,16 @@ func sendResponse(w http.ResponseWriter, statusCode int, success bool, message s
 	json.NewEncoder(w).Encode(response)
 }
 
+// sendSearchError answers a failed slot search: unavailable when it ran out
+// of time, a database error otherwise
+func sendSearchError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		sendResponse(w, http.StatusServiceUnavailable, false, "Slot search did not finish in time; try a shorter range or fewer participants", nil)
+		return
+	}
+	sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+}
+
 // handleEvent handles both creation (POST) and updates (PUT) of events
 func handleEvent(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
@@ -37,6 +53,19 @@ func handleEvent(w http.ResponseWriter, r *http.Request) {
 	}
 	event.ID = id
 
+	if err := validateEvent(event); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	event.Invitees = normalizeInvitees(event.Invitees)
+
+	// Flexible events are recommended at their shortest length unless told otherwise
+	if event.DurationMins == 0 && hasFlexibleDuration(event) {
+		event.DurationMins = shortestDuration(event)
+	}
+
+	givenUserSlots := event.UserSlots != nil
 	if event.UserSlots == nil {
 		event.UserSlots = []UserAvailability{}
 	}
@@ -57,10 +86,66 @@ func handleEvent(w http.ResponseWriter, r *http.Request) {
 		sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
 		return
 	}
+	if exists {
+		if status, err := organizerFor(r, existingEvent); err != nil {
+			sendResponse(w, status, false, err.Error(), nil)
+			return
+		}
+	}
+
+	// The status only moves through the lifecycle endpoints, and locked events stay as they are
+	current := StatusDraft
+	if exists {
+		current = eventStatus(existingEvent)
+	}
+	if event.Status != "" && event.Status != current {
+		sendResponse(w, http.StatusBadRequest, false, "status can only be changed with /open, /confirm, /reopen and /cancel", nil)
+		return
+	}
+	if current == StatusConfirmed || current == StatusCancelled {
+		sendResponse(w, http.StatusConflict, false, "Event is "+current+"; reopen it to make changes", nil)
+		return
+	}
+	event.Status = current
+	// Only changed through their endpoints, so an update keeps what is stored;
+	// the scheduled time only by /confirm
+	event.RSVPs, event.Invites, event.RejectedSlots = existingEvent.RSVPs, existingEvent.Invites, existingEvent.RejectedSlots
+	event.ScheduledSlot, event.ConfirmedAt, event.Booked = existingEvent.ScheduledSlot, existingEvent.ConfirmedAt, existingEvent.Booked
+	event.Sequence = existingEvent.Sequence
+
+	// Once invites are out, availability only comes in with a participant's token
+	if exists && inviteOnly(existingEvent) {
+		if givenUserSlots {
+			sendResponse(w, http.StatusBadRequest, false, "user_slots can only be changed with invite tokens on this event", nil)
+			return
+		}
+		if existingEvent.UserSlots != nil {
+			event.UserSlots = existingEvent.UserSlots
+		}
+	}
+
+	// A new event gets its organizer key; updates keep the stored hash
+	organizerKey := ""
+	if exists {
+		event.OrganizerKeyHash = existingEvent.OrganizerKeyHash
+	} else {
+		organizerKey, event.OrganizerKeyHash = newOrganizerKey()
+	}
 
-	// Simple upsert operation
-	opts := options.Update().SetUpsert(true)
-	_, err = eventsCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": event}, opts)
+	// The whole document is replaced, so a field left out of the body is
+	// cleared rather than kept from before. Recorded in the outbox with the
+	// change it makes.
+	webhookType := WebhookEventCreated
+	var before *Event
+	if exists {
+		webhookType = WebhookEventUpdated
+		before = &existingEvent
+	}
+	err = saveEventChange(ctx, webhookType, before, event, "", event, func(ctx context.Context) error {
+		opts := options.Replace().SetUpsert(true)
+		_, err := eventsCollection.ReplaceOne(ctx, bson.M{"_id": id}, event, opts)
+		return err
+	})
 	if err != nil {
 		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
 		return
@@ -73,12 +158,20 @@ func handleEvent(w http.ResponseWriter, r *http.Request) {
 		statusCode = http.StatusOK
 	}
 
-	data := event
+	var data interface{} = event
+	if !exists {
+		data = CreatedEvent{Event: event, OrganizerKey: organizerKey}
+	}
 	sendResponse(w, statusCode, true, message, data)
 }
 
 // getEvent retrieves an event by ID
 func getEvent(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.Header.Get("Accept"), "text/calendar") {
+		getEventICS(w, r)
+		return
+	}
+
 	params := mux.Vars(r)
 	id := params["id"]
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -93,7 +186,7 @@ func getEvent(w http.ResponseWriter, r *http.Request) {
 		}
 		return
 	}
-	sendResponse(w, http.StatusOK, true, "Event retrieved successfully", event)
+	sendResponse(w, http.StatusOK, true, "Event retrieved successfully", eventDetails(event))
 }
 
 // deleteEvent removes an event by ID
@@ -102,13 +195,35 @@ func deleteEvent(w http.ResponseWriter, r *http.Request) {
 	id := params["id"]
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	result, err := eventsCollection.DeleteOne(ctx, bson.M{"_id": id})
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
 	if err != nil {
-		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
 		return
 	}
-	if result.DeletedCount == 0 {
-		sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	err = saveEventChange(ctx, WebhookEventDeleted, nil, Event{ID: id}, "", nil, func(ctx context.Context) error {
+		result, err := eventsCollection.DeleteOne(ctx, bson.M{"_id": id})
+		if err == nil && result.DeletedCount == 0 {
+			err = mongo.ErrNoDocuments
+		}
+		return err
+	})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
 		return
 	}
 	sendResponse(w, http.StatusOK, true, "Event deleted successfully", nil)
@@ -134,12 +249,29 @@ func handleUserAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := acceptsAvailability(event); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	var status int
+	if userID, status, err = participantFor(r, event, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
 	var userAvail UserAvailability
 	if err := json.NewDecoder(r.Body).Decode(&userAvail); err != nil {
 		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
 		return
 	}
 	userAvail.UserID = userID
+	if err := validateRegion(userAvail.Region); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	before := snapshotEvent(event)
 
 	// Find if user already exists and determine operation type
 	userExists := false
@@ -171,7 +303,11 @@ func handleUserAvailability(w http.ResponseWriter, r *http.Request) {
 		event.UserSlots = append(event.UserSlots, userAvail)
 	}
 
-	_, err = eventsCollection.ReplaceOne(ctx, bson.M{"_id": id}, event)
+	webhookType := WebhookAvailabilityUpdated
+	if !userExists {
+		webhookType = WebhookAvailabilityAdded
+	}
+	err = saveEventChange(ctx, webhookType, &before, event, userID, userAvail, replaceEvent(event))
 	if err != nil {
 		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
 		return
@@ -188,6 +324,162 @@ func handleUserAvailability(w http.ResponseWriter, r *http.Request) {
 	sendResponse(w, statusCode, true, message, userAvail)
 }
 
+// importUserAvailabilityICS replaces a user's availability with the free time
+// an uploaded iCalendar file leaves inside the event's slots
+func importUserAvailabilityICS(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if err := acceptsAvailability(event); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	var status int
+	if userID, status, err = participantFor(r, event, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxICSUpload)
+	userAvail, err := availabilityFromICS(event, userID, body, r.URL.Query().Get("timezone"))
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid calendar: "+err.Error(), nil)
+		return
+	}
+
+	userExists, err := replaceUserSlots(ctx, &event, &userAvail)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	if userExists {
+		sendResponse(w, http.StatusOK, true, "User availability updated from calendar", userAvail)
+	} else {
+		sendResponse(w, http.StatusCreated, true, "User availability added from calendar", userAvail)
+	}
+}
+
+// syncUserAvailability refreshes a user's availability from the calendar account they connected
+func syncUserAvailability(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	loc := time.UTC
+	if timezone := r.URL.Query().Get("timezone"); timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			sendResponse(w, http.StatusBadRequest, false, "invalid timezone: "+timezone, nil)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if err := acceptsAvailability(event); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	// A stored calendar is only read for its owner, so sync always needs their token
+	if requestToken(r) == "" {
+		sendResponse(w, http.StatusUnauthorized, false, "calendar sync needs an invite token", nil)
+		return
+	}
+	var status int
+	if userID, status, err = participantFor(r, event, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	var account CalendarAccount
+	err = calendarAccountsCollection.FindOne(ctx, bson.M{"_id": calendarAccountID(event.ID, userID)}).Decode(&account)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Calendar account not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+	if account.Password, err = openCredential(account.Password); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, err.Error(), nil)
+		return
+	}
+
+	userAvail, err := syncAvailability(ctx, event, account, loc)
+	if err != nil {
+		sendResponse(w, http.StatusBadGateway, false, "Calendar sync failed: "+err.Error(), nil)
+		return
+	}
+
+	userExists, err := replaceUserSlots(ctx, &event, &userAvail)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	if userExists {
+		sendResponse(w, http.StatusOK, true, "User availability synced from calendar", userAvail)
+	} else {
+		sendResponse(w, http.StatusCreated, true, "User availability added from calendar", userAvail)
+	}
+}
+
+// replaceUserSlots stores imported availability for a user, replacing their
+// slots but keeping the rest of an existing entry, and reports whether there was one
+func replaceUserSlots(ctx context.Context, event *Event, userAvail *UserAvailability) (bool, error) {
+	before := snapshotEvent(*event)
+	userExists := false
+	for i, ua := range event.UserSlots {
+		if ua.UserID == userAvail.UserID {
+			userExists = true
+			userAvail.Region = ua.Region
+			event.UserSlots[i] = *userAvail
+			break
+		}
+	}
+	if !userExists {
+		event.UserSlots = append(event.UserSlots, *userAvail)
+	}
+
+	webhookType := WebhookAvailabilityUpdated
+	if !userExists {
+		webhookType = WebhookAvailabilityAdded
+	}
+	err := saveEventChange(ctx, webhookType, &before, *event, userAvail.UserID, *userAvail, replaceEvent(*event))
+	return userExists, err
+}
+
 func deleteUserAvailability(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
@@ -205,6 +497,17 @@ func deleteUserAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := acceptsAvailability(event); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	var status int
+	if userID, status, err = participantFor(r, event, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
 	found := false
 	newUserSlots := []UserAvailability{}
 	for _, ua := range event.UserSlots {
@@ -219,8 +522,9 @@ func deleteUserAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := snapshotEvent(event)
 	event.UserSlots = newUserSlots
-	_, err = eventsCollection.ReplaceOne(ctx, bson.M{"_id": id}, event)
+	err = saveEventChange(ctx, WebhookAvailabilityDeleted, &before, event, userID, nil, replaceEvent(event))
 	if err != nil {
 		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
 		return
@@ -251,11 +555,1724 @@ func getRecommendations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	recommendations := findOptimalSlots(event)
+	// Query parameter overrides the quorum stored on the event
+	if value := r.URL.Query().Get("min_attendees"); value != "" {
+		threshold, err := parseAttendeeThreshold(value)
+		if err != nil {
+			sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		event.MinAttendees = &threshold
+	}
+
+	if strategy := r.URL.Query().Get("strategy"); strategy != "" {
+		if err := validateStrategy(strategy); err != nil {
+			sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		event.Strategy = strategy
+	}
+
+	event.now = clock()
+	if err := loadInconvenienceHistory(ctx, &event); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	if event.Series != nil {
+		getSeriesRecommendations(ctx, w, event, timezone)
+		return
+	}
+
+	recommendations, err := recommendSlots(ctx, event, 1)
+	if err != nil {
+		sendSearchError(w, err)
+		return
+	}
+	pruned, err := tooSoonCandidates(ctx, event)
+	if err != nil {
+		sendSearchError(w, err)
+		return
+	}
+	if len(recommendations) == 0 {
+		message := "No slots satisfy the event constraints"
+		if pruned > 0 {
+			message = fmt.Sprintf("%s (%d candidate starts were too soon)", message, pruned)
+		}
+		sendResponse(w, http.StatusOK, true, message, nil)
+		return
+	}
+
+	recommendation := RecommendationResult{SlotRecommendation: recommendations[0], PrunedTooSoon: pruned}
+	setDisplayTimes(&recommendation.Slot, timezone)
+	setDisplayTimes(&recommendation.Window, timezone)
+
+	sendResponse(w, http.StatusOK, true, "Recommendations retrieved successfully", recommendation)
+}
+
+// recommendSlots ranks an event's slots, booking resources when the event needs one
+func recommendSlots(ctx context.Context, event Event, limit int) ([]SlotRecommendation, error) {
+	var resources []Resource
+	if event.Resource != nil {
+		var err error
+		if resources, err = findBookableResources(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+	return rankSlots(ctx, event, resources, limit)
+}
+
+// rankSlots ranks an event's slots against resources already loaded for it
+func rankSlots(ctx context.Context, event Event, resources []Resource, limit int) ([]SlotRecommendation, error) {
+	if event.Resource == nil {
+		return findOptimalSlots(ctx, event, limit)
+	}
+	return findSlotsWithResources(ctx, event, resources, limit)
+}
+
+// findBookableResources loads the resources an event can use, without the
+// time other confirmed events have booked them for
+func findBookableResources(ctx context.Context, event Event) ([]Resource, error) {
+	resources, err := findResources(ctx, event.Resource.Type)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		ids = append(ids, resource.ID)
+	}
+
+	filter := bson.M{"_id": bson.M{"$ne": event.ID}, "status": StatusConfirmed, "assigned_resource.id": bson.M{"$in": ids}}
+	cursor, err := eventsCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	confirmed := []Event{}
+	if err := cursor.All(ctx, &confirmed); err != nil {
+		return nil, err
+	}
+	return withoutBookings(resources, confirmed), nil
+}
+
+// getRecommendationExplanation explains the top recommendation, or the slot starting at ?start=
+func getRecommendationExplanation(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	timezone := r.URL.Query().Get("timezone")
+
+	if timezone == "" {
+		timezone = "UTC" // Default timezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "invalid timezone: "+timezone, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err = eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if value := r.URL.Query().Get("min_attendees"); value != "" {
+		threshold, err := parseAttendeeThreshold(value)
+		if err != nil {
+			sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		event.MinAttendees = &threshold
+	}
+
+	if strategy := r.URL.Query().Get("strategy"); strategy != "" {
+		if err := validateStrategy(strategy); err != nil {
+			sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		event.Strategy = strategy
+	}
+
+	event.now = clock()
+	if err := loadInconvenienceHistory(ctx, &event); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	var resources []Resource
+	if event.Resource != nil {
+		if resources, err = findBookableResources(ctx, event); err != nil {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+			return
+		}
+	}
 
-		slot := &recommendations[0].Slot
-		slot.StartStr = formatTimeForDisplay(slot.Start_UTC, timezone)
-		slot.EndStr = formatTimeForDisplay(slot.End_UTC, timezone)
+	var slot TimeSlot
+	var chosen *SlotRecommendation
+	if value := r.URL.Query().Get("recommendation_id"); value != "" {
+		rec, ok, err := findRecommendationByID(ctx, event, resources, value)
+		if err != nil {
+			sendSearchError(w, err)
+			return
+		}
+		if !ok {
+			sendResponse(w, http.StatusNotFound, false, "Recommendation not found", nil)
+			return
+		}
+		slot, chosen = rec.Slot, &rec
+	} else if value := r.URL.Query().Get("start"); value != "" {
+		start, err := parseTimeInLocation(value, loc)
+		if err != nil {
+			sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+			return
+		}
+		slot = TimeSlot{
+			Start_UTC: start.UTC(),
+			End_UTC:   start.UTC().Add(time.Duration(event.DurationMins) * time.Minute),
+		}
+	} else {
+		recommendations, err := rankSlots(ctx, event, resources, 1)
+		if err != nil {
+			sendSearchError(w, err)
+			return
+		}
+		if len(recommendations) == 0 {
+			sendResponse(w, http.StatusOK, true, "No slots satisfy the event constraints", nil)
+			return
+		}
+		slot, chosen = recommendations[0].Slot, &recommendations[0]
+	}
 
-	sendResponse(w, http.StatusOK, true, "Recommendations retrieved successfully", recommendations[0])
+	explanation, err := explainSlot(ctx, event, resources, slot, chosen)
+	if err != nil {
+		sendSearchError(w, err)
+		return
+	}
+	setDisplayTimes(&explanation.Slot, timezone)
+	for i := range explanation.Rejected {
+		setDisplayTimes(&explanation.Rejected[i].Window, timezone)
+	}
+
+	sendResponse(w, http.StatusOK, true, "Recommendation explained successfully", explanation)
+}
+
+// getHeatmap returns a When2meet-style grid of who is free in each bucket, as JSON or CSV
+func getHeatmap(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	timezone := r.URL.Query().Get("timezone")
+
+	if timezone == "" {
+		timezone = "UTC" // Default timezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "invalid timezone: "+timezone, nil)
+		return
+	}
+	bucket, err := parseHeatmapBucket(r.URL.Query().Get("bucket"))
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err = eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	heatmap, err := buildHeatmap(event, bucket, loc)
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	for i := range heatmap.Buckets {
+		setDisplayTimes(&heatmap.Buckets[i].Slot, timezone)
+	}
+
+	if r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+id+`-heatmap.csv"`)
+		w.WriteHeader(http.StatusOK)
+		writeHeatmapCSV(w, heatmap)
+		return
+	}
+
+	sendResponse(w, http.StatusOK, true, "Heatmap retrieved successfully", heatmap)
+}
+
+// getFreeWindows returns the raw intersections of everyone's, or the users= subset's, availability
+func getFreeWindows(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	timezone := r.URL.Query().Get("timezone")
+
+	if timezone == "" {
+		timezone = "UTC" // Default timezone
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	windows, err := commonFreeWindows(event, parseUserList(r.URL.Query().Get("users")))
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	for i := range windows {
+		setDisplayTimes(&windows[i].Slot, timezone)
+	}
+
+	sendResponse(w, http.StatusOK, true, "Free windows retrieved successfully", windows)
+}
+
+// getFairness reports cumulative inconvenience per participant across a recurring meeting
+func getFairness(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+	if event.RecurringID == "" {
+		sendResponse(w, http.StatusBadRequest, false, "Event is not part of a recurring meeting", nil)
+		return
+	}
+
+	occurrences, err := findScheduledOccurrences(ctx, event.RecurringID, "")
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Fairness retrieved successfully", summariseInconvenience(occurrences))
+}
+
+// findScheduledOccurrences loads the scheduled occurrences of a recurring meeting, except excludeID
+func findScheduledOccurrences(ctx context.Context, recurringID, excludeID string) ([]Event, error) {
+	filter := bson.M{
+		"recurring_id":   recurringID,
+		"scheduled_slot": bson.M{"$exists": true},
+		"status":         bson.M{"$ne": StatusCancelled},
+	}
+	if excludeID != "" {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+	cursor, err := eventsCollection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var occurrences []Event
+	err = cursor.All(ctx, &occurrences)
+	return occurrences, err
+}
+
+// loadInconvenienceHistory attaches earlier occurrences' inconvenience to a recurring event before scheduling
+func loadInconvenienceHistory(ctx context.Context, event *Event) error {
+	if event.RecurringID == "" {
+		return nil
+	}
+	occurrences, err := findScheduledOccurrences(ctx, event.RecurringID, event.ID)
+	if err != nil {
+		return err
+	}
+	event.inconvenienceHistory = make(map[string]int)
+	for _, summary := range summariseInconvenience(occurrences) {
+		event.inconvenienceHistory[summary.UserID] = summary.Inconvenience
+	}
+	return nil
+}
+
+// getDurationOptions reports the longest meeting everyone can make and the
+// trade-offs between meeting length and attendance
+func getDurationOptions(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	timezone := r.URL.Query().Get("timezone")
+
+	if timezone == "" {
+		timezone = "UTC" // Default timezone
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	event.now = clock()
+
+	// Events with a single length still get the attendance side of the trade-off
+	if !hasFlexibleDuration(event) {
+		event.DurationsMins = []int{event.DurationMins}
+	}
+
+	options, err := findDurationTradeoffs(ctx, event)
+	if err != nil {
+		sendSearchError(w, err)
+		return
+	}
+	for i := range options.Tradeoffs {
+		setDisplayTimes(&options.Tradeoffs[i].Recommendation.Slot, timezone)
+		setDisplayTimes(&options.Tradeoffs[i].Recommendation.Window, timezone)
+	}
+
+	sendResponse(w, http.StatusOK, true, "Duration options retrieved successfully", options)
+}
+
+// getSeriesRecommendations responds with ranked alternative session sets for a series event
+func getSeriesRecommendations(ctx context.Context, w http.ResponseWriter, event Event, timezone string) {
+	seriesRecommendations, err := findSeriesSlots(ctx, event)
+	if err != nil {
+		sendResponse(w, http.StatusServiceUnavailable, false, "Series search did not finish in time; try fewer sessions or a shorter range", nil)
+		return
+	}
+	if len(seriesRecommendations) == 0 {
+		sendResponse(w, http.StatusOK, true, "No session set satisfies the series constraints", nil)
+		return
+	}
+
+	for i := range seriesRecommendations {
+		for j := range seriesRecommendations[i].Sessions {
+			session := &seriesRecommendations[i].Sessions[j]
+			setDisplayTimes(&session.Slot, timezone)
+			setDisplayTimes(&session.Window, timezone)
+		}
+	}
+
+	sendResponse(w, http.StatusOK, true, "Series recommendations retrieved successfully", seriesRecommendations)
+}
+
+// setDisplayTimes fills the human readable start/end of a computed slot
+func setDisplayTimes(slot *TimeSlot, timezone string) {
+	slot.StartStr = formatTimeForDisplay(slot.Start_UTC, timezone)
+	slot.EndStr = formatTimeForDisplay(slot.End_UTC, timezone)
+}
+
+// handleBatchSchedule jointly schedules several events that share attendees
+func handleBatchSchedule(w http.ResponseWriter, r *http.Request) {
+	timezone := r.URL.Query().Get("timezone")
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	var request BatchScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	if len(request.EventIDs) == 0 {
+		sendResponse(w, http.StatusBadRequest, false, "event_ids cannot be empty", nil)
+		return
+	}
+	if request.TimeBudgetMs < 0 {
+		sendResponse(w, http.StatusBadRequest, false, "time_budget_ms cannot be negative", nil)
+		return
+	}
+
+	if err := validateBatchWeights(request.Weights); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	budget := defaultBatchTimeBudget
+	if request.TimeBudgetMs > 0 {
+		budget = min(time.Duration(request.TimeBudgetMs)*time.Millisecond, maxBatchTimeBudget)
+	}
+
+	// The budget is on top of the time loading the events may take
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second+budget)
+	defer cancel()
+
+	cursor, err := eventsCollection.Find(ctx, bson.M{"_id": bson.M{"$in": request.EventIDs}})
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	var found []Event
+	if err := cursor.All(ctx, &found); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	// Keep the order of the request and report anything that is missing
+	now := clock()
+	byID := make(map[string]Event, len(found))
+	for _, event := range found {
+		event.now = now
+		byID[event.ID] = event
+	}
+	events := []Event{}
+	seen := make(map[string]bool)
+	for _, id := range request.EventIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		event, ok := byID[id]
+		if !ok {
+			sendResponse(w, http.StatusNotFound, false, "Event not found: "+id, nil)
+			return
+		}
+		events = append(events, event)
+	}
+
+	result, err := scheduleBatch(ctx, events, request.Weights, budget)
+	if err != nil {
+		sendSearchError(w, err)
+		return
+	}
+	for _, assignment := range result.Assignments {
+		if assignment.Recommendation != nil {
+			setDisplayTimes(&assignment.Recommendation.Slot, timezone)
+			setDisplayTimes(&assignment.Recommendation.Window, timezone)
+		}
+	}
+
+	message := "Batch scheduled successfully"
+	if !result.Complete {
+		message = "Time budget exceeded, returning best schedule found"
+	}
+	sendResponse(w, http.StatusOK, true, message, result)
+}
+
+// handleResource handles both creation (POST) and updates (PUT) of resources
+func handleResource(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	if status, err := adminFor(r); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	var resource Resource
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	resource.ID = id
+
+	if err := validateResource(resource); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	if resource.Slots == nil {
+		resource.Slots = []TimeSlot{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := resourcesCollection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	exists := count > 0
+
+	// POST = create (fail if exists), PUT = update (fail if not exists)
+	if r.Method == "POST" && exists {
+		sendResponse(w, http.StatusConflict, false, "Resource already exists", nil)
+		return
+	} else if r.Method == "PUT" && !exists {
+		sendResponse(w, http.StatusNotFound, false, "Resource not found", nil)
+		return
+	}
+
+	// Confirmed meetings keep the room they were promised
+	if exists {
+		confirmed, err := confirmedBookings(ctx, id)
+		if err != nil {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+			return
+		}
+		if err := bookingConflict(resource, confirmed); err != nil {
+			sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+			return
+		}
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	_, err = resourcesCollection.ReplaceOne(ctx, bson.M{"_id": id}, resource, opts)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	message := "Resource created successfully"
+	statusCode := http.StatusCreated
+	if r.Method == "PUT" {
+		message = "Resource updated successfully"
+		statusCode = http.StatusOK
+	}
+	sendResponse(w, statusCode, true, message, resource)
+}
+
+// getResource retrieves a resource by ID
+func getResource(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var resource Resource
+	err := resourcesCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&resource)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Resource not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Resource retrieved successfully", resource)
+}
+
+// listResources lists all resources, optionally only those of ?type=
+func listResources(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resources, err := findResources(ctx, r.URL.Query().Get("type"))
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Resources retrieved successfully", resources)
+}
+
+// deleteResource removes a resource by ID, unless a confirmed event has booked it
+func deleteResource(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	if status, err := adminFor(r); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	confirmed, err := confirmedBookings(ctx, id)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	if len(confirmed) > 0 {
+		sendResponse(w, http.StatusConflict, false, "resource is booked by event "+confirmed[0].ID, nil)
+		return
+	}
+	result, err := resourcesCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	if result.DeletedCount == 0 {
+		sendResponse(w, http.StatusNotFound, false, "Resource not found", nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Resource deleted successfully", nil)
+}
+
+// confirmedBookings loads the confirmed events that have booked a resource
+func confirmedBookings(ctx context.Context, resourceID string) ([]Event, error) {
+	filter := bson.M{"status": StatusConfirmed, "assigned_resource.id": resourceID}
+	cursor, err := eventsCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	confirmed := []Event{}
+	err = cursor.All(ctx, &confirmed)
+	return confirmed, err
+}
+
+// findResources loads the resources of a type, or all of them when the type is empty
+func findResources(ctx context.Context, resourceType string) ([]Resource, error) {
+	filter := bson.M{}
+	if resourceType != "" {
+		filter["type"] = resourceType
+	}
+	cursor, err := resourcesCollection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	resources := []Resource{}
+	err = cursor.All(ctx, &resources)
+	return resources, err
+}
+
+// listHolidayRegions lists the regions with a holiday calendar
+func listHolidayRegions(w http.ResponseWriter, r *http.Request) {
+	sendResponse(w, http.StatusOK, true, "Holiday regions retrieved successfully", holidayRegions())
+}
+
+// getHolidayCalendar returns the holidays of a region
+func getHolidayCalendar(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	calendar, ok := holidayCalendar(params["region"])
+	if !ok {
+		sendResponse(w, http.StatusNotFound, false, "Holiday region not found", nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Holiday calendar retrieved successfully", calendar)
+}
+
+// getEventICS exports the event's meeting as an iCalendar file: the scheduled
+// slot if there is one, otherwise the top recommendation. ?candidates=all
+// exports every recommended slot as a tentative event instead.
+func getEventICS(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	var loc *time.Location
+	if timezone := r.URL.Query().Get("timezone"); timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(timezone)
+		if err != nil {
+			sendResponse(w, http.StatusBadRequest, false, "invalid timezone: "+timezone, nil)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	now := clock()
+	event.now = now
+	if err := loadInconvenienceHistory(ctx, &event); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	var entries []calendarEntry
+	switch {
+	case event.Status == StatusCancelled && event.ScheduledSlot == nil:
+		sendResponse(w, http.StatusNotFound, false, "Event is cancelled", nil)
+		return
+	case event.Status == StatusCancelled:
+		entries = []calendarEntry{scheduledEntry(event)}
+	case r.URL.Query().Get("candidates") == "all":
+		recommendations, err := recommendSlots(ctx, event, 0)
+		if err != nil {
+			sendSearchError(w, err)
+			return
+		}
+		entries = recommendationEntries(event, recommendations)
+	case event.ScheduledSlot != nil:
+		entries = []calendarEntry{scheduledEntry(event)}
+	default:
+		recommendations, err := recommendSlots(ctx, event, 1)
+		if err != nil {
+			sendSearchError(w, err)
+			return
+		}
+		if len(recommendations) == 0 {
+			sendResponse(w, http.StatusNotFound, false, "No slot to export", nil)
+			return
+		}
+		entries = recommendationEntries(event, recommendations)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+id+`.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(writeEventCalendar(event, entries, loc, now)))
+}
+
+// handleCalendarAccount stores the calendar access a user grants for an
+// event, replacing any earlier one
+func handleCalendarAccount(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	var account CalendarAccount
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	account.ID = calendarAccountID(id, userID)
+	account.EventID = id
+	account.UserID = userID
+	if account.Provider == "" {
+		account.Provider = "caldav"
+	}
+
+	if err := validateCalendarAccount(account); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	sealed, err := sealCredential(account.Password)
+	if err == errNoCredentialsKey {
+		sendResponse(w, http.StatusServiceUnavailable, false, err.Error(), nil)
+		return
+	} else if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, err.Error(), nil)
+		return
+	}
+	stored := account
+	stored.Password = sealed
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if status, err := calendarOwner(ctx, r, id, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	result, err := calendarAccountsCollection.ReplaceOne(ctx, bson.M{"_id": account.ID}, stored, opts)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	account.Password = ""
+	if result.UpsertedCount > 0 {
+		sendResponse(w, http.StatusCreated, true, "Calendar account connected", account)
+	} else {
+		sendResponse(w, http.StatusOK, true, "Calendar account updated", account)
+	}
+}
+
+// calendarOwner checks that a request carries an invite token for the event
+// held by the user whose calendar account it touches, so a token only ever
+// reaches the account connected for its own event. On failure it also
+// returns the HTTP status to answer with.
+func calendarOwner(ctx context.Context, r *http.Request, eventID, userID string) (int, error) {
+	if requestToken(r) == "" {
+		return http.StatusUnauthorized, fmt.Errorf("calendar accounts need an invite token")
+	}
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": eventID}).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return http.StatusNotFound, fmt.Errorf("Event not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Database error: %v", err)
+	}
+
+	holder, status, err := participantFor(r, event, "")
+	if err != nil {
+		return status, err
+	}
+	if holder != userID {
+		return http.StatusForbidden, fmt.Errorf("invite token is for another user")
+	}
+	return 0, nil
+}
+
+// getCalendarAccount returns a user's calendar account for an event without its password
+func getCalendarAccount(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if status, err := calendarOwner(ctx, r, id, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	var account CalendarAccount
+	err := calendarAccountsCollection.FindOne(ctx, bson.M{"_id": calendarAccountID(id, userID)}).Decode(&account)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Calendar account not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+	account.Password = ""
+	sendResponse(w, http.StatusOK, true, "Calendar account retrieved successfully", account)
+}
+
+// deleteCalendarAccount revokes the calendar access a user granted for an event
+func deleteCalendarAccount(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if status, err := calendarOwner(ctx, r, id, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	result, err := calendarAccountsCollection.DeleteOne(ctx, bson.M{"_id": calendarAccountID(id, userID)})
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	if result.DeletedCount == 0 {
+		sendResponse(w, http.StatusNotFound, false, "Calendar account not found", nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Calendar account deleted", nil)
+}
+
+// openPolling starts collecting availability for a draft event
+func openPolling(w http.ResponseWriter, r *http.Request) {
+	changeEventStatus(w, r, []string{StatusDraft}, StatusPolling, "Event opened for polling")
+}
+
+// reopenEvent releases a confirmed or cancelled event's time and starts polling again
+func reopenEvent(w http.ResponseWriter, r *http.Request) {
+	changeEventStatus(w, r, []string{StatusConfirmed, StatusCancelled}, StatusPolling, "Event reopened")
+}
+
+// cancelEvent calls the meeting off
+func cancelEvent(w http.ResponseWriter, r *http.Request) {
+	changeEventStatus(w, r, nil, StatusCancelled, "Event cancelled")
+}
+
+// changeEventStatus applies a lifecycle transition that needs no input. A
+// non-nil from narrows the states the endpoint accepts, as open and reopen
+// both lead to polling.
+func changeEventStatus(w http.ResponseWriter, r *http.Request, from []string, to, message string) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	if current := eventStatus(event); from != nil && !slices.Contains(from, current) {
+		sendResponse(w, http.StatusConflict, false, "Event is "+current, nil)
+		return
+	}
+	if err := transitionEvent(&event, to); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	err = saveEventChange(ctx, WebhookEventUpdated, nil, event, "", event, replaceEvent(event))
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, message, event)
+}
+
+// confirmChosenSlot locks in a recommendation, or an explicit slot, as the event's time
+func confirmChosenSlot(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	var request ConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	var recommendations []SlotRecommendation
+	if request.RecommendationID != "" {
+		scheduling := event
+		scheduling.now = clock()
+		if err := loadInconvenienceHistory(ctx, &scheduling); err != nil {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+			return
+		}
+		var resources []Resource
+		if event.Resource != nil {
+			if resources, err = findBookableResources(ctx, event); err != nil {
+				sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+				return
+			}
+		}
+		rec, ok, err := findRecommendationByID(ctx, scheduling, resources, request.RecommendationID)
+		if err != nil {
+			sendSearchError(w, err)
+			return
+		}
+		if ok {
+			recommendations = append(recommendations, rec)
+		}
+	}
+
+	slot, booked, err := chooseSlot(event, request, recommendations)
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	// An explicit slot still needs the event's resource, if it has one
+	if event.Resource != nil && booked == nil {
+		resources, err := findBookableResources(ctx, event)
+		if err != nil {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+			return
+		}
+		if booked = resourceForSlot(event, resources, slot); booked == nil {
+			sendResponse(w, http.StatusConflict, false, "No "+event.Resource.Type+" is free for that slot", nil)
+			return
+		}
+	}
+	if err := confirmEvent(&event, slot, booked, clock().UTC()); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	// Participants with an email address get the confirmation and its invite
+	var emails []OutboxMessage
+	if mailer != nil {
+		if emails, err = emailMessages(EmailConfirmation, event, participantEmails(event), "", nil); err != nil {
+			sendResponse(w, http.StatusInternalServerError, false, "Email error: "+err.Error(), nil)
+			return
+		}
+	}
+
+	err = saveEventChange(ctx, WebhookEventUpdated, nil, event, "", event, replaceEvent(event), emails...)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Event confirmed", event)
+}
+
+// saveEventChange applies a mutation and records the change in the outbox in
+// the same transaction, with recommendation.changed as well when an edit moved
+// the top recommendation. Only edits that can change availability pass before,
+// as ranking the event twice is the costly part. Extra messages, such as
+// emails, join the same transaction.
+func saveEventChange(ctx context.Context, eventType string, before *Event, after Event, userID string, data interface{}, mutate func(ctx context.Context) error, extra ...OutboxMessage) error {
+	if outboxCollection == nil {
+		return mutate(ctx)
+	}
+	messages, err := changeMessages(ctx, eventType, before, after, userID, data)
+	if err != nil {
+		return err
+	}
+	return writeWithOutbox(ctx, mutate, append(messages, extra...))
+}
+
+// replaceEvent is the mutation that stores a whole event
+func replaceEvent(event Event) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := eventsCollection.ReplaceOne(ctx, bson.M{"_id": event.ID}, event)
+		return err
+	}
+}
+
+// getEventResponses shows which participants have and haven't given availability
+func getEventResponses(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	sendResponse(w, http.StatusOK, true, "Responses retrieved successfully", eventResponses(event))
+}
+
+// handleRSVP records (POST) or changes (PUT) a user's answer to the confirmed
+// time. When max_declines required users have declined, the event goes back
+// to polling for a new time.
+func handleRSVP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	var rsvp RSVP
+	if err := json.NewDecoder(r.Body).Decode(&rsvp); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	rsvp.RespondedAt = clock().UTC()
+	if err := validateRSVP(rsvp); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if err := acceptsRSVP(event); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	var status int
+	if userID, status, err = participantFor(r, event, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	rsvp.UserID = userID
+	before := snapshotEvent(event)
+	existed := setRSVP(&event, rsvp)
+	// POST = create (fail if exists), PUT = update (fail if not exists)
+	if r.Method == "POST" && existed {
+		sendResponse(w, http.StatusConflict, false, "RSVP already exists", nil)
+		return
+	} else if r.Method == "PUT" && !existed {
+		sendResponse(w, http.StatusNotFound, false, "RSVP not found", nil)
+		return
+	}
+
+	message := "RSVP updated"
+	statusCode := http.StatusOK
+	if r.Method == "POST" {
+		message = "RSVP recorded"
+		statusCode = http.StatusCreated
+	}
+
+	// An answer only moves the recommendation when it reopens the event
+	var extra []OutboxMessage
+	var moved *Event
+	if needsReschedule(event) {
+		if err := rescheduleEvent(&event); err != nil {
+			sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+			return
+		}
+		reopened, err := newOutboxMessage(WebhookEventUpdated, id, "", event, clock())
+		if err != nil {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+			return
+		}
+		extra = append(extra, reopened)
+		moved = &before
+		message += "; too many required attendees declined, so the event is open for polling again"
+	}
+
+	err = saveEventChange(ctx, WebhookRSVPUpdated, moved, event, userID, rsvp, replaceEvent(event), extra...)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, statusCode, true, message, eventDetails(event))
+}
+
+// getRSVP returns a user's answer to the confirmed time
+func getRSVP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	for _, rsvp := range event.RSVPs {
+		if rsvp.UserID == userID {
+			sendResponse(w, http.StatusOK, true, "RSVP retrieved successfully", rsvp)
+			return
+		}
+	}
+	sendResponse(w, http.StatusNotFound, false, "RSVP not found", nil)
+}
+
+// deleteRSVP withdraws a user's answer
+func deleteRSVP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if err := acceptsRSVP(event); err != nil {
+		sendResponse(w, http.StatusConflict, false, err.Error(), nil)
+		return
+	}
+
+	var status int
+	if userID, status, err = participantFor(r, event, userID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	if !removeRSVP(&event, userID) {
+		sendResponse(w, http.StatusNotFound, false, "RSVP not found", nil)
+		return
+	}
+
+	err = saveEventChange(ctx, WebhookRSVPDeleted, nil, event, userID, nil, replaceEvent(event))
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "RSVP deleted", nil)
+}
+
+// issueParticipantInvite gives a participant a fresh invite token, revoking
+// the one they had. The token is only ever shown in this response.
+func issueParticipantInvite(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	var request InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	if request.ExpiresInHours < 0 {
+		sendResponse(w, http.StatusBadRequest, false, "expires_in_hours cannot be negative", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	if status := eventStatus(event); status == StatusCancelled {
+		sendResponse(w, http.StatusConflict, false, "Event is "+status, nil)
+		return
+	}
+
+	issued, err := issueInvite(&event, userID, time.Duration(request.ExpiresInHours)*time.Hour, clock())
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+	err = saveEventChange(ctx, WebhookEventUpdated, nil, event, "", event, replaceEvent(event))
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusCreated, true, "Invite issued", issued)
+}
+
+// listInvites returns the invites issued for an event, without their tokens
+func listInvites(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	invites := event.Invites
+	if invites == nil {
+		invites = []Invite{}
+	}
+	sendResponse(w, http.StatusOK, true, "Invites retrieved successfully", invites)
+}
+
+// revokeParticipantInvite stops a participant's invite token from working
+func revokeParticipantInvite(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	userID := params["user_id"]
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	if !revokeInvite(&event, userID, clock()) {
+		sendResponse(w, http.StatusNotFound, false, "Invite not found", nil)
+		return
+	}
+	err = saveEventChange(ctx, WebhookEventUpdated, nil, event, "", event, replaceEvent(event))
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Invite revoked", nil)
+}
+
+// sendInvitations emails the given addresses a personal invite link to submit their availability
+func sendInvitations(w http.ResponseWriter, r *http.Request) {
+	queueEmails(w, r, EmailInvitation)
+}
+
+// sendReminders emails a reminder: to submit availability while polling, or of
+// the meeting once it is confirmed, by default to every participant with an email address
+func sendReminders(w http.ResponseWriter, r *http.Request) {
+	queueEmails(w, r, EmailReminder)
+}
+
+// queueEmails renders an email for each recipient and queues them in the outbox
+func queueEmails(w http.ResponseWriter, r *http.Request, kind string) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	if mailer == nil {
+		sendResponse(w, http.StatusServiceUnavailable, false, "Email is not configured", nil)
+		return
+	}
+
+	var request EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	recipients, err := validateEmailRecipients(request.Emails)
+	if err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var event Event
+	err = eventsCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Event not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+
+	if status, err := organizerFor(r, event); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	if err := checkEventRecipients(event, recipients); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	status := eventStatus(event)
+	if status == StatusCancelled || (kind == EmailInvitation && status == StatusConfirmed) {
+		sendResponse(w, http.StatusConflict, false, "Event is "+status, nil)
+		return
+	}
+	// Without a list, invitations go to the invitees; reminders go to invitees
+	// who have yet to respond before the time is confirmed, and to everyone after
+	if len(recipients) == 0 {
+		switch {
+		case kind == EmailInvitation:
+			recipients = userEmails(event.Invitees)
+		case kind == EmailReminder && status != StatusConfirmed && len(event.Invitees) > 0:
+			recipients = userEmails(pendingUsers(event))
+		case kind == EmailReminder:
+			recipients = participantEmails(event)
+		}
+	}
+	if len(recipients) == 0 {
+		sendResponse(w, http.StatusBadRequest, false, "emails is required", nil)
+		return
+	}
+
+	// Each invitation carries a fresh invite link for its recipient
+	var invites map[string]Invite
+	mutate := func(context.Context) error { return nil }
+	if kind == EmailInvitation {
+		invites = map[string]Invite{}
+		for _, recipient := range recipients {
+			issued, err := issueInvite(&event, recipient, 0, clock())
+			if err != nil {
+				sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+				return
+			}
+			invites[recipient] = issued.Invite
+		}
+		mutate = replaceEvent(event)
+	}
+
+	messages, err := emailMessages(kind, event, recipients, request.Message, invites)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Email error: "+err.Error(), nil)
+		return
+	}
+	if err := writeWithOutbox(ctx, mutate, messages); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusAccepted, true, fmt.Sprintf("%d emails queued", len(messages)), map[string][]string{"recipients": recipients})
+}
+
+// webhookAccess checks that a request may manage the webhooks of an event,
+// which takes its organizer key, or of every event when eventID is empty,
+// which takes the admin key. The admin key also works for any one event. On
+// failure it also returns the HTTP status to answer with.
+func webhookAccess(ctx context.Context, r *http.Request, eventID string) (int, error) {
+	if eventID == "" || r.Header.Get("X-Admin-Key") != "" {
+		return adminFor(r)
+	}
+	var event Event
+	err := eventsCollection.FindOne(ctx, bson.M{"_id": eventID}).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return http.StatusNotFound, fmt.Errorf("Event not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Database error: %v", err)
+	}
+	return organizerFor(r, event)
+}
+
+// webhookSubscriptionAccess is webhookAccess for a stored subscription
+func webhookSubscriptionAccess(ctx context.Context, r *http.Request, id string) (int, error) {
+	var sub WebhookSubscription
+	err := webhooksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return http.StatusNotFound, fmt.Errorf("Webhook not found")
+	} else if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Database error: %v", err)
+	}
+	return webhookAccess(ctx, r, sub.EventID)
+}
+
+// handleWebhook creates (POST) or replaces (PUT) a webhook subscription. A
+// secret is generated when none is given and returned only in this response.
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	var sub WebhookSubscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, "Invalid request format: "+err.Error(), nil)
+		return
+	}
+	sub.ID = id
+
+	if err := validateWebhookSubscription(sub); err != nil {
+		sendResponse(w, http.StatusBadRequest, false, err.Error(), nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var existing WebhookSubscription
+	err := webhooksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
+	if err != nil && err != mongo.ErrNoDocuments {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	exists := err == nil
+
+	// POST = create (fail if exists), PUT = update (fail if not exists)
+	if r.Method == "POST" && exists {
+		sendResponse(w, http.StatusConflict, false, "Webhook already exists", nil)
+		return
+	} else if r.Method == "PUT" && !exists {
+		sendResponse(w, http.StatusNotFound, false, "Webhook not found", nil)
+		return
+	}
+
+	// Moving a subscription takes access to where it was as well as to where it goes
+	if status, err := webhookAccess(ctx, r, sub.EventID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	if exists && existing.EventID != sub.EventID {
+		if status, err := webhookAccess(ctx, r, existing.EventID); err != nil {
+			sendResponse(w, status, false, err.Error(), nil)
+			return
+		}
+	}
+
+	// An update keeps the secret subscribers verify with unless a new one is given or asked for
+	sub.CreatedAt = clock().UTC()
+	if exists {
+		sub.CreatedAt = existing.CreatedAt
+		if sub.Secret == "" && r.URL.Query().Get("rotate_secret") != "true" {
+			sub.Secret = existing.Secret
+		}
+	}
+	generated := sub.Secret == ""
+	if generated {
+		sub.Secret = newWebhookID(32)
+	}
+
+	opts := options.Replace().SetUpsert(true)
+	_, err = webhooksCollection.ReplaceOne(ctx, bson.M{"_id": id}, sub, opts)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+
+	if !generated {
+		sub.Secret = ""
+	}
+	if r.Method == "PUT" {
+		sendResponse(w, http.StatusOK, true, "Webhook updated successfully", sub)
+	} else {
+		sendResponse(w, http.StatusCreated, true, "Webhook created successfully", sub)
+	}
+}
+
+// getWebhook retrieves a webhook subscription without its secret
+func getWebhook(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var sub WebhookSubscription
+	err := webhooksCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&sub)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			sendResponse(w, http.StatusNotFound, false, "Webhook not found", nil)
+		} else {
+			sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		}
+		return
+	}
+	if status, err := webhookAccess(ctx, r, sub.EventID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	sub.Secret = ""
+	sendResponse(w, http.StatusOK, true, "Webhook retrieved successfully", sub)
+}
+
+// listWebhooks lists webhook subscriptions, optionally only those of ?event_id=
+func listWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Without ?event_id= every subscription is listed, which takes the admin key
+	eventID := r.URL.Query().Get("event_id")
+	if status, err := webhookAccess(ctx, r, eventID); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	filter := bson.M{}
+	if eventID != "" {
+		filter["event_id"] = eventID
+	}
+	cursor, err := webhooksCollection.Find(ctx, filter)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	subs := []WebhookSubscription{}
+	if err := cursor.All(ctx, &subs); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	sendResponse(w, http.StatusOK, true, "Webhooks retrieved successfully", subs)
+}
+
+// deleteWebhook removes a webhook subscription
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if status, err := webhookSubscriptionAccess(ctx, r, id); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+	result, err := webhooksCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	if result.DeletedCount == 0 {
+		sendResponse(w, http.StatusNotFound, false, "Webhook not found", nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Webhook deleted successfully", nil)
+}
+
+// getWebhookDeliveries returns a subscription's delivery log, newest first (?status=, ?limit=, default 50)
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	limit := int64(50)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 500 {
+			sendResponse(w, http.StatusBadRequest, false, "limit must be between 1 and 500", nil)
+			return
+		}
+		limit = int64(n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if status, err := webhookSubscriptionAccess(ctx, r, id); err != nil {
+		sendResponse(w, status, false, err.Error(), nil)
+		return
+	}
+
+	filter := bson.M{"subscription_id": id}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+	opts := options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(limit)
+	cursor, err := webhookDeliveriesCollection.Find(ctx, filter, opts)
+	if err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	deliveries := []WebhookDelivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		sendResponse(w, http.StatusInternalServerError, false, "Database error: "+err.Error(), nil)
+		return
+	}
+	sendResponse(w, http.StatusOK, true, "Webhook deliveries retrieved successfully", deliveries)
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHeatmapBucket is the bucket size when the request does not give one
+const defaultHeatmapBucket = 30 * time.Minute
+
+// maxHeatmapBuckets bounds how many buckets one heatmap can have, about 17
+// days of 5 minute buckets or 3 months of half hours
+const maxHeatmapBuckets = 5000
+
+type HeatmapBucket struct {
+	Slot           TimeSlot `json:"slot"`
+	Count          int      `json:"count"`
+	AvailableUsers []string `json:"available_users"`
+}
+
+type Heatmap struct {
+	BucketMins int             `json:"bucket_mins"`
+	TimeZone   string          `json:"timezone"`
+	Users      []string        `json:"users"`
+	Buckets    []HeatmapBucket `json:"buckets"`
+}
+
+// parseHeatmapBucket parses a bucket size such as "30m" or "1h"
+func parseHeatmapBucket(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultHeatmapBucket, nil
+	}
+	bucket, err := time.ParseDuration(value)
+	if err != nil || bucket < 5*time.Minute || bucket > 24*time.Hour || bucket%time.Minute != 0 {
+		return 0, fmt.Errorf("invalid bucket: %s (whole minutes between 5m and 24h)", value)
+	}
+	return bucket, nil
+}
+
+// buildHeatmap counts who is free in every bucket across the event's slots.
+// Buckets are aligned to local midnight in loc and clipped to the slots; a
+// user counts as available when free for the whole clipped bucket. An event
+// too long for maxHeatmapBuckets of the given size is an error.
+func buildHeatmap(event Event, bucket time.Duration, loc *time.Location) (Heatmap, error) {
+	windows := mergeRuns(slotsToRuns(event.Slots))
+	count := int64(0)
+	for _, window := range windows {
+		first := firstBucket(window, bucket, loc).UnixNano()
+		count += (window.end - first + int64(bucket) - 1) / int64(bucket)
+	}
+	if count > maxHeatmapBuckets {
+		return Heatmap{}, fmt.Errorf("bucket %s gives %d buckets, more than the %d allowed; use a larger bucket", bucket, count, maxHeatmapBuckets)
+	}
+
+	// Buffers, notice, holidays, declined times and quorum belong to recommendations, not to raw availability
+	event.BufferBefore, event.BufferAfter = 0, 0
+	event.NotBefore = nil
+	event.HolidayPolicy = HolidayPolicyIgnore
+	event.RejectedSlots = nil
+	index := buildAvailabilityIndex(event)
+
+	heatmap := Heatmap{
+		BucketMins: int(bucket.Minutes()),
+		TimeZone:   loc.String(),
+		Users:      index.users,
+		Buckets:    []HeatmapBucket{},
+	}
+
+	for _, window := range windows {
+		for bucketStart := firstBucket(window, bucket, loc); bucketStart.UnixNano() < window.end; bucketStart = bucketStart.Add(bucket) {
+			start := max(bucketStart.UnixNano(), window.start)
+			end := min(bucketStart.Add(bucket).UnixNano(), window.end)
+
+			available, _ := index.usersFree(start, end)
+			heatmap.Buckets = append(heatmap.Buckets, HeatmapBucket{
+				Slot:           TimeSlot{Start_UTC: nanosToTime(start), End_UTC: nanosToTime(end)},
+				Count:          len(available),
+				AvailableUsers: available,
+			})
+		}
+	}
+
+	return heatmap, nil
+}
+
+// firstBucket is where the bucket holding the start of a window begins,
+// counting from local midnight in loc
+func firstBucket(window freeRun, bucket time.Duration, loc *time.Location) time.Time {
+	windowStart := nanosToTime(window.start)
+	local := windowStart.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	return midnight.Add(windowStart.Sub(midnight) / bucket * bucket)
+}
+
+// writeHeatmapCSV writes one row per bucket, with available users separated by semicolons
+func writeHeatmapCSV(out io.Writer, heatmap Heatmap) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"start_utc", "end_utc", "start", "end", "count", "available_users"})
+	for _, bucket := range heatmap.Buckets {
+		writer.Write([]string{
+			bucket.Slot.Start_UTC.Format(time.RFC3339),
+			bucket.Slot.End_UTC.Format(time.RFC3339),
+			bucket.Slot.StartStr,
+			bucket.Slot.EndStr,
+			strconv.Itoa(bucket.Count),
+			strings.Join(bucket.AvailableUsers, ";"),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
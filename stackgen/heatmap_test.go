@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildHeatmap(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		BufferBefore: 30,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:15", "2025-01-15 11:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 10:30")),
+			userAvailability("bob", utcSlot("2025-01-15 10:00", "2025-01-15 12:00")),
+		},
+	}
+
+	heatmap, err := buildHeatmap(event, 30*time.Minute, time.UTC)
+	assert.NoError(t, err)
+
+	// The first bucket is clipped to where the event starts
+	assert.Len(t, heatmap.Buckets, 4)
+	assert.Equal(t, utcSlot("2025-01-15 09:15", "2025-01-15 09:30"), heatmap.Buckets[0].Slot)
+	assert.Equal(t, []string{"alice"}, heatmap.Buckets[0].AvailableUsers)
+	assert.Equal(t, 2, heatmap.Buckets[2].Count)
+	assert.Equal(t, []string{"bob"}, heatmap.Buckets[3].AvailableUsers)
+
+	var out bytes.Buffer
+	assert.NoError(t, writeHeatmapCSV(&out, heatmap))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.True(t, strings.HasSuffix(lines[3], ",2,alice;bob"))
+}
+
+func TestBuildHeatmapBounded(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-01 00:00", "2026-01-01 00:00")},
+	}
+
+	// A year of 5 minute buckets is refused, a year of days is not
+	_, err := buildHeatmap(event, 5*time.Minute, time.UTC)
+	assert.ErrorContains(t, err, "use a larger bucket")
+	heatmap, err := buildHeatmap(event, 24*time.Hour, time.UTC)
+	assert.NoError(t, err)
+	assert.Len(t, heatmap.Buckets, 365)
+}
+
+func TestParseHeatmapBucket(t *testing.T) {
+	bucket, err := parseHeatmapBucket("")
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, bucket)
+
+	bucket, err = parseHeatmapBucket("1h")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, bucket)
+
+	for _, invalid := range []string{"1m", "90s", "48h", "soon"} {
+		_, err := parseHeatmapBucket(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
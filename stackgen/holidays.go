@@ -0,0 +1,313 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed holidays/*.json holidays/*.ics
+var bundledHolidays embed.FS
+
+// Holiday policies decide what a participant's local holiday does to a slot
+const (
+	HolidayPolicyExclude  = "exclude"  // The participant is unavailable all day (default)
+	HolidayPolicyPenalize = "penalize" // The participant still counts, but the slot scores lower
+	HolidayPolicyIgnore   = "ignore"
+)
+
+// holidayPenalty is how much score each available participant on holiday costs under the penalize policy
+const holidayPenalty = 0.5
+
+type Holiday struct {
+	Date string `json:"date"` // YYYY-MM-DD, local to the participant
+	Name string `json:"name"`
+}
+
+type HolidayCalendar struct {
+	Region   string    `json:"region"`
+	Name     string    `json:"name"`
+	Holidays []Holiday `json:"holidays"`
+}
+
+var (
+	holidaysMu       sync.RWMutex
+	holidayCalendars = map[string]*HolidayCalendar{}
+	holidayDates     = map[string]map[string]string{} // region -> date -> name
+)
+
+func init() {
+	if err := loadHolidayCalendars(bundledHolidays, "holidays"); err != nil {
+		panic("bundled holiday calendars: " + err.Error())
+	}
+}
+
+// loadHolidayCalendars reads every .json and .ics calendar in dir. The region
+// is the JSON "region" field or, for ICS, the file name (JP.ics is JP).
+// Calendars for a region that is already loaded are merged into it.
+func loadHolidayCalendars(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.ToLower(path.Ext(name))
+		if entry.IsDir() || (ext != ".json" && ext != ".ics") {
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		var calendar HolidayCalendar
+		if ext == ".json" {
+			err = json.Unmarshal(data, &calendar)
+		} else {
+			calendar, err = parseHolidayICS(string(data))
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		if calendar.Region == "" {
+			calendar.Region = strings.TrimSuffix(name, path.Ext(name))
+		}
+		if err := addHolidayCalendar(calendar); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// parseHolidayICS turns the all-day VEVENTs of an iCalendar file into holidays
+func parseHolidayICS(data string) (HolidayCalendar, error) {
+	root, err := parseICS(strings.NewReader(data))
+	if err != nil {
+		return HolidayCalendar{}, err
+	}
+
+	calendar := HolidayCalendar{}
+	for _, vcalendar := range root.find("VCALENDAR") {
+		if prop, ok := vcalendar.property("X-WR-CALNAME"); ok {
+			calendar.Name = unescapeICSText(prop.Value)
+		}
+	}
+	for _, vevent := range root.find("VEVENT") {
+		start, ok := vevent.property("DTSTART")
+		if !ok {
+			continue
+		}
+		date, _, err := parseICSTime(start, time.UTC)
+		if err != nil {
+			return calendar, err
+		}
+		summary, _ := vevent.property("SUMMARY")
+		calendar.Holidays = append(calendar.Holidays, Holiday{
+			Date: date.Format("2006-01-02"),
+			Name: unescapeICSText(summary.Value),
+		})
+	}
+	return calendar, nil
+}
+
+// addHolidayCalendar registers a calendar, merging it into an existing one for the same region
+func addHolidayCalendar(calendar HolidayCalendar) error {
+	region := strings.ToUpper(calendar.Region)
+	for _, holiday := range calendar.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return fmt.Errorf("invalid holiday date: %s", holiday.Date)
+		}
+	}
+
+	holidaysMu.Lock()
+	defer holidaysMu.Unlock()
+
+	existing, ok := holidayCalendars[region]
+	if !ok {
+		existing = &HolidayCalendar{Region: region, Name: calendar.Name}
+		holidayCalendars[region] = existing
+		holidayDates[region] = map[string]string{}
+	}
+	for _, holiday := range calendar.Holidays {
+		if _, dup := holidayDates[region][holiday.Date]; dup {
+			continue
+		}
+		holidayDates[region][holiday.Date] = holiday.Name
+		existing.Holidays = append(existing.Holidays, holiday)
+	}
+	sort.Slice(existing.Holidays, func(i, j int) bool {
+		return existing.Holidays[i].Date < existing.Holidays[j].Date
+	})
+	return nil
+}
+
+// holidayCalendar looks up the calendar of a region
+func holidayCalendar(region string) (HolidayCalendar, bool) {
+	holidaysMu.RLock()
+	defer holidaysMu.RUnlock()
+	calendar, ok := holidayCalendars[strings.ToUpper(region)]
+	if !ok {
+		return HolidayCalendar{}, false
+	}
+	return *calendar, true
+}
+
+// holidayRegions lists the loaded calendars without their holidays
+func holidayRegions() []HolidayCalendar {
+	holidaysMu.RLock()
+	defer holidaysMu.RUnlock()
+	regions := make([]HolidayCalendar, 0, len(holidayCalendars))
+	for _, calendar := range holidayCalendars {
+		regions = append(regions, HolidayCalendar{Region: calendar.Region, Name: calendar.Name})
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Region < regions[j].Region })
+	return regions
+}
+
+// isHoliday reports whether a local date is a holiday in the region
+func isHoliday(region string, date time.Time) bool {
+	holidaysMu.RLock()
+	defer holidaysMu.RUnlock()
+	_, ok := holidayDates[strings.ToUpper(region)][date.Format("2006-01-02")]
+	return ok
+}
+
+// validateHolidayPolicy checks an event's holiday_policy
+func validateHolidayPolicy(policy string) error {
+	switch policy {
+	case "", HolidayPolicyExclude, HolidayPolicyPenalize, HolidayPolicyIgnore:
+		return nil
+	}
+	return fmt.Errorf("invalid holiday_policy: %s", policy)
+}
+
+// validateRegion checks that a participant's region has a loaded holiday calendar
+func validateRegion(region string) error {
+	if region == "" {
+		return nil
+	}
+	if _, ok := holidayCalendar(region); !ok {
+		return fmt.Errorf("unknown holiday region: %s", region)
+	}
+	return nil
+}
+
+// userRegions maps users to the holiday region they submitted
+func userRegions(event Event) map[string]string {
+	regions := make(map[string]string)
+	for _, user := range event.UserSlots {
+		if user.Region != "" {
+			regions[user.UserID] = user.Region
+		}
+	}
+	return regions
+}
+
+// holidayRuns returns the whole local days in [from, to) that are holidays in the region
+func holidayRuns(region string, loc *time.Location, from, to int64) []freeRun {
+	runs := []freeRun{}
+	local := nanosToTime(from).In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	for day.UnixNano() < to {
+		next := day.AddDate(0, 0, 1)
+		if isHoliday(region, day) {
+			runs = append(runs, freeRun{start: day.UnixNano(), end: next.UnixNano()})
+		}
+		day = next
+	}
+	return runs
+}
+
+// onHoliday reports whether any part of the slot falls on a local holiday
+func onHoliday(region string, loc *time.Location, slot TimeSlot) bool {
+	return isHoliday(region, slot.Start_UTC.In(loc)) || isHoliday(region, slot.End_UTC.Add(-time.Nanosecond).In(loc))
+}
+
+// subtractRuns removes the busy runs from the free ones; both must be sorted and merged
+func subtractRuns(free, busy []freeRun) []freeRun {
+	result := []freeRun{}
+	j := 0
+	for _, run := range free {
+		start := run.start
+		for j < len(busy) && busy[j].end <= start {
+			j++
+		}
+		for k := j; k < len(busy) && busy[k].start < run.end; k++ {
+			if busy[k].start > start {
+				result = append(result, freeRun{start: start, end: busy[k].start})
+			}
+			start = max(start, busy[k].end)
+		}
+		if start < run.end {
+			result = append(result, freeRun{start: start, end: run.end})
+		}
+	}
+	return result
+}
+
+// excludeHolidays removes the local holidays of users with a region from
+// their free runs, unless the event's policy keeps them
+func excludeHolidays(event Event, index *availabilityIndex, userIndex map[string]int) {
+	if event.HolidayPolicy != "" && event.HolidayPolicy != HolidayPolicyExclude {
+		return
+	}
+	regions := userRegions(event)
+	if len(regions) == 0 {
+		return
+	}
+	locations := userTimezones(event)
+	for user, region := range regions {
+		i := userIndex[user]
+		runs := index.runs[i]
+		if len(runs) == 0 {
+			continue
+		}
+		loc, ok := locations[user]
+		if !ok {
+			loc = time.UTC
+		}
+		busy := holidayRuns(region, loc, runs[0].start, runs[len(runs)-1].end)
+		if len(busy) > 0 {
+			index.runs[i] = subtractRuns(runs, busy)
+		}
+	}
+}
+
+// holidayScorer lowers another scorer's score for every available participant on a local holiday
+type holidayScorer struct {
+	inner     Scorer
+	regions   map[string]string
+	locations map[string]*time.Location
+}
+
+func (s holidayScorer) ScoresPlacement() bool {
+	placer, ok := s.inner.(PlacementScorer)
+	return ok && placer.ScoresPlacement()
+}
+
+func (s holidayScorer) Score(candidate *Candidate) float64 {
+	score := s.inner.Score(candidate)
+	for _, user := range candidate.AvailableUsers() {
+		region, ok := s.regions[user]
+		if !ok {
+			continue
+		}
+		loc, ok := s.locations[user]
+		if !ok {
+			loc = time.UTC
+		}
+		if onHoliday(region, loc, candidate.Slot) {
+			score -= holidayPenalty
+		}
+	}
+	return score
+}
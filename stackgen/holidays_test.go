@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundledHolidayCalendars(t *testing.T) {
+	for _, region := range []string{"US", "GB", "IN", "JP"} {
+		calendar, ok := holidayCalendar(region)
+		assert.True(t, ok, region)
+		assert.NotEmpty(t, calendar.Holidays, region)
+	}
+
+	// Region lookups are case-insensitive
+	assert.True(t, isHoliday("us", time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, isHoliday("GB", time.Date(2025, 7, 4, 0, 0, 0, 0, time.UTC)))
+	assert.True(t, isHoliday("JP", time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)))
+	assert.Error(t, validateRegion("ZZ"))
+
+	// Every bundled calendar covers each year through 2035
+	for _, region := range []string{"US", "GB", "IN", "JP"} {
+		calendar, _ := holidayCalendar(region)
+		years := map[string]bool{}
+		for _, holiday := range calendar.Holidays {
+			years[holiday.Date[:4]] = true
+		}
+		for year := 2025; year <= 2035; year++ {
+			assert.True(t, years[fmt.Sprint(year)], "%s %d", region, year)
+		}
+	}
+	assert.True(t, isHoliday("JP", time.Date(2026, 9, 22, 0, 0, 0, 0, time.UTC)))  // Citizens' Holiday
+	assert.True(t, isHoliday("GB", time.Date(2027, 12, 28, 0, 0, 0, 0, time.UTC))) // Boxing Day, substitute
+	assert.True(t, isHoliday("US", time.Date(2027, 12, 31, 0, 0, 0, 0, time.UTC))) // New Year's Day, observed
+}
+
+func TestLoadHolidayCalendarsFromICS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"XA.ics":        {Data: []byte("BEGIN:VCALENDAR\r\nX-WR-CALNAME:Test\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20250310\r\nSUMMARY:Founders\\, Day\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")},
+		"xa-extra.json": {Data: []byte(`{"region":"xa","holidays":[{"date":"2025-03-11","name":"Day After"},{"date":"2025-03-10","name":"Duplicate"}]}`)},
+		"README.md":     {Data: []byte("ignored")},
+	}
+	assert.NoError(t, loadHolidayCalendars(fsys, "."))
+
+	calendar, ok := holidayCalendar("XA")
+	assert.True(t, ok)
+	assert.Equal(t, "Test", calendar.Name)
+	assert.Equal(t, []Holiday{
+		{Date: "2025-03-10", Name: "Founders, Day"},
+		{Date: "2025-03-11", Name: "Day After"},
+	}, calendar.Holidays)
+
+	bad := fstest.MapFS{"XB.json": {Data: []byte(`{"holidays":[{"date":"10/03/2025"}]}`)}}
+	assert.Error(t, loadHolidayCalendars(bad, "."))
+}
+
+func TestSubtractRuns(t *testing.T) {
+	free := []freeRun{{0, 10}, {20, 30}}
+	busy := []freeRun{{2, 4}, {8, 22}, {25, 26}, {40, 50}}
+	assert.Equal(t, []freeRun{{0, 2}, {4, 8}, {22, 25}, {26, 30}}, subtractRuns(free, busy))
+	assert.Equal(t, free, subtractRuns(free, nil))
+}
+
+func TestHolidayRunsUseLocalDays(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	from := utcSlot("2025-01-12 00:00", "2025-01-14 00:00")
+
+	// Coming of Age Day is 13 January in Tokyo, 15:00 UTC on the 12th to 15:00 UTC on the 13th
+	runs := holidayRuns("JP", tokyo, from.Start_UTC.UnixNano(), from.End_UTC.UnixNano())
+	holiday := utcSlot("2025-01-12 15:00", "2025-01-13 15:00")
+	assert.Equal(t, []freeRun{{holiday.Start_UTC.UnixNano(), holiday.End_UTC.UnixNano()}}, runs)
+}
+
+func TestHolidayPolicies(t *testing.T) {
+	thursday := utcSlot("2025-07-03 14:00", "2025-07-03 15:00")
+	independenceDay := utcSlot("2025-07-04 14:00", "2025-07-04 15:00")
+	newEvent := func(policy string) Event {
+		alice := zonedAvailability("alice", "America/New_York", thursday, independenceDay)
+		alice.Region = "US"
+		bob := userAvailability("bob", thursday, independenceDay)
+		bob.Region = "GB"
+		return Event{
+			DurationMins:  60,
+			HolidayPolicy: policy,
+			Slots:         []TimeSlot{thursday, independenceDay},
+			UserSlots:     []UserAvailability{alice, bob},
+		}
+	}
+
+	t.Run("Exclude", func(t *testing.T) {
+		recs := optimalSlots(t, newEvent(""), 0)
+		assert.Len(t, recs, 2)
+		assert.Equal(t, thursday.Start_UTC, recs[0].Slot.Start_UTC)
+		assert.Equal(t, independenceDay.Start_UTC, recs[1].Slot.Start_UTC)
+		assert.Equal(t, []string{"bob"}, recs[1].AvailableUsers)
+		assert.Equal(t, []string{"alice"}, recs[1].UnavailableUsers)
+	})
+
+	t.Run("Explain", func(t *testing.T) {
+		event := newEvent("")
+		explanation := explainedSlot(t, event, nil, independenceDay, nil)
+		assert.False(t, explanation.Users[0].Available)
+		assert.Equal(t, "slot falls on a public holiday in US", explanation.Users[0].Reason)
+		assert.True(t, explanation.Users[1].Available)
+	})
+
+	t.Run("Raw Views", func(t *testing.T) {
+		// The heatmap and free windows show what people offered, holidays or not
+		event := newEvent("")
+		windows, err := commonFreeWindows(event, nil)
+		assert.NoError(t, err)
+		assert.Len(t, windows, 2)
+		assert.Equal(t, independenceDay, windows[1].Slot)
+
+		heatmap, err := buildHeatmap(event, time.Hour, time.UTC)
+		assert.NoError(t, err)
+		assert.Len(t, heatmap.Buckets, 2)
+		assert.Equal(t, []string{"alice", "bob"}, heatmap.Buckets[1].AvailableUsers)
+	})
+
+	t.Run("Penalize", func(t *testing.T) {
+		recs := optimalSlots(t, newEvent(HolidayPolicyPenalize), 0)
+		assert.Len(t, recs, 2)
+		assert.Equal(t, 2.0, recs[0].Score)
+		assert.Equal(t, independenceDay.Start_UTC, recs[1].Slot.Start_UTC)
+		assert.Equal(t, []string{"alice", "bob"}, recs[1].AvailableUsers)
+		assert.Equal(t, 1.5, recs[1].Score)
+	})
+
+	t.Run("Ignore", func(t *testing.T) {
+		recs := optimalSlots(t, newEvent(HolidayPolicyIgnore), 0)
+		assert.Len(t, recs, 2)
+		assert.Equal(t, recs[0].Score, recs[1].Score)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		assert.Error(t, validateEvent(newEvent("skip")))
+		event := newEvent("")
+		event.UserSlots[1].Region = "ZZ"
+		assert.Error(t, validateEvent(event))
+	})
+}
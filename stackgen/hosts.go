@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Requests to URLs that users give, such as calendar servers and webhook
+// receivers, only go to public addresses, so they cannot reach the
+// cluster's own services
+
+// sharedAddressSpace is carrier-grade NAT space (RFC 6598), which net.IP does not flag as private
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP reports whether ip is a public unicast address
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0))
+}
+
+// checkPublicHost rejects a URL host that is plainly internal: localhost or
+// an address that is not public. Names are checked again each time they are
+// dialled, since they can resolve differently later.
+func checkPublicHost(host string) error {
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	if name == "localhost" || strings.HasSuffix(name, ".localhost") {
+		return fmt.Errorf("%s is not a public host", host)
+	}
+	if ip := net.ParseIP(strings.Trim(name, "[]")); ip != nil && !publicIP(ip) {
+		return fmt.Errorf("%s is not a public host", host)
+	}
+	return nil
+}
+
+// publicDialControl refuses a connection, after DNS resolution, unless it is to a public address
+func publicDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
+
+// publicHTTPClient is an HTTP client that only connects to public addresses,
+// redirects included. It ignores proxy settings, so every address it dials
+// is the one being checked.
+func publicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicDialControl}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
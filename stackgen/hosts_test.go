@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicIP(t *testing.T) {
+	for _, address := range []string{"93.184.216.34", "2606:4700::6810:84e5"} {
+		assert.True(t, publicIP(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "0.1.2.3", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1", "224.0.0.1"} {
+		assert.False(t, publicIP(net.ParseIP(address)), address)
+	}
+}
+
+func TestCheckPublicHost(t *testing.T) {
+	for _, host := range []string{"dav.example.com", "93.184.216.34"} {
+		assert.NoError(t, checkPublicHost(host), host)
+	}
+	for _, host := range []string{"localhost", "LOCALHOST.", "api.localhost", "127.0.0.1", "::1", "[::1]", "10.0.0.1"} {
+		assert.Error(t, checkPublicHost(host), host)
+	}
+}
+
+func TestPublicHTTPClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The check happens when dialling, after any name has been resolved
+	_, err := publicHTTPClient(time.Second).Get(server.URL)
+	assert.ErrorContains(t, err, "not a public address")
+}
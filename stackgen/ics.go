@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// icsProperty is one content line of an iCalendar file, e.g. DTSTART;TZID=Europe/London:20250115T090000
+type icsProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// icsComponent is a BEGIN/END block such as VCALENDAR or VEVENT
+type icsComponent struct {
+	Name       string
+	Properties []icsProperty
+	Components []*icsComponent
+}
+
+// parseICS reads an iCalendar stream into a tree of components. The returned
+// root has no name and holds the top-level VCALENDAR blocks.
+func parseICS(r io.Reader) (*icsComponent, error) {
+	root := &icsComponent{}
+	stack := []*icsComponent{root}
+
+	lines, err := unfoldICSLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for n, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseICSProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("ics line %d: %v", n+1, err)
+		}
+
+		current := stack[len(stack)-1]
+		switch prop.Name {
+		case "BEGIN":
+			child := &icsComponent{Name: strings.ToUpper(prop.Value)}
+			current.Components = append(current.Components, child)
+			stack = append(stack, child)
+		case "END":
+			if len(stack) == 1 || current.Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("ics line %d: unexpected END:%s", n+1, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			current.Properties = append(current.Properties, prop)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("ics: missing END:%s", stack[len(stack)-1].Name)
+	}
+	return root, nil
+}
+
+// unfoldICSLines joins continuation lines, which start with a space or tab
+func unfoldICSLines(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseICSProperty splits NAME;PARAM=value:VALUE
+func parseICSProperty(line string) (icsProperty, error) {
+	prop := icsProperty{Params: map[string]string{}}
+
+	// The value starts at the first colon outside a quoted parameter
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon == -1 {
+		return prop, fmt.Errorf("missing ':' in %q", line)
+	}
+	prop.Value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		key, value, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+// property returns the first property with the given name
+func (c *icsComponent) property(name string) (icsProperty, bool) {
+	for _, prop := range c.Properties {
+		if prop.Name == name {
+			return prop, true
+		}
+	}
+	return icsProperty{}, false
+}
+
+// properties returns every property with the given name
+func (c *icsComponent) properties(name string) []icsProperty {
+	props := []icsProperty{}
+	for _, prop := range c.Properties {
+		if prop.Name == name {
+			props = append(props, prop)
+		}
+	}
+	return props
+}
+
+// find returns every component with the given name anywhere below c
+func (c *icsComponent) find(name string) []*icsComponent {
+	found := []*icsComponent{}
+	for _, child := range c.Components {
+		if child.Name == name {
+			found = append(found, child)
+		}
+		found = append(found, child.find(name)...)
+	}
+	return found
+}
+
+// parseICSTime parses a DATE or DATE-TIME value. Dates are all-day and land
+// at midnight in loc, as do floating times; TZID overrides loc.
+func parseICSTime(prop icsProperty, loc *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.Value)
+
+	if tzid, ok := prop.Params["TZID"]; ok {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	if prop.Params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// unescapeICSText undoes the escaping used in TEXT values such as SUMMARY
+func unescapeICSText(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// icsWriter builds an iCalendar stream with CRLF line endings and lines folded at 75 octets
+type icsWriter struct {
+	b strings.Builder
+}
+
+// line writes NAME;PARAMS:VALUE. Params are given already formatted, e.g. "TZID=Europe/London".
+func (w *icsWriter) line(name, value string, params ...string) {
+	content := name
+	for _, param := range params {
+		content += ";" + param
+	}
+	content += ":" + value
+
+	// Continuation lines spend one octet on the leading space
+	limit := 75
+	for len(content) > limit {
+		// Never split a multi-byte character
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.b.WriteString(content[:cut])
+		w.b.WriteString("\r\n ")
+		content = content[cut:]
+		limit = 74
+	}
+	w.b.WriteString(content)
+	w.b.WriteString("\r\n")
+}
+
+func (w *icsWriter) String() string {
+	return w.b.String()
+}
+
+// formatICSTime writes a DATE-TIME in UTC
+func formatICSTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escapeICSText escapes a TEXT value such as SUMMARY. Line breaks of any
+// kind become \n and other control characters are dropped, so a value never
+// ends its line early.
+func escapeICSText(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\r", `\n`, "\n", `\n`).Replace(value)
+	return stripICSControls(value)
+}
+
+// quoteICSParam quotes a parameter value that contains separators, without
+// the control characters no parameter may hold
+func quoteICSParam(value string) string {
+	value = strings.ReplaceAll(stripICSControls(value), `"`, "'")
+	if strings.ContainsAny(value, ";:,") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// stripICSControls drops control characters other than tab, which content
+// lines cannot hold
+func stripICSControls(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\t' {
+			return -1
+		}
+		return r
+	}, value)
+}
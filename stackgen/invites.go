@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// defaultInviteTTL is how long an invite link works unless the organizer says otherwise
+const defaultInviteTTL = 14 * 24 * time.Hour
+
+// Invite records a token issued to a participant. The token itself is never
+// stored; it names its invite by TokenID, so revoking the invite kills it.
+type Invite struct {
+	UserID    string     `json:"user_id" bson:"user_id"`
+	TokenID   string     `json:"token_id" bson:"token_id"`
+	IssuedAt  time.Time  `json:"issued_at" bson:"issued_at"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// InviteRequest is the optional body of the issue endpoint
+type InviteRequest struct {
+	ExpiresInHours int `json:"expires_in_hours,omitempty"`
+}
+
+// IssuedInvite is returned once, when a token is issued
+type IssuedInvite struct {
+	Invite
+	Token string `json:"token"`
+	Link  string `json:"link"`
+}
+
+// CreatedEvent is the answer to creating an event, the only place its organizer key is shown
+type CreatedEvent struct {
+	Event
+	OrganizerKey string `json:"organizer_key"`
+}
+
+// inviteClaims is the signed part of a token
+type inviteClaims struct {
+	EventID string `json:"e"`
+	UserID  string `json:"u"`
+	TokenID string `json:"t"`
+	Expires int64  `json:"x"`
+}
+
+// inviteKey signs invite tokens; set from INVITE_SIGNING_KEY
+var inviteKey []byte
+
+// setInviteKey derives the signing key from a secret. Without one a random key
+// is used, so tokens stop working on restart and differ between pods.
+func setInviteKey(secret string) {
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+		inviteKey = key
+		return
+	}
+	key := sha256.Sum256([]byte(secret))
+	inviteKey = key[:]
+}
+
+func init() {
+	setInviteKey("")
+}
+
+// signInvite writes a token as base64url(claims).base64url(HMAC-SHA256)
+func signInvite(claims inviteClaims) string {
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, inviteKey)
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseInvite checks a token's signature and expiry and returns its claims
+func parseInvite(token string, now time.Time) (inviteClaims, error) {
+	var claims inviteClaims
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, fmt.Errorf("malformed invite token")
+	}
+	given, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return claims, fmt.Errorf("malformed invite token")
+	}
+	mac := hmac.New(sha256.New, inviteKey)
+	mac.Write([]byte(encoded))
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return claims, fmt.Errorf("invalid invite token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, fmt.Errorf("malformed invite token")
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("malformed invite token")
+	}
+	if !now.Before(time.Unix(claims.Expires, 0)) {
+		return claims, fmt.Errorf("invite token has expired")
+	}
+	return claims, nil
+}
+
+// issueInvite gives a participant a new token, revoking any they already had
+func issueInvite(event *Event, userID string, ttl time.Duration, now time.Time) (IssuedInvite, error) {
+	if userID == "" {
+		return IssuedInvite{}, fmt.Errorf("user_id is required")
+	}
+	if ttl <= 0 {
+		ttl = defaultInviteTTL
+	}
+	revokeInvite(event, userID, now)
+
+	invite := Invite{
+		UserID:    userID,
+		TokenID:   newWebhookID(8),
+		IssuedAt:  now.UTC(),
+		ExpiresAt: now.Add(ttl).UTC().Truncate(time.Second),
+	}
+	event.Invites = append(event.Invites, invite)
+	addInvitee(event, userID)
+
+	token := signInvite(invite.claims(event.ID))
+	return IssuedInvite{Invite: invite, Token: token, Link: inviteLink(event.ID, token)}, nil
+}
+
+// claims are what a token for this invite signs
+func (invite Invite) claims(eventID string) inviteClaims {
+	return inviteClaims{EventID: eventID, UserID: invite.UserID, TokenID: invite.TokenID, Expires: invite.ExpiresAt.Unix()}
+}
+
+// revokeInvite revokes a participant's live tokens and reports whether there were any
+func revokeInvite(event *Event, userID string, now time.Time) bool {
+	revoked := false
+	for i, invite := range event.Invites {
+		if invite.UserID == userID && invite.RevokedAt == nil {
+			at := now.UTC()
+			event.Invites[i].RevokedAt = &at
+			revoked = true
+		}
+	}
+	return revoked
+}
+
+// inviteLink is where a participant answers, with their token
+func inviteLink(eventID, token string) string {
+	return strings.TrimSuffix(publicURL, "/") + "/events/" + url.PathEscape(eventID) + "?token=" + url.QueryEscape(token)
+}
+
+// inviteOnly reports whether an event takes participant writes only through invite tokens
+func inviteOnly(event Event) bool {
+	return len(event.Invites) > 0
+}
+
+// requestToken is the invite token of a request, from "Authorization: Bearer" or ?token=
+func requestToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.URL.Query().Get("token")
+}
+
+// participantFor resolves whose data a request may write. A valid token binds
+// the write to its participant, whatever user the path names. Without one,
+// the organizer key writes for the path's user until invites are issued, and
+// only events from before organizer keys, with no invitees, accept anyone.
+// On failure it also returns the HTTP status to answer with.
+func participantFor(r *http.Request, event Event, pathUserID string) (string, int, error) {
+	token := requestToken(r)
+	if token == "" {
+		switch {
+		case inviteOnly(event):
+			return "", http.StatusUnauthorized, fmt.Errorf("this event needs an invite token")
+		case event.OrganizerKeyHash != "":
+			if strings.TrimSpace(r.Header.Get("X-Organizer-Key")) == "" {
+				return "", http.StatusUnauthorized, fmt.Errorf("this event needs an invite token or the organizer key")
+			}
+			if status, err := organizerFor(r, event); err != nil {
+				return "", status, err
+			}
+		case len(event.Invitees) > 0:
+			return "", http.StatusUnauthorized, fmt.Errorf("this event needs an invite token")
+		}
+		return pathUserID, 0, nil
+	}
+
+	now := clock()
+	claims, err := parseInvite(token, now)
+	if err != nil {
+		return "", http.StatusUnauthorized, err
+	}
+	if claims.EventID != event.ID {
+		return "", http.StatusForbidden, fmt.Errorf("invite token is for another event")
+	}
+	for _, invite := range event.Invites {
+		if invite.TokenID == claims.TokenID && invite.UserID == claims.UserID {
+			if invite.RevokedAt != nil {
+				return "", http.StatusForbidden, fmt.Errorf("invite token has been revoked")
+			}
+			return claims.UserID, 0, nil
+		}
+	}
+	return "", http.StatusForbidden, fmt.Errorf("invite token has been revoked")
+}
+
+// newOrganizerKey returns a secret for the organizer of a new event and the
+// hash that is stored in its place
+func newOrganizerKey() (string, string) {
+	key := newWebhookID(24)
+	return key, hashOrganizerKey(key)
+}
+
+// hashOrganizerKey is what an event keeps of its organizer key
+func hashOrganizerKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// organizerFor checks that a request carries the event's organizer key in
+// X-Organizer-Key. Events created before organizer keys existed have none to
+// check against and stay open. On failure it also returns the HTTP status to
+// answer with.
+func organizerFor(r *http.Request, event Event) (int, error) {
+	if event.OrganizerKeyHash == "" {
+		return 0, nil
+	}
+	key := strings.TrimSpace(r.Header.Get("X-Organizer-Key"))
+	if key == "" {
+		return http.StatusUnauthorized, fmt.Errorf("this action needs the event's organizer key")
+	}
+	if !hmac.Equal([]byte(hashOrganizerKey(key)), []byte(event.OrganizerKeyHash)) {
+		return http.StatusForbidden, fmt.Errorf("invalid organizer key")
+	}
+	return 0, nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestInviteTokens(t *testing.T) {
+	defer func(original []byte) { inviteKey = original }(inviteKey)
+	setInviteKey("organizer-secret")
+	now := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+
+	claims := inviteClaims{EventID: "review", UserID: "alice", TokenID: "t1", Expires: now.Add(time.Hour).Unix()}
+	token := signInvite(claims)
+	parsed, err := parseInvite(token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, claims, parsed)
+
+	// Expired, tampered with, or signed with another key
+	_, err = parseInvite(token, now.Add(time.Hour))
+	assert.ErrorContains(t, err, "expired")
+	forged := signInvite(inviteClaims{EventID: "review", UserID: "mallory", TokenID: "t1", Expires: claims.Expires})
+	payload, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(token, ".")
+	_, err = parseInvite(payload+"."+signature, now)
+	assert.ErrorContains(t, err, "invalid")
+	_, err = parseInvite("not-a-token", now)
+	assert.Error(t, err)
+
+	setInviteKey("another-secret")
+	_, err = parseInvite(token, now)
+	assert.ErrorContains(t, err, "invalid")
+}
+
+func TestIssueAndRevokeInvites(t *testing.T) {
+	now := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+	event := Event{ID: "review"}
+
+	first, err := issueInvite(&event, "alice", 0, now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(defaultInviteTTL), first.ExpiresAt)
+	token, _ := url.ParseQuery(strings.SplitN(first.Link, "?", 2)[1])
+	assert.Equal(t, first.Token, token.Get("token"))
+
+	// Reissuing revokes the earlier token
+	second, err := issueInvite(&event, "alice", 48*time.Hour, now)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.TokenID, second.TokenID)
+	assert.Equal(t, now.Add(48*time.Hour), second.ExpiresAt)
+	assert.Len(t, event.Invites, 2)
+	assert.NotNil(t, event.Invites[0].RevokedAt)
+	assert.Nil(t, event.Invites[1].RevokedAt)
+
+	assert.True(t, revokeInvite(&event, "alice", now))
+	assert.False(t, revokeInvite(&event, "alice", now))
+	assert.False(t, revokeInvite(&event, "bob", now))
+
+	_, err = issueInvite(&event, "", 0, now)
+	assert.Error(t, err)
+}
+
+func TestParticipantFor(t *testing.T) {
+	now := time.Now()
+	open := Event{ID: "standup"}
+	event := Event{ID: "review"}
+	alice, _ := issueInvite(&event, "alice", 0, now)
+	bob, _ := issueInvite(&event, "bob", 0, now)
+	other := Event{ID: "other"}
+	carol, _ := issueInvite(&other, "carol", 0, now)
+
+	request := func(token, header string) *http.Request {
+		r := httptest.NewRequest("PUT", "/events/review/availability/mallory?token="+url.QueryEscape(token), nil)
+		if header != "" {
+			r.Header.Set("Authorization", "Bearer "+header)
+		}
+		return r
+	}
+
+	// Events from before organizer keys stay open to the path's user
+	userID, _, err := participantFor(request("", ""), open, "mallory")
+	assert.NoError(t, err)
+	assert.Equal(t, "mallory", userID)
+
+	// Once invites exist a token is needed, and it decides the user
+	_, status, err := participantFor(request("", ""), event, "mallory")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	userID, _, err = participantFor(request(alice.Token, ""), event, "mallory")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+	userID, _, err = participantFor(request("", bob.Token), event, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", userID)
+
+	_, status, err = participantFor(request(carol.Token, ""), event, "carol")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	revokeInvite(&event, "alice", now)
+	_, status, err = participantFor(request(alice.Token, ""), event, "alice")
+	assert.ErrorContains(t, err, "revoked")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	_, status, _ = participantFor(request(alice.Token+"x", ""), event, "alice")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Before any invite is out, an event with invitees or an organizer key
+	// takes writes only from its organizer
+	key, hash := newOrganizerKey()
+	for _, pending := range []Event{
+		{ID: "planning", Invitees: []string{"alice"}},
+		{ID: "planning", OrganizerKeyHash: hash},
+		{ID: "planning", OrganizerKeyHash: hash, Invitees: []string{"alice"}},
+	} {
+		_, status, err = participantFor(request("", ""), pending, "mallory")
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+
+	planning := Event{ID: "planning", OrganizerKeyHash: hash, Invitees: []string{"alice"}}
+	organizer := request("", "")
+	organizer.Header.Set("X-Organizer-Key", key)
+	userID, _, err = participantFor(organizer, planning, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+
+	organizer.Header.Set("X-Organizer-Key", key+"x")
+	_, status, _ = participantFor(organizer, planning, "alice")
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestOrganizerFor(t *testing.T) {
+	key, hash := newOrganizerKey()
+	event := Event{ID: "review", OrganizerKeyHash: hash}
+
+	request := func(key string) *http.Request {
+		r := httptest.NewRequest("POST", "/events/review/invites/alice", nil)
+		if key != "" {
+			r.Header.Set("X-Organizer-Key", key)
+		}
+		return r
+	}
+
+	status, err := organizerFor(request(key), event)
+	assert.NoError(t, err)
+	assert.Zero(t, status)
+
+	status, err = organizerFor(request(""), event)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = organizerFor(request(key+"x"), event)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// An invite token is not the organizer's key
+	issued, _ := issueInvite(&event, "alice", 0, time.Now())
+	status, _ = organizerFor(request(issued.Token), event)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Only the hash is kept, and it is never sent back
+	assert.NotContains(t, hash, key)
+	payload, _ := json.Marshal(event)
+	assert.NotContains(t, string(payload), hash)
+
+	// Events from before organizer keys stay open
+	_, err = organizerFor(request(""), Event{ID: "legacy"})
+	assert.NoError(t, err)
+}
+
+func TestOrganizerOnlyHandlers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer func(original *mongo.Collection) { eventsCollection = original }(eventsCollection)
+	key, hash := newOrganizerKey()
+	stored := bson.D{{Key: "_id", Value: "review"}, {Key: "status", Value: StatusPolling}, {Key: "organizer_key_hash", Value: hash}}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}", handleEvent).Methods("PUT")
+	router.HandleFunc("/events/{id}", deleteEvent).Methods("DELETE")
+	router.HandleFunc("/events/{id}/open", openPolling).Methods("POST")
+	router.HandleFunc("/events/{id}/confirm", confirmChosenSlot).Methods("POST")
+	router.HandleFunc("/events/{id}/reopen", reopenEvent).Methods("POST")
+	router.HandleFunc("/events/{id}/cancel", cancelEvent).Methods("POST")
+
+	requests := []struct{ method, path, body string }{
+		{"PUT", "/events/review", `{"duration_mins": 30, "slots": []}`},
+		{"DELETE", "/events/review", ""},
+		{"POST", "/events/review/open", ""},
+		{"POST", "/events/review/confirm", `{"recommendation_id": "x"}`},
+		{"POST", "/events/review/reopen", ""},
+		{"POST", "/events/review/cancel", ""},
+	}
+	// Every organizer-only change is refused before anything is written
+	for _, given := range []struct {
+		name   string
+		key    string
+		status int
+	}{{"No Key", "", http.StatusUnauthorized}, {"Wrong Key", key + "x", http.StatusForbidden}} {
+		for _, request := range requests {
+			mt.Run(given.name+" "+request.method+" "+request.path, func(mt *mtest.T) {
+				eventsCollection = mt.Coll
+				mt.AddMockResponses(mtest.CreateCursorResponse(1, "db.events", mtest.FirstBatch, stored))
+
+				r := httptest.NewRequest(request.method, request.path, strings.NewReader(request.body))
+				if given.key != "" {
+					r.Header.Set("X-Organizer-Key", given.key)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, r)
+				assert.Equal(mt, given.status, w.Code, w.Body.String())
+			})
+		}
+	}
+}
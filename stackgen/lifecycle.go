@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Event lifecycle states. Events without a status are drafts.
+const (
+	StatusDraft     = "draft"     // Being set up by the organiser
+	StatusPolling   = "polling"   // Collecting availability
+	StatusConfirmed = "confirmed" // Time locked in as scheduled_slot
+	StatusCancelled = "cancelled"
+)
+
+// eventTransitions lists the states each state may move to
+var eventTransitions = map[string][]string{
+	StatusDraft:     {StatusPolling, StatusConfirmed, StatusCancelled},
+	StatusPolling:   {StatusConfirmed, StatusCancelled},
+	StatusConfirmed: {StatusPolling, StatusCancelled},
+	StatusCancelled: {StatusPolling},
+}
+
+// ConfirmRequest picks the slot to lock in: a recommendation by its id, or an explicit slot
+type ConfirmRequest struct {
+	RecommendationID string    `json:"recommendation_id,omitempty"`
+	Slot             *TimeSlot `json:"slot,omitempty"`
+}
+
+// eventStatus is the event's state, treating a missing status as draft
+func eventStatus(event Event) string {
+	if event.Status == "" {
+		return StatusDraft
+	}
+	return event.Status
+}
+
+// transitionEvent moves an event to a new state if the lifecycle allows it.
+// Reopening releases the confirmed slot and the RSVPs to it; cancelling keeps
+// it so calendars can be told which meeting was called off. Every move bumps
+// the sequence, so calendars take the re-exported meeting as a newer revision.
+func transitionEvent(event *Event, to string) error {
+	from := eventStatus(*event)
+	allowed := false
+	for _, next := range eventTransitions[from] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("cannot move event from %s to %s", from, to)
+	}
+
+	if to == StatusPolling && from != StatusDraft {
+		event.ScheduledSlot = nil
+		event.ConfirmedAt = nil
+		event.Booked = nil
+		event.RSVPs = nil
+	}
+	event.Status = to
+	event.Sequence++
+	return nil
+}
+
+// confirmEvent locks in a slot, with the resource booked for it if any, and
+// marks the event confirmed
+func confirmEvent(event *Event, slot TimeSlot, booked *AssignedResource, at time.Time) error {
+	if !slot.Start_UTC.Before(slot.End_UTC) {
+		return fmt.Errorf("slot must end after it starts")
+	}
+	if err := transitionEvent(event, StatusConfirmed); err != nil {
+		return err
+	}
+	slot.StartStr, slot.EndStr = "", ""
+	event.ScheduledSlot = &slot
+	event.ConfirmedAt = &at
+	event.Booked = booked
+	return nil
+}
+
+// chooseSlot resolves a confirm request against the event's recommendations,
+// returning the resource a chosen recommendation booked. An explicit slot must
+// lie inside one of the event's slots and has no resource booked yet.
+func chooseSlot(event Event, request ConfirmRequest, recommendations []SlotRecommendation) (TimeSlot, *AssignedResource, error) {
+	switch {
+	case request.RecommendationID != "" && request.Slot != nil:
+		return TimeSlot{}, nil, fmt.Errorf("give either recommendation_id or slot, not both")
+	case request.RecommendationID != "":
+		for _, rec := range recommendations {
+			if rec.ID == request.RecommendationID {
+				return rec.Slot, rec.Resource, nil
+			}
+		}
+		return TimeSlot{}, nil, fmt.Errorf("recommendation not found: %s", request.RecommendationID)
+	case request.Slot != nil:
+		for _, eventSlot := range event.Slots {
+			if !request.Slot.Start_UTC.Before(eventSlot.Start_UTC) && !request.Slot.End_UTC.After(eventSlot.End_UTC) {
+				return *request.Slot, nil, nil
+			}
+		}
+		return TimeSlot{}, nil, fmt.Errorf("slot lies outside the event's slots")
+	}
+	return TimeSlot{}, nil, fmt.Errorf("recommendation_id or slot is required")
+}
+
+// acceptsAvailability reports whether participants may still change their availability
+func acceptsAvailability(event Event) error {
+	switch eventStatus(event) {
+	case StatusConfirmed:
+		return fmt.Errorf("event is confirmed; reopen it to change availability")
+	case StatusCancelled:
+		return fmt.Errorf("event is cancelled")
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestEventLifecycleTransitions(t *testing.T) {
+	event := Event{}
+	assert.Equal(t, StatusDraft, eventStatus(event))
+	assert.NoError(t, acceptsAvailability(event))
+
+	assert.NoError(t, transitionEvent(&event, StatusPolling))
+	assert.Error(t, transitionEvent(&event, StatusDraft))
+	assert.Equal(t, 1, event.Sequence)
+
+	confirmedAt := time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC)
+	slot := utcSlot("2025-01-15 10:00", "2025-01-15 11:00")
+	slot.StartStr = "15 Jan 2025, 10:00AM"
+	assert.NoError(t, confirmEvent(&event, slot, nil, confirmedAt))
+	assert.Equal(t, StatusConfirmed, event.Status)
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 11:00"), *event.ScheduledSlot)
+	assert.Equal(t, confirmedAt, *event.ConfirmedAt)
+	assert.Equal(t, 2, event.Sequence)
+	assert.Error(t, acceptsAvailability(event))
+
+	// Confirming twice needs a reopen in between
+	assert.Error(t, confirmEvent(&event, slot, nil, confirmedAt))
+	assert.Equal(t, 2, event.Sequence)
+
+	assert.NoError(t, transitionEvent(&event, StatusPolling))
+	assert.Equal(t, 3, event.Sequence)
+	assert.Nil(t, event.ScheduledSlot)
+	assert.Nil(t, event.ConfirmedAt)
+	assert.NoError(t, acceptsAvailability(event))
+
+	// A booked resource is held while confirmed and released on reopening
+	room := &AssignedResource{ID: "room-a", Name: "Room A", Capacity: 4}
+	assert.NoError(t, confirmEvent(&event, slot, room, confirmedAt))
+	assert.Equal(t, room, event.Booked)
+	assert.NoError(t, transitionEvent(&event, StatusPolling))
+	assert.Nil(t, event.Booked)
+
+	// Cancelling keeps the slot that was called off
+	assert.NoError(t, confirmEvent(&event, slot, nil, confirmedAt))
+	assert.NoError(t, transitionEvent(&event, StatusCancelled))
+	assert.NotNil(t, event.ScheduledSlot)
+	assert.Equal(t, 7, event.Sequence)
+	assert.Error(t, acceptsAvailability(event))
+	assert.Error(t, transitionEvent(&event, StatusConfirmed))
+	assert.NoError(t, transitionEvent(&event, StatusPolling))
+
+	assert.Error(t, confirmEvent(&Event{}, TimeSlot{}, nil, confirmedAt))
+}
+
+func TestChooseSlot(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 11:00", "2025-01-15 17:00")),
+		},
+	}
+	recs := optimalSlots(t, event, 0)
+
+	slot, booked, err := chooseSlot(event, ConfirmRequest{RecommendationID: recs[1].ID}, recs)
+	assert.NoError(t, err)
+	assert.Equal(t, recs[1].Slot, slot)
+	assert.Nil(t, booked)
+
+	// The resource a recommendation booked comes with it
+	room := &AssignedResource{ID: "room-a", Name: "Room A", Capacity: 4}
+	recs[1].Resource = room
+	_, booked, err = chooseSlot(event, ConfirmRequest{RecommendationID: recs[1].ID}, recs)
+	assert.NoError(t, err)
+	assert.Equal(t, room, booked)
+
+	_, _, err = chooseSlot(event, ConfirmRequest{RecommendationID: "missing"}, recs)
+	assert.Error(t, err)
+
+	explicit := utcSlot("2025-01-15 15:00", "2025-01-15 16:00")
+	slot, _, err = chooseSlot(event, ConfirmRequest{Slot: &explicit}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, explicit, slot)
+
+	outside := utcSlot("2025-01-15 16:30", "2025-01-15 17:30")
+	_, _, err = chooseSlot(event, ConfirmRequest{Slot: &outside}, nil)
+	assert.Error(t, err)
+
+	_, _, err = chooseSlot(event, ConfirmRequest{}, recs)
+	assert.Error(t, err)
+	_, _, err = chooseSlot(event, ConfirmRequest{RecommendationID: recs[0].ID, Slot: &explicit}, recs)
+	assert.Error(t, err)
+}
+
+func TestUpdateEventReplacesDocument(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer func(original *mongo.Collection) { eventsCollection = original }(eventsCollection)
+	key, hash := newOrganizerKey()
+	stored := bson.D{
+		{Key: "_id", Value: "review"},
+		{Key: "status", Value: StatusPolling},
+		{Key: "sequence", Value: 2},
+		{Key: "organizer_key_hash", Value: hash},
+		{Key: "min_attendees", Value: bson.D{{Key: "count", Value: 2}}},
+		{Key: "strategy", Value: "earliest"},
+		{Key: "invites", Value: bson.A{bson.D{{Key: "user_id", Value: "ana"}, {Key: "token_id", Value: "t1"}}}},
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/events/{id}", handleEvent).Methods("PUT")
+
+	// A field set before and left out of the update is cleared, while the
+	// fields only the endpoints change are kept
+	mt.Run("Omitted Fields", func(mt *mtest.T) {
+		eventsCollection = mt.Coll
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, stored),
+			mtest.CreateSuccessResponse(),
+		)
+		r := httptest.NewRequest("PUT", "/events/review", strings.NewReader(`{"duration_mins": 30, "slots": []}`))
+		r.Header.Set("X-Organizer-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+
+		written := replacedEvent(mt)
+		for _, field := range []string{"min_attendees", "strategy"} {
+			_, err := written.LookupErr(field)
+			assert.Error(mt, err, field)
+		}
+		assert.Equal(mt, hash, written.Lookup("organizer_key_hash").StringValue())
+		assert.Equal(mt, StatusPolling, written.Lookup("status").StringValue())
+		assert.Equal(mt, int64(2), written.Lookup("sequence").AsInt64())
+		assert.Equal(mt, "ana", written.Lookup("invites", "0", "user_id").StringValue())
+	})
+
+	// Buffers set back to zero are stored as none, not left as they were
+	mt.Run("Zero Buffers", func(mt *mtest.T) {
+		eventsCollection = mt.Coll
+		buffered := append(bson.D{{Key: "buffer_before_mins", Value: 15}, {Key: "buffer_after_mins", Value: 10}}, stored...)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, buffered),
+			mtest.CreateSuccessResponse(),
+		)
+		body := `{"duration_mins": 30, "buffer_before_mins": 0, "buffer_after_mins": 0, "slots": []}`
+		r := httptest.NewRequest("PUT", "/events/review", strings.NewReader(body))
+		r.Header.Set("X-Organizer-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+
+		written := replacedEvent(mt)
+		for _, field := range []string{"buffer_before_mins", "buffer_after_mins"} {
+			_, err := written.LookupErr(field)
+			assert.Error(mt, err, field)
+		}
+	})
+}
+
+// replacedEvent is the document the last update command stored
+func replacedEvent(mt *mtest.T) bson.Raw {
+	mt.Helper()
+	var written bson.Raw
+	for _, started := range mt.GetAllStartedEvents() {
+		if started.CommandName == "update" {
+			written = started.Command.Lookup("updates", "0", "u").Document()
+		}
+	}
+	assert.NotNil(mt, written)
+	return written
+}
@@ -16,6 +16,11 @@ import (
 
 var client *mongo.Client
 var eventsCollection *mongo.Collection
+var resourcesCollection *mongo.Collection
+var calendarAccountsCollection *mongo.Collection
+var webhooksCollection *mongo.Collection
+var webhookDeliveriesCollection *mongo.Collection
+var outboxCollection *mongo.Collection
 
 func getEnv(key, defaultValue string) string {
 	value, exists := os.LookupEnv(key)
@@ -62,6 +67,43 @@ func main() {
 	mongoURI := getEnv("MONGO_URI", "mongodb://localhost:27017")
 	dbName := getEnv("DB_NAME", "meetingScheduler")
 	port := getEnv("PORT", "8082")
+
+	// Calendar passwords are sealed at rest when a key is configured
+	setCredentialsKey(os.Getenv("CALENDAR_CREDENTIALS_KEY"))
+
+	// Email through SMTP when a server is configured
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		var err error
+		mailer, err = newSMTPMailer(host, os.Getenv("SMTP_PORT"), os.Getenv("SMTP_TLS"),
+			os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), getEnv("SMTP_FROM", "scheduler@localhost"))
+		if err != nil {
+			log.Fatal("Failed to configure email:", err)
+		}
+	}
+	publicURL = getEnv("PUBLIC_URL", "http://localhost:"+port)
+	if dir := os.Getenv("EMAIL_TEMPLATE_DIR"); dir != "" {
+		var err error
+		if mailTemplates, err = parseEmailTemplates(os.DirFS(dir), "."); err != nil {
+			log.Fatal("Failed to load email templates:", err)
+		}
+	}
+
+	// Invite tokens only survive restarts, and work across pods, with a shared key
+	if secret := os.Getenv("INVITE_SIGNING_KEY"); secret != "" {
+		setInviteKey(secret)
+	} else {
+		log.Println("INVITE_SIGNING_KEY is not set; invite tokens are signed with a random key")
+	}
+
+	// Webhooks for every event are managed with the admin key
+	adminKey = os.Getenv("ADMIN_API_KEY")
+
+	// Extra holiday calendars on top of the bundled ones
+	if dir := os.Getenv("HOLIDAY_DIR"); dir != "" {
+		if err := loadHolidayCalendars(os.DirFS(dir), "."); err != nil {
+			log.Fatal("Failed to load holiday calendars:", err)
+		}
+	}
 	
 	clientOptions := options.Client().ApplyURI(mongoURI)
 	var err error
@@ -77,6 +119,38 @@ func main() {
 
 	fmt.Println("Connected to MongoDB at", mongoURI)
 	eventsCollection = client.Database(dbName).Collection("events")
+	resourcesCollection = client.Database(dbName).Collection("resources")
+	calendarAccountsCollection = client.Database(dbName).Collection("calendar_accounts")
+	webhooksCollection = client.Database(dbName).Collection("webhooks")
+	webhookDeliveriesCollection = client.Database(dbName).Collection("webhook_deliveries")
+	outboxCollection = client.Database(dbName).Collection("outbox")
+
+	// Changes and their outbox messages share a transaction when MongoDB runs
+	// as a replica set; writing them apart has to be asked for
+	outboxTransactions = supportsTransactions(ctx, client)
+	outboxNonAtomic = os.Getenv("OUTBOX_ALLOW_NON_ATOMIC") == "true"
+	if !outboxTransactions {
+		if !outboxNonAtomic {
+			log.Fatal("MongoDB does not support transactions; run it as a replica set, or set OUTBOX_ALLOW_NON_ATOMIC=true to write outbox messages after their changes")
+		}
+		log.Println("MongoDB does not support transactions; outbox messages are written after their changes")
+	}
+	if err := ensureOutboxIndexes(ctx); err != nil {
+		log.Fatal("Failed to create outbox indexes:", err)
+	}
+
+	// Deliver outbox messages to the configured sinks in the background
+	outbox.store = mongoOutboxStore{}
+	if outbox.sinks, err = outboxSinks(getEnv("OUTBOX_SINKS", "webhook")); err != nil {
+		log.Fatal("Failed to configure outbox:", err)
+	}
+	if mailer != nil {
+		outbox.sinks = append(outbox.sinks, emailSink{mailer})
+	}
+	if err := outbox.configureRetries(os.Getenv("OUTBOX_MAX_ATTEMPTS"), os.Getenv("OUTBOX_RETRY_BACKOFF"), os.Getenv("OUTBOX_MAX_BACKOFF")); err != nil {
+		log.Fatal("Failed to configure outbox:", err)
+	}
+	go outbox.run(context.Background(), 2*time.Second)
 	
 	defer func() {
 		if err = client.Disconnect(context.Background()); err != nil {
@@ -90,16 +164,76 @@ func main() {
 	router.HandleFunc("/health", healthCheck).Methods("GET")
 
 	// Event endpoints
+	router.HandleFunc("/events/{id}.ics", getEventICS).Methods("GET") // Before /events/{id}, which would also match
 	router.HandleFunc("/events/{id}", handleEvent).Methods("POST", "PUT")
 	router.HandleFunc("/events/{id}", getEvent).Methods("GET")
 	router.HandleFunc("/events/{id}", deleteEvent).Methods("DELETE")
 
+	// Event lifecycle: draft -> polling -> confirmed, reopen and cancel
+	router.HandleFunc("/events/{id}/open", openPolling).Methods("POST")
+	router.HandleFunc("/events/{id}/confirm", confirmChosenSlot).Methods("POST")
+	router.HandleFunc("/events/{id}/reopen", reopenEvent).Methods("POST")
+	router.HandleFunc("/events/{id}/cancel", cancelEvent).Methods("POST")
+
+	// Who has and hasn't given availability
+	router.HandleFunc("/events/{id}/responses", getEventResponses).Methods("GET")
+
+	// Per-participant invite tokens
+	router.HandleFunc("/events/{id}/invites", listInvites).Methods("GET")
+	router.HandleFunc("/events/{id}/invites/{user_id}", issueParticipantInvite).Methods("POST")
+	router.HandleFunc("/events/{id}/invites/{user_id}", revokeParticipantInvite).Methods("DELETE")
+
+	// Answers to the confirmed time
+	router.HandleFunc("/events/{id}/rsvp/{user_id}", handleRSVP).Methods("POST", "PUT")
+	router.HandleFunc("/events/{id}/rsvp/{user_id}", getRSVP).Methods("GET")
+	router.HandleFunc("/events/{id}/rsvp/{user_id}", deleteRSVP).Methods("DELETE")
+
+	// Email invitations and reminders; confirmations are sent by /confirm
+	router.HandleFunc("/events/{id}/invitations", sendInvitations).Methods("POST")
+	router.HandleFunc("/events/{id}/reminders", sendReminders).Methods("POST")
+
 	// User availability endpoints
 	router.HandleFunc("/events/{id}/availability/{user_id}", handleUserAvailability).Methods("POST", "PUT")
 	router.HandleFunc("/events/{id}/availability/{user_id}", deleteUserAvailability).Methods("DELETE")
+	router.HandleFunc("/events/{id}/availability/{user_id}/ics", importUserAvailabilityICS).Methods("POST")
+	router.HandleFunc("/events/{id}/availability/{user_id}/sync", syncUserAvailability).Methods("POST")
+
+	// Calendar accounts users connect for availability sync
+	router.HandleFunc("/events/{id}/availability/{user_id}/calendar", handleCalendarAccount).Methods("PUT")
+	router.HandleFunc("/events/{id}/availability/{user_id}/calendar", getCalendarAccount).Methods("GET")
+	router.HandleFunc("/events/{id}/availability/{user_id}/calendar", deleteCalendarAccount).Methods("DELETE")
 
 	// Recommendation endpoint
 	router.HandleFunc("/events/{id}/recommendations", getRecommendations).Methods("GET")
+	router.HandleFunc("/events/{id}/recommendations/explain", getRecommendationExplanation).Methods("GET")
+	router.HandleFunc("/events/{id}/recommendations/durations", getDurationOptions).Methods("GET")
+
+	// Availability views
+	router.HandleFunc("/events/{id}/heatmap", getHeatmap).Methods("GET")
+	router.HandleFunc("/events/{id}/windows", getFreeWindows).Methods("GET")
+
+	// Fairness across occurrences of a recurring meeting
+	router.HandleFunc("/events/{id}/fairness", getFairness).Methods("GET")
+
+	// Resource endpoints
+	router.HandleFunc("/resources", listResources).Methods("GET")
+	router.HandleFunc("/resources/{id}", handleResource).Methods("POST", "PUT")
+	router.HandleFunc("/resources/{id}", getResource).Methods("GET")
+	router.HandleFunc("/resources/{id}", deleteResource).Methods("DELETE")
+
+	// Webhook subscriptions and their delivery log
+	router.HandleFunc("/webhooks", listWebhooks).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", handleWebhook).Methods("POST", "PUT")
+	router.HandleFunc("/webhooks/{id}", getWebhook).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", deleteWebhook).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", getWebhookDeliveries).Methods("GET")
+
+	// Holiday calendars
+	router.HandleFunc("/holidays", listHolidayRegions).Methods("GET")
+	router.HandleFunc("/holidays/{region}", getHolidayCalendar).Methods("GET")
+
+	// Joint scheduling across events
+	router.HandleFunc("/schedule/batch", handleBatchSchedule).Methods("POST")
 
 	fmt.Println("Server started on port", port)
 	log.Fatal(http.ListenAndServe(":"+port, router))
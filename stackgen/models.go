@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -83,20 +85,172 @@ func parseTimeInLocation(timeStr string, loc *time.Location) (time.Time, error)
 type UserAvailability struct {
 	UserID string     `json:"user_id" bson:"user_id"`
 	Slots  []TimeSlot `json:"slots" bson:"slots"`
+	Region string     `json:"region,omitempty" bson:"region,omitempty"` // Holiday calendar, e.g. "US" or "GB"
 }
 
 type Event struct {
-	ID           string             `json:"id" bson:"_id"`
-	Title        string             `json:"title" bson:"title"`
-	DurationMins int                `json:"duration_mins" bson:"duration_mins"`
-	Slots        []TimeSlot         `json:"slots" bson:"slots"`
-	UserSlots    []UserAvailability `json:"user_slots" bson:"user_slots"`
+	ID            string               `json:"id" bson:"_id"`
+	Title         string               `json:"title" bson:"title"`
+	DurationMins  int                  `json:"duration_mins" bson:"duration_mins"`
+	DurationsMins []int                `json:"durations_mins,omitempty" bson:"durations_mins,omitempty"`       // Acceptable lengths, instead of a min/max range
+	MinDuration   int                  `json:"min_duration_mins,omitempty" bson:"min_duration_mins,omitempty"` // Shortest acceptable length
+	MaxDuration   int                  `json:"max_duration_mins,omitempty" bson:"max_duration_mins,omitempty"` // Longest useful length, 0 for no limit
+	MinAttendees  *AttendeeThreshold   `json:"min_attendees,omitempty" bson:"min_attendees,omitempty"`
+	BufferBefore  int                  `json:"buffer_before_mins,omitempty" bson:"buffer_before_mins,omitempty"` // Free time each attendee needs before the meeting
+	BufferAfter   int                  `json:"buffer_after_mins,omitempty" bson:"buffer_after_mins,omitempty"`   // Free time each attendee needs after the meeting
+	Series        *SeriesConfig        `json:"series,omitempty" bson:"series,omitempty"`                         // Schedule several sessions instead of one meeting
+	RecurringID   string               `json:"recurring_id,omitempty" bson:"recurring_id,omitempty"`             // Links occurrences of a recurring meeting
+	ScheduledSlot *TimeSlot            `json:"scheduled_slot,omitempty" bson:"scheduled_slot,omitempty"`         // When this occurrence takes place
+	Strategy      string               `json:"strategy,omitempty" bson:"strategy,omitempty"`                     // Registered scorer that ranks recommendations
+	UserWeights   map[string]float64   `json:"user_weights,omitempty" bson:"user_weights,omitempty"`             // Used by the weighted strategy
+	Resource      *ResourceRequirement `json:"resource,omitempty" bson:"resource,omitempty"`                     // Room or equipment every recommendation must book
+	MinNotice     int                  `json:"min_notice_mins,omitempty" bson:"min_notice_mins,omitempty"`       // Meetings start at least this long after scheduling
+	NotBefore     *time.Time           `json:"not_before,omitempty" bson:"not_before,omitempty"`                 // No meeting starts before this time
+	HolidayPolicy string               `json:"holiday_policy,omitempty" bson:"holiday_policy,omitempty"`         // exclude (default), penalize or ignore
+	Status        string               `json:"status,omitempty" bson:"status,omitempty"`                         // draft, polling, confirmed or cancelled
+	ConfirmedAt   *time.Time           `json:"confirmed_at,omitempty" bson:"confirmed_at,omitempty"`             // When scheduled_slot was locked in
+	Sequence      int                  `json:"sequence,omitempty" bson:"sequence,omitempty"`                     // Revision of the exported meeting, bumped on every lifecycle change
+	Booked        *AssignedResource    `json:"assigned_resource,omitempty" bson:"assigned_resource,omitempty"`   // Resource booked for scheduled_slot
+	RSVPs         []RSVP               `json:"rsvps,omitempty" bson:"rsvps,omitempty"`                           // Answers to the confirmed time
+	RejectedSlots []RejectedSlot       `json:"rejected_slots,omitempty" bson:"rejected_slots,omitempty"`         // Times given up after declines; the decliners count as busy then
+	RequiredUsers []string             `json:"required_users,omitempty" bson:"required_users,omitempty"`         // Whose declines count, default everyone
+	MaxDeclines   int                  `json:"max_declines,omitempty" bson:"max_declines,omitempty"`             // Reopen for polling once this many required users decline
+	Invitees      []string             `json:"invitees,omitempty" bson:"invitees,omitempty"`                     // Everyone expected to give availability
+	Invites       []Invite             `json:"invites,omitempty" bson:"invites,omitempty"`                       // Participant tokens; once issued, writes need one
+	Slots         []TimeSlot           `json:"slots" bson:"slots"`
+	UserSlots     []UserAvailability   `json:"user_slots" bson:"user_slots"`
+	// Hash of the key returned to the organizer on creation; never sent back
+	OrganizerKeyHash string `json:"-" bson:"organizer_key_hash,omitempty"`
+
+	// Cumulative inconvenience per user from earlier occurrences, loaded for scheduling only
+	inconvenienceHistory map[string]int
+	// When scheduling runs, stamped by handlers from clock; zero skips min_notice_mins
+	now time.Time
+}
+
+// AttendeeThreshold is the quorum a slot must reach to be recommended, given
+// either as an absolute count (5) or as a percentage of respondents ("60%")
+type AttendeeThreshold struct {
+	Count   int     `bson:"count,omitempty"`
+	Percent float64 `bson:"percent,omitempty"`
+}
+
+// MarshalJSON writes the threshold back in the same shape it was given
+func (a AttendeeThreshold) MarshalJSON() ([]byte, error) {
+	if a.Percent > 0 {
+		return json.Marshal(strconv.FormatFloat(a.Percent, 'f', -1, 64) + "%")
+	}
+	return json.Marshal(a.Count)
+}
+
+// UnmarshalJSON accepts either a number or a string such as "5" or "60%"
+func (a *AttendeeThreshold) UnmarshalJSON(data []byte) error {
+	var count int
+	if err := json.Unmarshal(data, &count); err == nil {
+		parsed, err := parseAttendeeThreshold(strconv.Itoa(count))
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("min_attendees must be a number or a percentage string")
+	}
+	parsed, err := parseAttendeeThreshold(str)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// parseAttendeeThreshold parses "5" or "60%" into an AttendeeThreshold
+func parseAttendeeThreshold(value string) (AttendeeThreshold, error) {
+	value = strings.TrimSpace(value)
+
+	if pct, ok := strings.CutSuffix(value, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(pct), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return AttendeeThreshold{}, fmt.Errorf("invalid min_attendees percentage: %s", value)
+		}
+		return AttendeeThreshold{Percent: percent}, nil
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 1 {
+		return AttendeeThreshold{}, fmt.Errorf("invalid min_attendees: %s", value)
+	}
+	return AttendeeThreshold{Count: count}, nil
+}
+
+// resolve turns the threshold into a user count for the given number of respondents
+func (a AttendeeThreshold) resolve(totalUsers int) int {
+	if a.Percent > 0 {
+		return max(1, int(math.Ceil(a.Percent*float64(totalUsers)/100)))
+	}
+	return max(1, a.Count)
+}
+
+// validateEvent checks the scheduling settings that JSON decoding cannot
+func validateEvent(event Event) error {
+	if event.BufferBefore < 0 || event.BufferAfter < 0 {
+		return fmt.Errorf("buffer_before_mins and buffer_after_mins cannot be negative")
+	}
+	if event.MinNotice < 0 {
+		return fmt.Errorf("min_notice_mins cannot be negative")
+	}
+	if event.MaxDeclines < 0 {
+		return fmt.Errorf("max_declines cannot be negative")
+	}
+	if err := validateInvitees(event.Invitees); err != nil {
+		return err
+	}
+	if err := validateDurations(event); err != nil {
+		return err
+	}
+	if event.Resource != nil {
+		if err := validateResourceRequirement(*event.Resource); err != nil {
+			return err
+		}
+	}
+	if event.Strategy != "" {
+		if err := validateStrategy(event.Strategy); err != nil {
+			return err
+		}
+	}
+	if err := validateHolidayPolicy(event.HolidayPolicy); err != nil {
+		return err
+	}
+	for _, user := range event.UserSlots {
+		if err := validateRegion(user.Region); err != nil {
+			return err
+		}
+	}
+	if event.Series != nil {
+		return validateSeries(*event.Series)
+	}
+	return nil
 }
 
 type SlotRecommendation struct {
-	Slot             TimeSlot `json:"slot" bson:"slot"`
-	AvailableUsers   []string `json:"available_users" bson:"available_users"`
-	UnavailableUsers []string `json:"unavailable_users" bson:"unavailable_users"`
+	ID               string            `json:"id" bson:"id"` // Stable for the same slot, window and users
+	Slot             TimeSlot          `json:"slot" bson:"slot"`
+	Window           TimeSlot          `json:"window" bson:"window"` // Longest span in which all available users stay free
+	AvailableUsers   []string          `json:"available_users" bson:"available_users"`
+	UnavailableUsers []string          `json:"unavailable_users" bson:"unavailable_users"`
+	PendingUsers     []string          `json:"pending_users,omitempty" bson:"pending_users,omitempty"` // Invitees yet to give availability
+	Score            float64           `json:"score" bson:"score"`
+	Resource         *AssignedResource `json:"resource,omitempty" bson:"resource,omitempty"`
+}
+
+// RecommendationResult is the top recommendation plus how many candidate
+// starts were dropped for breaking min_notice_mins or not_before
+type RecommendationResult struct {
+	SlotRecommendation
+	PrunedTooSoon int `json:"pruned_too_soon"`
 }
 
 type Response struct {
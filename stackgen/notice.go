@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// clock returns the current time. Handlers stamp it onto events before
+// scheduling; tests replace it to fix "now".
+var clock = time.Now
+
+// earliestStart is the earliest a meeting may start: not_before, or
+// min_notice_mins after the event's scheduling time, whichever is later.
+// The zero time means there is no limit.
+func earliestStart(event Event) time.Time {
+	var earliest time.Time
+	if event.NotBefore != nil {
+		earliest = *event.NotBefore
+	}
+	if !event.now.IsZero() {
+		notice := event.now.Add(time.Duration(event.MinNotice) * time.Minute)
+		if notice.After(earliest) {
+			earliest = notice
+		}
+	}
+	return earliest
+}
+
+// clipBefore drops the part of each run that lies before cutoff
+func clipBefore(runs []freeRun, cutoff int64) []freeRun {
+	clipped := make([]freeRun, 0, len(runs))
+	for _, run := range runs {
+		if run.end <= cutoff {
+			continue
+		}
+		clipped = append(clipped, freeRun{start: max(run.start, cutoff), end: run.end})
+	}
+	return clipped
+}
+
+// tooSoonCandidates counts the candidate meeting starts that begin before
+// the earliest allowed start. Only starts the scheduler would otherwise have
+// offered count: those inside a window that fits the meeting and its quorum.
+func tooSoonCandidates(ctx context.Context, event Event) (int, error) {
+	earliest := earliestStart(event)
+	if earliest.IsZero() {
+		return 0, nil
+	}
+
+	// The same sweep the scheduler runs, as if there were no notice
+	unlimited := event
+	unlimited.NotBefore, unlimited.now = nil, time.Time{}
+	index := buildAvailabilityIndex(unlimited)
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+	if err := index.sweep(ctx, int64(meetingDuration), index.quorum(event)); err != nil {
+		return 0, err
+	}
+
+	// Windows of different sets of users overlap, so a start is counted once
+	pruned := map[time.Time]bool{}
+	for _, window := range index.windows {
+		if window.start >= earliest.UnixNano() {
+			continue
+		}
+		for _, start := range windowStarts(nanosToTime(window.start), nanosToTime(window.end), meetingDuration) {
+			if start.Before(earliest) {
+				pruned[start] = true
+			}
+		}
+	}
+	return len(pruned), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinNoticePrunesSlots(t *testing.T) {
+	now := utcSlot("2025-01-15 09:10", "2025-01-15 09:10").Start_UTC
+	event := Event{
+		DurationMins: 60,
+		MinNotice:    60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+		},
+		now: now,
+	}
+
+	// Everyone is free from 09:00, but nothing may start before 10:10
+	recs := optimalSlots(t, event, 0)
+	assert.NotEmpty(t, recs)
+	assert.Equal(t, utcSlot("2025-01-15 10:10", "2025-01-15 11:10"), recs[0].Slot)
+	assert.Equal(t, []string{"alice", "bob"}, recs[0].AvailableUsers)
+	for _, rec := range recs {
+		assert.False(t, rec.Slot.Start_UTC.Before(now.Add(time.Hour)))
+	}
+
+	// Starts 09:00, 09:30 and 10:00 are pruned
+	assert.Equal(t, 3, tooSoon(t, event))
+
+	// Time nobody could have met in is not pruned by notice
+	busyMorning := event
+	busyMorning.UserSlots = []UserAvailability{
+		userAvailability("alice", utcSlot("2025-01-15 09:45", "2025-01-15 12:00")),
+		userAvailability("bob", utcSlot("2025-01-15 14:00", "2025-01-15 17:00")),
+	}
+	assert.Equal(t, 1, tooSoon(t, busyMorning)) // Only alice's 09:45
+	busyMorning.MinAttendees = &AttendeeThreshold{Count: 2}
+	assert.Equal(t, 0, tooSoon(t, busyMorning))
+
+	// Without a scheduling time there is nothing to measure notice from
+	event.now = time.Time{}
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), optimalSlots(t, event, 1)[0].Slot)
+	assert.Equal(t, 0, tooSoon(t, event))
+}
+
+func TestNotBefore(t *testing.T) {
+	notBefore := utcSlot("2025-01-15 13:00", "2025-01-15 13:00").Start_UTC
+	event := Event{
+		DurationMins: 60,
+		NotBefore:    &notBefore,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+		},
+	}
+
+	recs := optimalSlots(t, event, 0)
+	assert.Len(t, recs, 1)
+	assert.Equal(t, utcSlot("2025-01-15 13:00", "2025-01-15 14:00"), recs[0].Slot)
+	assert.Equal(t, []string{"alice"}, recs[0].AvailableUsers)
+
+	// The later of not_before and now + min_notice wins
+	event.MinNotice = 30
+	event.now = utcSlot("2025-01-15 14:00", "2025-01-15 14:00").Start_UTC
+	assert.Equal(t, utcSlot("2025-01-15 14:30", "2025-01-15 14:30").Start_UTC, earliestStart(event))
+
+	explanation := explainedSlot(t, event, nil, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), nil)
+	assert.Contains(t, explanation.Constraints, "earliest start: 2025-01-15T14:30:00Z")
+	assert.Equal(t, 0, explanation.Rank)
+	assert.Equal(t, "slot starts before the earliest allowed start", explanation.Users[0].Reason)
+}
+
+func TestClockIsInjectable(t *testing.T) {
+	fixed := utcSlot("2025-01-15 09:00", "2025-01-15 09:00").Start_UTC
+	defer func(original func() time.Time) { clock = original }(clock)
+	clock = func() time.Time { return fixed }
+
+	event := Event{MinNotice: 15, now: clock()}
+	assert.Equal(t, fixed.Add(15*time.Minute), earliestStart(event))
+}
+
+// tooSoon runs tooSoonCandidates without a deadline
+func tooSoon(t *testing.T, event Event) int {
+	t.Helper()
+	pruned, err := tooSoonCandidates(context.Background(), event)
+	assert.NoError(t, err)
+	return pruned
+}
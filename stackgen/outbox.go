@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outbox message states
+const (
+	OutboxPending    = "pending"
+	OutboxDispatched = "dispatched"
+	OutboxFailed     = "failed"
+)
+
+// OutboxMessage is a notification written in the same transaction as the
+// change it describes. Its ID is the deduplication key: it stays the same
+// across redeliveries, so sinks and their consumers can drop repeats.
+type OutboxMessage struct {
+	ID            string     `json:"id" bson:"_id"`
+	Type          string     `json:"type" bson:"type"`
+	EventID       string     `json:"event_id" bson:"event_id"`
+	UserID        string     `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Payload       string     `json:"payload" bson:"payload"` // JSON of the change's data
+	CreatedAt     time.Time  `json:"created_at" bson:"created_at"`
+	Status        string     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LockedUntil   time.Time  `json:"locked_until" bson:"locked_until"` // Claimed by a dispatcher until then
+	DeliveredTo   []string   `json:"delivered_to" bson:"delivered_to"` // Sinks that have accepted it
+	LastError     string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	DispatchedAt  *time.Time `json:"dispatched_at,omitempty" bson:"dispatched_at,omitempty"`
+}
+
+// OutboxSink receives outbox messages. Delivery is at least once: a sink
+// may see a message again after a crash or a failure of another sink.
+type OutboxSink interface {
+	Name() string
+	Deliver(ctx context.Context, message OutboxMessage) error
+}
+
+// OutboxFailureHandler is implemented by sinks that want to know when a
+// message they did not accept has run out of attempts
+type OutboxFailureHandler interface {
+	Failed(ctx context.Context, message OutboxMessage)
+}
+
+// newOutboxMessage records a change for the outbox
+func newOutboxMessage(messageType, eventID, userID string, data interface{}, at time.Time) (OutboxMessage, error) {
+	message := OutboxMessage{
+		ID:            newWebhookID(12),
+		Type:          messageType,
+		EventID:       eventID,
+		UserID:        userID,
+		CreatedAt:     at.UTC(),
+		Status:        OutboxPending,
+		NextAttemptAt: at.UTC(),
+		LockedUntil:   at.UTC(),
+		DeliveredTo:   []string{},
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return message, err
+	}
+	message.Payload = string(payload)
+	return message, nil
+}
+
+// changeMessages builds the outbox messages of an edit: the change itself and,
+// when the edit moved the top recommendation, recommendation.changed. Only
+// edits that can move it pass the event as it was before.
+func changeMessages(ctx context.Context, messageType string, before *Event, after Event, userID string, data interface{}) ([]OutboxMessage, error) {
+	now := clock()
+	message, err := newOutboxMessage(messageType, after.ID, userID, data, now)
+	if err != nil {
+		return nil, err
+	}
+	messages := []OutboxMessage{message}
+
+	if before != nil {
+		change, ok, err := recommendationChange(ctx, *before, after)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			message, err := newOutboxMessage(WebhookRecommendationChanged, after.ID, "", change, now)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// outboxTransactions is set at startup when MongoDB supports transactions,
+// i.e. runs as a replica set or behind mongos
+var outboxTransactions bool
+
+// outboxNonAtomic is set at startup, from OUTBOX_ALLOW_NON_ATOMIC, when a
+// server without transactions may write changes and their outbox messages
+// one after the other; a message is then lost if a pod dies between them
+var outboxNonAtomic bool
+
+// errNoTransactions is returned for writes that need a transaction MongoDB cannot give
+var errNoTransactions = errors.New("MongoDB does not support transactions, which the outbox needs")
+
+// supportsTransactions asks the server whether it is part of a replica set or a mongos
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false
+	}
+	_, replicaSet := hello["setName"]
+	return replicaSet || hello["msg"] == "isdbgrid"
+}
+
+// writeWithOutbox runs a mutation and stores its outbox messages in one
+// transaction, so a change is never saved without its notifications. Without
+// transaction support the two writes only happen one after the other when
+// that was allowed at startup.
+func writeWithOutbox(ctx context.Context, mutate func(ctx context.Context) error, messages []OutboxMessage) error {
+	write := func(ctx context.Context) error {
+		if err := mutate(ctx); err != nil {
+			return err
+		}
+		if len(messages) == 0 || outboxCollection == nil {
+			return nil
+		}
+		documents := make([]interface{}, len(messages))
+		for i, message := range messages {
+			documents[i] = message
+		}
+		_, err := outboxCollection.InsertMany(ctx, documents)
+		return err
+	}
+
+	if !outboxTransactions {
+		if !outboxNonAtomic {
+			return errNoTransactions
+		}
+		if err := write(ctx); err != nil {
+			return err
+		}
+		outbox.wake()
+		return nil
+	}
+
+	session, err := client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		return nil, write(sessionCtx)
+	})
+	if err != nil {
+		return err
+	}
+	outbox.wake()
+	return nil
+}
+
+// outboxStore is where the dispatcher finds and settles messages
+type outboxStore interface {
+	// claim leases up to limit due messages, oldest first
+	claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error)
+	markDelivered(ctx context.Context, id, sink string) error
+	complete(ctx context.Context, id string, at time.Time) error
+	retry(ctx context.Context, id string, attempts int, next time.Time, lastError string) error
+	fail(ctx context.Context, id string, attempts int, lastError string) error
+}
+
+// outboxDispatcher hands outbox messages to every sink, retrying failures
+// with exponential backoff until maxAttempts
+type outboxDispatcher struct {
+	store       outboxStore
+	sinks       []OutboxSink
+	batch       int
+	lease       time.Duration // How long a claimed message is hidden from other dispatchers
+	maxAttempts int
+	backoff     time.Duration // Wait before the second attempt, doubled after each failure
+	maxBackoff  time.Duration // Longest wait between attempts, unbounded when zero
+	wakeup      chan struct{}
+}
+
+// The default retries span about three hours, so a receiver that is down
+// for a deploy or a short outage still gets its messages
+var outbox = &outboxDispatcher{
+	batch:       50,
+	lease:       time.Minute,
+	maxAttempts: 10,
+	backoff:     30 * time.Second,
+	maxBackoff:  time.Hour,
+	wakeup:      make(chan struct{}, 1),
+}
+
+// configureRetries overrides the retry policy from OUTBOX_MAX_ATTEMPTS,
+// OUTBOX_RETRY_BACKOFF and OUTBOX_MAX_BACKOFF; empty values keep the defaults
+func (d *outboxDispatcher) configureRetries(maxAttempts, backoff, maxBackoff string) error {
+	if maxAttempts != "" {
+		attempts, err := strconv.Atoi(maxAttempts)
+		if err != nil || attempts < 1 {
+			return fmt.Errorf("outbox max attempts must be a positive number: %s", maxAttempts)
+		}
+		d.maxAttempts = attempts
+	}
+	for _, setting := range []struct {
+		value  string
+		target *time.Duration
+	}{{backoff, &d.backoff}, {maxBackoff, &d.maxBackoff}} {
+		if setting.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(setting.value)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("outbox backoff must be a positive duration such as 30s or 1h: %s", setting.value)
+		}
+		*setting.target = duration
+	}
+	if d.maxBackoff > 0 && d.maxBackoff < d.backoff {
+		return fmt.Errorf("outbox max backoff cannot be shorter than the backoff")
+	}
+	return nil
+}
+
+// retryDelay is how long to wait after the given number of failed attempts
+func (d *outboxDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && (d.maxBackoff == 0 || delay < d.maxBackoff); i++ {
+		delay *= 2
+	}
+	if d.maxBackoff > 0 {
+		delay = min(delay, d.maxBackoff)
+	}
+	return delay
+}
+
+// wake makes a running dispatcher look for messages now instead of at its next tick
+func (d *outboxDispatcher) wake() {
+	select {
+	case d.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// run dispatches until ctx is cancelled, polling every interval
+func (d *outboxDispatcher) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := d.dispatchOnce(ctx)
+			if err != nil {
+				log.Println("Outbox dispatch failed:", err)
+			}
+			if err != nil || n < d.batch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wakeup:
+		}
+	}
+}
+
+// dispatchOnce claims one batch of due messages and delivers it, returning how many were claimed
+func (d *outboxDispatcher) dispatchOnce(ctx context.Context) (int, error) {
+	now := clock()
+	messages, err := d.store.claim(ctx, now, d.lease, d.batch)
+	if err != nil {
+		return 0, err
+	}
+	for _, message := range messages {
+		if err := d.dispatch(ctx, message); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// dispatch delivers one message to the sinks that have not accepted it yet
+func (d *outboxDispatcher) dispatch(ctx context.Context, message OutboxMessage) error {
+	errs := []string{}
+	for _, sink := range d.sinks {
+		if slices.Contains(message.DeliveredTo, sink.Name()) {
+			continue
+		}
+		if err := sink.Deliver(ctx, message); err != nil {
+			errs = append(errs, sink.Name()+": "+err.Error())
+			continue
+		}
+		message.DeliveredTo = append(message.DeliveredTo, sink.Name())
+		if err := d.store.markDelivered(ctx, message.ID, sink.Name()); err != nil {
+			return err
+		}
+	}
+
+	if len(errs) == 0 {
+		return d.store.complete(ctx, message.ID, clock().UTC())
+	}
+
+	attempts := message.Attempts + 1
+	lastError := strings.Join(errs, "; ")
+	if attempts >= d.maxAttempts {
+		for _, sink := range d.sinks {
+			if handler, ok := sink.(OutboxFailureHandler); ok && !slices.Contains(message.DeliveredTo, sink.Name()) {
+				handler.Failed(ctx, message)
+			}
+		}
+		return d.store.fail(ctx, message.ID, attempts, lastError)
+	}
+	next := clock().Add(d.retryDelay(attempts))
+	return d.store.retry(ctx, message.ID, attempts, next, lastError)
+}
+
+// mongoOutboxStore keeps the outbox in outboxCollection
+type mongoOutboxStore struct{}
+
+func (mongoOutboxStore) claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error) {
+	filter := bson.M{
+		"status":          OutboxPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"locked_until":    bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().SetSort(bson.M{"created_at": 1}).SetReturnDocument(options.After)
+
+	messages := []OutboxMessage{}
+	for len(messages) < limit {
+		var message OutboxMessage
+		err := outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&message)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+func (mongoOutboxStore) markDelivered(ctx context.Context, id, sink string) error {
+	_, err := outboxCollection.UpdateByID(ctx, id, bson.M{"$addToSet": bson.M{"delivered_to": sink}})
+	return err
+}
+
+func (mongoOutboxStore) complete(ctx context.Context, id string, at time.Time) error {
+	_, err := outboxCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"status": OutboxDispatched, "dispatched_at": at}})
+	return err
+}
+
+func (mongoOutboxStore) retry(ctx context.Context, id string, attempts int, next time.Time, lastError string) error {
+	_, err := outboxCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{
+		"attempts":        attempts,
+		"next_attempt_at": next,
+		"locked_until":    next,
+		"last_error":      lastError,
+	}})
+	return err
+}
+
+func (mongoOutboxStore) fail(ctx context.Context, id string, attempts int, lastError string) error {
+	_, err := outboxCollection.UpdateByID(ctx, id, bson.M{"$set": bson.M{
+		"status":     OutboxFailed,
+		"attempts":   attempts,
+		"last_error": lastError,
+	}})
+	return err
+}
+
+// ensureOutboxIndexes indexes the dispatcher's query and expires dispatched messages after a week
+func ensureOutboxIndexes(ctx context.Context) error {
+	_, err := outboxCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "dispatched_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60)},
+	})
+	return err
+}
+
+// logSink writes every message to the service log
+type logSink struct{}
+
+func (logSink) Name() string { return "log" }
+
+func (logSink) Deliver(ctx context.Context, message OutboxMessage) error {
+	log.Printf("outbox %s event=%s user=%s key=%s", message.Type, message.EventID, message.UserID, message.ID)
+	return nil
+}
+
+// MemorySink keeps delivered messages in memory, once per deduplication key.
+// It stands in for real sinks in tests and local runs.
+type MemorySink struct {
+	mu       sync.Mutex
+	name     string
+	seen     map[string]bool
+	Messages []OutboxMessage
+}
+
+func NewMemorySink(name string) *MemorySink {
+	return &MemorySink{name: name, seen: make(map[string]bool)}
+}
+
+func (s *MemorySink) Name() string { return s.name }
+
+func (s *MemorySink) Deliver(ctx context.Context, message OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[message.ID] {
+		return nil
+	}
+	s.seen[message.ID] = true
+	s.Messages = append(s.Messages, message)
+	return nil
+}
+
+var (
+	outboxSinksMu         sync.RWMutex
+	registeredOutboxSinks = map[string]func() OutboxSink{
+		"webhook": func() OutboxSink { return webhookSink{} },
+		"log":     func() OutboxSink { return logSink{} },
+		"memory":  func() OutboxSink { return NewMemorySink("memory") },
+	}
+)
+
+// RegisterOutboxSink makes a sink available to OUTBOX_SINKS under the given
+// name, replacing any sink of the same name
+func RegisterOutboxSink(name string, newSink func() OutboxSink) {
+	outboxSinksMu.Lock()
+	defer outboxSinksMu.Unlock()
+	registeredOutboxSinks[name] = newSink
+}
+
+// outboxSinks builds the sinks named in a comma separated list such as "webhook,log"
+func outboxSinks(names string) ([]OutboxSink, error) {
+	outboxSinksMu.RLock()
+	defer outboxSinksMu.RUnlock()
+	sinks := []OutboxSink{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		newSink, ok := registeredOutboxSinks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown outbox sink: %s", name)
+		}
+		sinks = append(sinks, newSink())
+	}
+	return sinks, nil
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryOutboxStore keeps the outbox in a map, leasing like the Mongo store
+type memoryOutboxStore struct {
+	mu       sync.Mutex
+	messages map[string]*OutboxMessage
+}
+
+func newMemoryOutboxStore(messages ...OutboxMessage) *memoryOutboxStore {
+	store := &memoryOutboxStore{messages: map[string]*OutboxMessage{}}
+	for _, message := range messages {
+		store.messages[message.ID] = &message
+	}
+	return store
+}
+
+func (s *memoryOutboxStore) claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []*OutboxMessage{}
+	for _, message := range s.messages {
+		if message.Status == OutboxPending && !message.NextAttemptAt.After(now) && !message.LockedUntil.After(now) {
+			due = append(due, message)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].CreatedAt.Before(due[j].CreatedAt) })
+
+	claimed := []OutboxMessage{}
+	for _, message := range due[:min(limit, len(due))] {
+		message.LockedUntil = now.Add(lease)
+		copied := *message
+		copied.DeliveredTo = slices.Clone(message.DeliveredTo)
+		claimed = append(claimed, copied)
+	}
+	return claimed, nil
+}
+
+func (s *memoryOutboxStore) markDelivered(ctx context.Context, id, sink string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains(s.messages[id].DeliveredTo, sink) {
+		s.messages[id].DeliveredTo = append(s.messages[id].DeliveredTo, sink)
+	}
+	return nil
+}
+
+func (s *memoryOutboxStore) complete(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages[id].Status = OutboxDispatched
+	s.messages[id].DispatchedAt = &at
+	return nil
+}
+
+func (s *memoryOutboxStore) retry(ctx context.Context, id string, attempts int, next time.Time, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := s.messages[id]
+	message.Attempts, message.NextAttemptAt, message.LockedUntil, message.LastError = attempts, next, next, lastError
+	return nil
+}
+
+func (s *memoryOutboxStore) fail(ctx context.Context, id string, attempts int, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	message := s.messages[id]
+	message.Status, message.Attempts, message.LastError = OutboxFailed, attempts, lastError
+	return nil
+}
+
+// flakySink fails its first failures deliveries and remembers the messages given up on
+type flakySink struct {
+	failures int
+	calls    int
+	failed   []string
+}
+
+func (s *flakySink) Name() string { return "flaky" }
+
+func (s *flakySink) Deliver(ctx context.Context, message OutboxMessage) error {
+	s.calls++
+	if s.calls <= s.failures {
+		return errors.New("receiver unavailable")
+	}
+	return nil
+}
+
+func (s *flakySink) Failed(ctx context.Context, message OutboxMessage) {
+	s.failed = append(s.failed, message.ID)
+}
+
+func outboxAt(t *testing.T, at time.Time, messageType string) OutboxMessage {
+	message, err := newOutboxMessage(messageType, "standup", "alice", UserAvailability{UserID: "alice"}, at)
+	assert.NoError(t, err)
+	return message
+}
+
+func TestOutboxDispatchesToEverySink(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	defer func(original func() time.Time) { clock = original }(clock)
+	clock = func() time.Time { return now }
+
+	first := outboxAt(t, now.Add(-2*time.Minute), WebhookAvailabilityAdded)
+	second := outboxAt(t, now.Add(-time.Minute), WebhookRecommendationChanged)
+	store := newMemoryOutboxStore(second, first)
+	audit, metrics := NewMemorySink("audit"), NewMemorySink("metrics")
+	dispatcher := &outboxDispatcher{store: store, sinks: []OutboxSink{audit, metrics}, batch: 10, lease: time.Minute, maxAttempts: 5, backoff: time.Second}
+
+	n, err := dispatcher.dispatchOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for _, sink := range []*MemorySink{audit, metrics} {
+		assert.Len(t, sink.Messages, 2)
+		assert.Equal(t, first.ID, sink.Messages[0].ID) // Oldest first
+	}
+	assert.Equal(t, OutboxDispatched, store.messages[first.ID].Status)
+	assert.Equal(t, []string{"audit", "metrics"}, store.messages[first.ID].DeliveredTo)
+
+	// Dispatched messages are not claimed again
+	n, err = dispatcher.dispatchOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	defer func(original func() time.Time) { clock = original }(clock)
+	clock = func() time.Time { return now }
+
+	message := outboxAt(t, now, WebhookEventUpdated)
+	store := newMemoryOutboxStore(message)
+	audit, flaky := NewMemorySink("audit"), &flakySink{failures: 2}
+	dispatcher := &outboxDispatcher{store: store, sinks: []OutboxSink{audit, flaky}, batch: 10, lease: time.Minute, maxAttempts: 5, backoff: time.Second}
+
+	dispatcher.dispatchOnce(context.Background())
+	stored := store.messages[message.ID]
+	assert.Equal(t, OutboxPending, stored.Status)
+	assert.Equal(t, 1, stored.Attempts)
+	assert.Equal(t, now.Add(time.Second), stored.NextAttemptAt)
+	assert.Contains(t, stored.LastError, "flaky: receiver unavailable")
+
+	// Not due yet
+	n, _ := dispatcher.dispatchOnce(context.Background())
+	assert.Equal(t, 0, n)
+
+	now = now.Add(time.Second)
+	dispatcher.dispatchOnce(context.Background())
+	assert.Equal(t, 2, stored.Attempts)
+	assert.Equal(t, now.Add(2*time.Second), stored.NextAttemptAt)
+
+	now = now.Add(2 * time.Second)
+	dispatcher.dispatchOnce(context.Background())
+	assert.Equal(t, OutboxDispatched, stored.Status)
+	assert.Equal(t, 3, flaky.calls)
+
+	// The sink that accepted the first try is not handed the message again
+	assert.Len(t, audit.Messages, 1)
+}
+
+func TestOutboxGivesUp(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	defer func(original func() time.Time) { clock = original }(clock)
+	clock = func() time.Time { return now }
+
+	message := outboxAt(t, now, WebhookEventDeleted)
+	store := newMemoryOutboxStore(message)
+	flaky := &flakySink{failures: 10}
+	dispatcher := &outboxDispatcher{store: store, sinks: []OutboxSink{flaky}, batch: 10, lease: time.Minute, maxAttempts: 3, backoff: time.Second}
+
+	for range 3 {
+		dispatcher.dispatchOnce(context.Background())
+		now = now.Add(time.Hour)
+	}
+	assert.Equal(t, OutboxFailed, store.messages[message.ID].Status)
+	assert.Equal(t, 3, store.messages[message.ID].Attempts)
+	assert.Equal(t, []string{message.ID}, flaky.failed)
+
+	n, _ := dispatcher.dispatchOnce(context.Background())
+	assert.Equal(t, 0, n)
+}
+
+func TestOutboxRetryPolicy(t *testing.T) {
+	// The defaults outlast a receiver's deploy by a wide margin
+	total := time.Duration(0)
+	for attempts := 1; attempts < outbox.maxAttempts; attempts++ {
+		total += outbox.retryDelay(attempts)
+	}
+	assert.Greater(t, total, 2*time.Hour)
+	assert.Equal(t, 30*time.Second, outbox.retryDelay(1))
+	assert.Equal(t, time.Hour, outbox.retryDelay(9))
+
+	dispatcher := &outboxDispatcher{maxAttempts: 10, backoff: 30 * time.Second, maxBackoff: time.Hour}
+	assert.NoError(t, dispatcher.configureRetries("", "", ""))
+	assert.Equal(t, 10, dispatcher.maxAttempts)
+
+	assert.NoError(t, dispatcher.configureRetries("20", "1m", "6h"))
+	assert.Equal(t, 20, dispatcher.maxAttempts)
+	assert.Equal(t, 8*time.Minute, dispatcher.retryDelay(4))
+	assert.Equal(t, 6*time.Hour, dispatcher.retryDelay(100)) // Capped rather than overflowing
+
+	assert.Error(t, dispatcher.configureRetries("0", "", ""))
+	assert.Error(t, dispatcher.configureRetries("", "soon", ""))
+	assert.Error(t, dispatcher.configureRetries("", "2h", "1h"))
+}
+
+func TestOutboxLeaseHidesClaimedMessages(t *testing.T) {
+	now := time.Date(2025, 1, 15, 9, 0, 0, 0, time.UTC)
+	store := newMemoryOutboxStore(outboxAt(t, now, WebhookEventCreated))
+
+	claimed, _ := store.claim(context.Background(), now, time.Minute, 10)
+	assert.Len(t, claimed, 1)
+
+	// A second dispatcher sees nothing until the lease runs out, then redelivers
+	claimed, _ = store.claim(context.Background(), now.Add(30*time.Second), time.Minute, 10)
+	assert.Empty(t, claimed)
+	claimed, _ = store.claim(context.Background(), now.Add(time.Minute), time.Minute, 10)
+	assert.Len(t, claimed, 1)
+}
+
+func TestMemorySinkDeduplicates(t *testing.T) {
+	sink := NewMemorySink("memory")
+	message := outboxAt(t, time.Now(), WebhookAvailabilityAdded)
+
+	assert.NoError(t, sink.Deliver(context.Background(), message))
+	assert.NoError(t, sink.Deliver(context.Background(), message))
+	assert.Len(t, sink.Messages, 1)
+}
+
+func TestChangeMessages(t *testing.T) {
+	defer func(original func() time.Time) { clock = original }(clock)
+	clock = func() time.Time { return time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC) }
+	before := Event{
+		ID:           "standup",
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots:    []UserAvailability{userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 17:00"))},
+	}
+	bob := userAvailability("bob", utcSlot("2025-01-15 14:00", "2025-01-15 17:00"))
+	after := snapshotEvent(before)
+	after.UserSlots = append(after.UserSlots, bob)
+
+	messages, err := changeMessages(context.Background(), WebhookAvailabilityAdded, &before, after, "bob", bob)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+	assert.Equal(t, WebhookAvailabilityAdded, messages[0].Type)
+	assert.Equal(t, "bob", messages[0].UserID)
+	assert.Equal(t, OutboxPending, messages[0].Status)
+	assert.Equal(t, WebhookRecommendationChanged, messages[1].Type)
+	assert.NotEqual(t, messages[0].ID, messages[1].ID)
+
+	var change struct {
+		Current struct {
+			ID string `json:"id"`
+		} `json:"current"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(messages[1].Payload), &change))
+	top, _ := topRecommendation(context.Background(), after)
+	assert.Equal(t, top.ID, change.Current.ID)
+
+	// Without a before there is nothing to compare
+	messages, err = changeMessages(context.Background(), WebhookEventCreated, nil, before, "", before)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+}
+
+func TestWriteWithOutboxNeedsTransactions(t *testing.T) {
+	defer func(transactions, nonAtomic bool) {
+		outboxTransactions, outboxNonAtomic = transactions, nonAtomic
+	}(outboxTransactions, outboxNonAtomic)
+	outboxTransactions, outboxNonAtomic = false, false
+
+	// Without transactions nothing is written unless writing apart was allowed
+	mutated := false
+	err := writeWithOutbox(context.Background(), func(ctx context.Context) error {
+		mutated = true
+		return nil
+	}, nil)
+	assert.ErrorIs(t, err, errNoTransactions)
+	assert.False(t, mutated)
+
+	outboxNonAtomic = true
+	err = writeWithOutbox(context.Background(), func(ctx context.Context) error {
+		mutated = true
+		return nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.True(t, mutated)
+}
+
+func TestOutboxSinks(t *testing.T) {
+	sinks, err := outboxSinks("webhook, log")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webhook", "log"}, []string{sinks[0].Name(), sinks[1].Name()})
+
+	sinks, err = outboxSinks("")
+	assert.NoError(t, err)
+	assert.Empty(t, sinks)
+
+	_, err = outboxSinks("webhook,kafka")
+	assert.Error(t, err)
+}
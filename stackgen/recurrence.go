@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRecurrencePeriods stops runaway rules, e.g. a daily rule starting centuries ago
+const maxRecurrencePeriods = 100000
+
+// weekdayNum is a BYDAY entry such as MO, 2TU or -1FR. N is 0 for every such weekday.
+type weekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// recurrenceRule is the subset of RFC 5545 RRULE the importer understands:
+// FREQ (DAILY to YEARLY), INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and
+// BYMONTH, plus WKST=MO, which is how weeks are counted anyway. Rules with
+// any other part are refused rather than expanded wrongly.
+type recurrenceRule struct {
+	Freq       string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []weekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRRule parses an RRULE value such as FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10
+func parseRRule(value string, loc *time.Location) (recurrenceRule, error) {
+	rule := recurrenceRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return rule, fmt.Errorf("invalid RRULE part: %s", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid INTERVAL: %s", val)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid COUNT: %s", val)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, allDay, err := parseICSTime(icsProperty{Value: val}, loc)
+			if err != nil {
+				return rule, fmt.Errorf("invalid UNTIL: %s", val)
+			}
+			// A date includes the whole day
+			if allDay {
+				until = until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				day = strings.ToUpper(strings.TrimSpace(day))
+				if len(day) < 2 {
+					return rule, fmt.Errorf("invalid BYDAY: %s", val)
+				}
+				weekday, ok := icsWeekdays[day[len(day)-2:]]
+				if !ok {
+					return rule, fmt.Errorf("invalid BYDAY: %s", val)
+				}
+				n := 0
+				if prefix := day[:len(day)-2]; prefix != "" {
+					var err error
+					if n, err = strconv.Atoi(prefix); err != nil || n == 0 {
+						return rule, fmt.Errorf("invalid BYDAY: %s", val)
+					}
+				}
+				rule.ByDay = append(rule.ByDay, weekdayNum{N: n, Day: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return rule, fmt.Errorf("invalid BYMONTHDAY: %s", val)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(month)
+				if err != nil || n < 1 || n > 12 {
+					return rule, fmt.Errorf("invalid BYMONTH: %s", val)
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(n))
+			}
+		case "WKST":
+			// Weeks start on Monday; another start changes which days an interval skips
+			if strings.ToUpper(val) != "MO" {
+				return rule, fmt.Errorf("unsupported WKST: %s", val)
+			}
+		default:
+			return rule, fmt.Errorf("unsupported RRULE part: %s", key)
+		}
+	}
+
+	switch rule.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return rule, fmt.Errorf("unsupported FREQ: %s", rule.Freq)
+	}
+	return rule, nil
+}
+
+// occurrences expands the rule from start, which is always the first
+// occurrence, and returns the starts before end in order
+func (rule recurrenceRule) occurrences(start, end time.Time) []time.Time {
+	result := []time.Time{}
+	if !start.Before(end) {
+		return result
+	}
+	result = append(result, start)
+	emitted := 1
+
+	for period := 0; period < maxRecurrencePeriods; period++ {
+		anchor := rule.periodStart(start, period)
+		if !anchor.Before(end) || (!rule.Until.IsZero() && anchor.After(rule.Until)) {
+			break
+		}
+
+		for _, day := range rule.periodDays(start, anchor) {
+			at := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			if !at.After(start) {
+				continue
+			}
+			if (rule.Count > 0 && emitted >= rule.Count) || (!rule.Until.IsZero() && at.After(rule.Until)) || !at.Before(end) {
+				return result
+			}
+			result = append(result, at)
+			emitted++
+		}
+	}
+	return result
+}
+
+// periodStart is the first day of the n-th period: the day itself, the
+// Monday of the week, or the first of the month or year
+func (rule recurrenceRule) periodStart(start time.Time, n int) time.Time {
+	y, m, d := start.Date()
+	loc := start.Location()
+	step := n * rule.Interval
+	switch rule.Freq {
+	case "DAILY":
+		return time.Date(y, m, d+step, 0, 0, 0, 0, loc)
+	case "WEEKLY":
+		monday := d - (int(start.Weekday())+6)%7
+		return time.Date(y, m, monday+7*step, 0, 0, 0, 0, loc)
+	case "MONTHLY":
+		return time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(y+step, time.January, 1, 0, 0, 0, 0, loc)
+	}
+}
+
+// periodDays lists the days of the period starting at anchor that the rule selects, in order
+func (rule recurrenceRule) periodDays(start, anchor time.Time) []time.Time {
+	switch rule.Freq {
+	case "DAILY":
+		if rule.matchesDay(anchor) {
+			return []time.Time{anchor}
+		}
+		return nil
+	case "WEEKLY":
+		days := []time.Time{}
+		for i := 0; i < 7; i++ {
+			day := anchor.AddDate(0, 0, i)
+			if rule.ByDay == nil && day.Weekday() != start.Weekday() {
+				continue
+			}
+			if rule.matchesDay(day) {
+				days = append(days, day)
+			}
+		}
+		return days
+	case "MONTHLY":
+		if rule.ByMonth != nil && !slices.Contains(rule.ByMonth, anchor.Month()) {
+			return nil
+		}
+		return rule.monthDays(start, anchor)
+	default:
+		months := rule.ByMonth
+		if months == nil {
+			months = []time.Month{start.Month()}
+		}
+		days := []time.Time{}
+		for month := time.January; month <= time.December; month++ {
+			if slices.Contains(months, month) {
+				days = append(days, rule.monthDays(start, time.Date(anchor.Year(), month, 1, 0, 0, 0, 0, anchor.Location()))...)
+			}
+		}
+		return days
+	}
+}
+
+// monthDays lists the days of the month starting at first that BYDAY and
+// BYMONTHDAY select, or the start's day of the month when neither is set
+func (rule recurrenceRule) monthDays(start, first time.Time) []time.Time {
+	length := first.AddDate(0, 1, -1).Day()
+	days := []time.Time{}
+	for d := 1; d <= length; d++ {
+		day := first.AddDate(0, 0, d-1)
+		selected := rule.ByDay != nil || rule.ByMonthDay != nil
+		if !selected && d != start.Day() {
+			continue
+		}
+		if rule.ByMonthDay != nil && !slices.ContainsFunc(rule.ByMonthDay, func(n int) bool {
+			return n == d || n == d-length-1
+		}) {
+			continue
+		}
+		if rule.ByDay != nil && !slices.ContainsFunc(rule.ByDay, func(w weekdayNum) bool {
+			if w.Day != day.Weekday() {
+				return false
+			}
+			// 2TU is the second Tuesday, -1FR the last Friday
+			nth, fromEnd := (d-1)/7+1, -((length-d)/7 + 1)
+			return w.N == 0 || w.N == nth || w.N == fromEnd
+		}) {
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// matchesDay applies BYDAY (without ordinals), BYMONTHDAY and BYMONTH to daily and weekly rules
+func (rule recurrenceRule) matchesDay(day time.Time) bool {
+	if rule.ByMonth != nil && !slices.Contains(rule.ByMonth, day.Month()) {
+		return false
+	}
+	if rule.ByDay != nil && !slices.ContainsFunc(rule.ByDay, func(w weekdayNum) bool { return w.Day == day.Weekday() }) {
+		return false
+	}
+	if rule.ByMonthDay != nil {
+		length := time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location()).Day()
+		if !slices.ContainsFunc(rule.ByMonthDay, func(n int) bool { return n == day.Day() || n == day.Day()-length-1 }) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseICSDuration parses an RFC 5545 duration such as PT1H30M, P1D or -P1W
+func parseICSDuration(value string) (time.Duration, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	var total time.Duration
+	inTime := false
+	number := ""
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			number += string(c)
+		default:
+			unit, ok := units[c]
+			// M is minutes only after T; months are not allowed in durations
+			if !ok || number == "" || (c == 'M' && !inTime) || (inTime && (c == 'W' || c == 'D')) {
+				return 0, fmt.Errorf("invalid duration: %s", value)
+			}
+			n, _ := strconv.Atoi(number)
+			total += time.Duration(n) * unit
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("invalid duration: %s", value)
+	}
+	return sign * total, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func expand(t *testing.T, rrule string, start time.Time, end time.Time) []string {
+	rule, err := parseRRule(rrule, start.Location())
+	assert.NoError(t, err)
+	formatted := []string{}
+	for _, at := range rule.occurrences(start, end) {
+		formatted = append(formatted, at.Format("2006-01-02 15:04"))
+	}
+	return formatted
+}
+
+func TestRecurrenceRules(t *testing.T) {
+	monday := time.Date(2025, 1, 6, 10, 0, 0, 0, time.UTC)
+	farAway := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, []string{"2025-01-06 10:00", "2025-01-08 10:00", "2025-01-13 10:00", "2025-01-15 10:00"},
+		expand(t, "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4", monday, farAway))
+
+	// A date UNTIL includes that day
+	assert.Equal(t, []string{"2025-01-06 10:00", "2025-01-08 10:00", "2025-01-10 10:00"},
+		expand(t, "FREQ=DAILY;INTERVAL=2;UNTIL=20250110", monday, farAway))
+
+	// Last Friday of the month
+	friday := time.Date(2025, 1, 31, 15, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{"2025-01-31 15:00", "2025-02-28 15:00", "2025-03-28 15:00"},
+		expand(t, "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", friday, farAway))
+
+	// Months without a 31st are skipped
+	assert.Equal(t, []string{"2025-01-31 15:00", "2025-03-31 15:00", "2025-05-31 15:00"},
+		expand(t, "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3", friday, farAway))
+
+	assert.Equal(t, []string{"2025-03-15 09:00", "2026-03-15 09:00"},
+		expand(t, "FREQ=YEARLY", time.Date(2025, 3, 15, 9, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	// Open-ended rules stop at the end of the range
+	assert.Len(t, expand(t, "FREQ=DAILY", monday, monday.AddDate(0, 0, 10)), 10)
+
+	_, err := parseRRule("FREQ=HOURLY", time.UTC)
+	assert.Error(t, err)
+	_, err = parseRRule("FREQ=WEEKLY;BYDAY=XX", time.UTC)
+	assert.Error(t, err)
+
+	// Parts that would change the expansion are refused, not ignored
+	for _, rrule := range []string{
+		"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1",
+		"FREQ=DAILY;BYHOUR=9,14",
+		"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,SU;WKST=SU",
+		"FREQ=WEEKLY;BYDAYS=MO",
+		"FREQ=WEEKLY;COUNT",
+	} {
+		_, err = parseRRule(rrule, time.UTC)
+		assert.Error(t, err, rrule)
+	}
+	_, err = parseRRule("FREQ=WEEKLY;BYDAY=MO;WKST=MO;", time.UTC)
+	assert.NoError(t, err)
+}
+
+func TestRecurrenceKeepsLocalTimeAcrossDST(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	start := time.Date(2025, 3, 24, 9, 0, 0, 0, london)
+	rule, err := parseRRule("FREQ=WEEKLY;COUNT=2", london)
+	assert.NoError(t, err)
+
+	occurrences := rule.occurrences(start, start.AddDate(1, 0, 0))
+	assert.Len(t, occurrences, 2)
+	assert.Equal(t, 9, occurrences[1].Hour())
+	assert.Equal(t, 7*24*time.Hour-time.Hour, occurrences[1].Sub(occurrences[0]))
+}
+
+func TestParseICSDuration(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"PT1H30M": 90 * time.Minute,
+		"P1D":     24 * time.Hour,
+		"P1W":     7 * 24 * time.Hour,
+		"P1DT2H":  26 * time.Hour,
+		"-PT15M":  -15 * time.Minute,
+		"PT45S":   45 * time.Second,
+	} {
+		got, err := parseICSDuration(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"", "P", "1H", "P1M", "PT1D", "PT1H30"} {
+		_, err := parseICSDuration(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Resource is a bookable room or piece of equipment with its own availability
+type Resource struct {
+	ID       string     `json:"id" bson:"_id"`
+	Name     string     `json:"name" bson:"name"`
+	Type     string     `json:"type" bson:"type"` // e.g. "room", "projector"
+	Capacity int        `json:"capacity" bson:"capacity"`
+	Slots    []TimeSlot `json:"slots" bson:"slots"`
+}
+
+// ResourceRequirement is what an event needs booked alongside the attendees
+type ResourceRequirement struct {
+	Type        string `json:"type" bson:"type"`
+	MinCapacity int    `json:"min_capacity,omitempty" bson:"min_capacity,omitempty"`
+}
+
+// AssignedResource is the resource booked for a recommendation
+type AssignedResource struct {
+	ID       string `json:"id" bson:"id"`
+	Name     string `json:"name" bson:"name"`
+	Capacity int    `json:"capacity" bson:"capacity"`
+}
+
+// validateResource checks a resource before it is stored
+func validateResource(resource Resource) error {
+	if resource.Type == "" {
+		return fmt.Errorf("resource type cannot be empty")
+	}
+	if resource.Capacity < 1 {
+		return fmt.Errorf("resource capacity must be at least 1")
+	}
+	return nil
+}
+
+// validateResourceRequirement checks an event's resource requirement
+func validateResourceRequirement(requirement ResourceRequirement) error {
+	if requirement.Type == "" {
+		return fmt.Errorf("resource type cannot be empty")
+	}
+	if requirement.MinCapacity < 0 {
+		return fmt.Errorf("resource min_capacity cannot be negative")
+	}
+	return nil
+}
+
+// bookingConflict checks that a resource, as it is about to be stored, still
+// honours what confirmed events have booked: their time stays free and their
+// type and capacity stay as booked
+func bookingConflict(resource Resource, confirmed []Event) error {
+	for _, event := range confirmed {
+		if event.Booked == nil || event.Booked.ID != resource.ID || event.ScheduledSlot == nil {
+			continue
+		}
+		if event.Resource != nil && resource.Type != event.Resource.Type {
+			return fmt.Errorf("resource is booked by event %s as a %s", event.ID, event.Resource.Type)
+		}
+		if resource.Capacity < event.Booked.Capacity {
+			return fmt.Errorf("resource is booked by event %s for a capacity of %d", event.ID, event.Booked.Capacity)
+		}
+		if !resourceFree(resource, *event.ScheduledSlot) {
+			return fmt.Errorf("resource is booked by event %s from %s to %s", event.ID,
+				event.ScheduledSlot.Start_UTC.Format(time.RFC3339), event.ScheduledSlot.End_UTC.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// resourceFree reports whether a resource is free for the whole slot
+func resourceFree(resource Resource, slot TimeSlot) bool {
+	for _, free := range resource.Slots {
+		if !free.Start_UTC.After(slot.Start_UTC) && !free.End_UTC.Before(slot.End_UTC) {
+			return true
+		}
+	}
+	return false
+}
+
+// assignResource picks the smallest resource that is free for the slot and
+// fits everyone attending, so bigger rooms stay free for bigger meetings
+func assignResource(resources []Resource, requirement ResourceRequirement, slot TimeSlot, attendees int) *AssignedResource {
+	var best *Resource
+	for i := range resources {
+		resource := &resources[i]
+		if resource.Type != requirement.Type || resource.Capacity < max(attendees, requirement.MinCapacity) {
+			continue
+		}
+		if !resourceFree(*resource, slot) {
+			continue
+		}
+		if best == nil || resource.Capacity < best.Capacity || resource.Capacity == best.Capacity && resource.ID < best.ID {
+			best = resource
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return &AssignedResource{ID: best.ID, Name: best.Name, Capacity: best.Capacity}
+}
+
+// resourceForSlot books the smallest free resource for a slot chosen outside
+// the recommendations, big enough for everyone free at that time
+func resourceForSlot(event Event, resources []Resource, slot TimeSlot) *AssignedResource {
+	available, _ := buildAvailabilityIndex(event).usersFree(slot.Start_UTC.UnixNano(), slot.End_UTC.UnixNano())
+	return assignResource(resources, *event.Resource, slot, len(available))
+}
+
+// withoutBookings takes the slots that confirmed events have booked out of
+// each resource's free time
+func withoutBookings(resources []Resource, confirmed []Event) []Resource {
+	booked := map[string][]TimeSlot{}
+	for _, event := range confirmed {
+		if event.Booked != nil && event.ScheduledSlot != nil {
+			booked[event.Booked.ID] = append(booked[event.Booked.ID], *event.ScheduledSlot)
+		}
+	}
+
+	free := make([]Resource, len(resources))
+	for i, resource := range resources {
+		free[i] = resource
+		if len(booked[resource.ID]) == 0 {
+			continue
+		}
+		free[i].Slots = []TimeSlot{}
+		for _, run := range subtractRuns(mergeRuns(slotsToRuns(resource.Slots)), mergeRuns(slotsToRuns(booked[resource.ID]))) {
+			free[i].Slots = append(free[i].Slots, TimeSlot{Start_UTC: nanosToTime(run.start), End_UTC: nanosToTime(run.end)})
+		}
+	}
+	return free
+}
+
+// findSlotsWithResources walks the ranked windows in order and keeps the ones
+// where the required resource can be booked for some start inside the window.
+// It stops after limit recommendations, clamped as findOptimalSlots clamps it,
+// or with the context's error once the context is done.
+func findSlotsWithResources(ctx context.Context, event Event, resources []Resource, limit int) ([]SlotRecommendation, error) {
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+	index, ranked, err := rankWindows(ctx, event, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	limit = candidateLimit(limit)
+	recommendations := []SlotRecommendation{}
+	for i, window := range ranked {
+		if i%candidateCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if rec, ok := index.resourceRecommendation(event, resources, window, meetingDuration); ok {
+			recommendations = append(recommendations, rec)
+		}
+		if len(recommendations) == limit {
+			break
+		}
+	}
+	return recommendations, nil
+}
+
+// resourceRecommendation materialises a window at the first start where the
+// required resource can be booked, if there is one
+func (index *availabilityIndex) resourceRecommendation(event Event, resources []Resource, window availabilityWindow, meetingDuration time.Duration) (SlotRecommendation, bool) {
+	// Try the scorer's chosen start first, then the rest of the window
+	starts := []time.Time{nanosToTime(window.slotStart)}
+	starts = append(starts, windowStarts(nanosToTime(window.start), nanosToTime(window.end), meetingDuration)...)
+
+	for _, start := range starts {
+		slot := TimeSlot{Start_UTC: start, End_UTC: start.Add(meetingDuration)}
+		assigned := assignResource(resources, *event.Resource, slot, window.count)
+		if assigned == nil {
+			continue
+		}
+
+		window.slotStart = start.UnixNano()
+		rec := index.recommendation(window, meetingDuration)
+		rec.Resource = assigned
+		rec.ID = recommendationID(rec)
+		return rec, true
+	}
+	return SlotRecommendation{}, false
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFindSlotsWithResources(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Resource:     &ResourceRequirement{Type: "room"},
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("carol", utcSlot("2025-01-15 09:00", "2025-01-15 10:00")),
+		},
+	}
+	resources := []Resource{
+		{ID: "boardroom", Name: "Boardroom", Type: "room", Capacity: 12, Slots: []TimeSlot{utcSlot("2025-01-15 11:00", "2025-01-15 12:00")}},
+		{ID: "huddle", Name: "Huddle", Type: "room", Capacity: 2, Slots: []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")}},
+		{ID: "beamer", Name: "Beamer", Type: "projector", Capacity: 50, Slots: []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")}},
+	}
+
+	recommendations := slotsWithResources(t, event, resources, 0)
+
+	// No room fits all three at 09:00, so the only pick is alice and bob in the huddle room
+	assert.Len(t, recommendations, 1)
+	assert.Equal(t, []string{"alice", "bob"}, recommendations[0].AvailableUsers)
+	assert.Equal(t, &AssignedResource{ID: "huddle", Name: "Huddle", Capacity: 2}, recommendations[0].Resource)
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), recommendations[0].Slot)
+
+	t.Run("Minimum Capacity", func(t *testing.T) {
+		event.Resource.MinCapacity = 10
+		recommendations := slotsWithResources(t, event, resources, 1)
+
+		// The boardroom is only free later in the window
+		assert.Len(t, recommendations, 1)
+		assert.Equal(t, "boardroom", recommendations[0].Resource.ID)
+		assert.Equal(t, utcSlot("2025-01-15 11:00", "2025-01-15 12:00"), recommendations[0].Slot)
+	})
+}
+
+func TestResourceBookings(t *testing.T) {
+	event := Event{
+		ID:           "review",
+		DurationMins: 60,
+		Resource:     &ResourceRequirement{Type: "room"},
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+		},
+	}
+	resources := []Resource{
+		{ID: "huddle", Name: "Huddle", Type: "room", Capacity: 2, Slots: []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")}},
+	}
+	booked := utcSlot("2025-01-15 09:00", "2025-01-15 10:30")
+	standup := Event{
+		ID:            "standup",
+		Status:        StatusConfirmed,
+		ScheduledSlot: &booked,
+		Booked:        &AssignedResource{ID: "huddle", Name: "Huddle", Capacity: 2},
+	}
+
+	// The room is taken until 10:30, so the meeting moves after it
+	free := withoutBookings(resources, []Event{standup})
+	assert.Equal(t, []TimeSlot{utcSlot("2025-01-15 10:30", "2025-01-15 17:00")}, free[0].Slots)
+	assert.Equal(t, []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")}, resources[0].Slots) // Left as stored
+
+	recommendations := slotsWithResources(t, event, free, 1)
+	assert.Len(t, recommendations, 1)
+	assert.Equal(t, utcSlot("2025-01-15 10:30", "2025-01-15 11:30"), recommendations[0].Slot)
+
+	// An explicit slot is booked the same way
+	assert.Nil(t, resourceForSlot(event, free, utcSlot("2025-01-15 10:00", "2025-01-15 11:00")))
+	assert.Equal(t, "huddle", resourceForSlot(event, free, utcSlot("2025-01-15 11:00", "2025-01-15 12:00")).ID)
+
+	// Events without a booking leave the rooms alone
+	assert.Equal(t, resources, withoutBookings(resources, []Event{{ID: "open"}}))
+}
+
+func TestBookingConflict(t *testing.T) {
+	booked := utcSlot("2025-01-15 09:00", "2025-01-15 10:00")
+	standup := Event{
+		ID:            "standup",
+		Status:        StatusConfirmed,
+		Resource:      &ResourceRequirement{Type: "room"},
+		ScheduledSlot: &booked,
+		Booked:        &AssignedResource{ID: "huddle", Name: "Huddle", Capacity: 4},
+	}
+	huddle := Resource{ID: "huddle", Type: "room", Capacity: 4, Slots: []TimeSlot{utcSlot("2025-01-15 08:00", "2025-01-15 17:00")}}
+	assert.NoError(t, bookingConflict(huddle, []Event{standup}))
+
+	// Growing is fine, taking away the booked time, capacity or type is not
+	bigger := huddle
+	bigger.Capacity = 8
+	assert.NoError(t, bookingConflict(bigger, []Event{standup}))
+	shorter := huddle
+	shorter.Slots = []TimeSlot{utcSlot("2025-01-15 09:30", "2025-01-15 17:00")}
+	assert.ErrorContains(t, bookingConflict(shorter, []Event{standup}), "standup")
+	smaller := huddle
+	smaller.Capacity = 2
+	assert.Error(t, bookingConflict(smaller, []Event{standup}))
+	projector := huddle
+	projector.Type = "projector"
+	assert.Error(t, bookingConflict(projector, []Event{standup}))
+
+	// Bookings of other resources don't matter
+	other := shorter
+	other.ID = "boardroom"
+	assert.NoError(t, bookingConflict(other, []Event{standup}))
+}
+
+func TestResourceHandlers(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer func(events, resources *mongo.Collection, key string) {
+		eventsCollection, resourcesCollection, adminKey = events, resources, key
+	}(eventsCollection, resourcesCollection, adminKey)
+	adminKey = "ops-secret"
+
+	router := mux.NewRouter()
+	router.HandleFunc("/resources/{id}", handleResource).Methods("POST", "PUT")
+	router.HandleFunc("/resources/{id}", deleteResource).Methods("DELETE")
+
+	body := `{"type": "room", "capacity": 4, "slots": []}`
+	booked := utcSlot("2025-01-15 09:00", "2025-01-15 10:00")
+	standup := bson.D{
+		{Key: "_id", Value: "standup"},
+		{Key: "status", Value: StatusConfirmed},
+		{Key: "scheduled_slot", Value: bson.D{{Key: "start_utc", Value: booked.Start_UTC}, {Key: "end_utc", Value: booked.End_UTC}}},
+		{Key: "assigned_resource", Value: bson.D{{Key: "id", Value: "huddle"}, {Key: "capacity", Value: 4}}},
+	}
+
+	// Without the admin key nothing is read or written
+	for _, request := range []struct{ method, key string }{{"POST", ""}, {"PUT", "guess"}, {"DELETE", ""}} {
+		mt.Run("No Admin "+request.method, func(mt *mtest.T) {
+			eventsCollection, resourcesCollection = mt.Coll, mt.Coll
+			r := httptest.NewRequest(request.method, "/resources/huddle", strings.NewReader(body))
+			if request.key != "" {
+				r.Header.Set("X-Admin-Key", request.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			assert.Contains(mt, []int{http.StatusUnauthorized, http.StatusForbidden}, w.Code, w.Body.String())
+		})
+	}
+
+	// A booked resource can neither be deleted nor lose the booked time
+	mt.Run("Delete Booked", func(mt *mtest.T) {
+		eventsCollection, resourcesCollection = mt.Coll, mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, standup))
+		r := httptest.NewRequest("DELETE", "/resources/huddle", nil)
+		r.Header.Set("X-Admin-Key", "ops-secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(mt, http.StatusConflict, w.Code, w.Body.String())
+		assert.Contains(mt, w.Body.String(), "booked by event standup")
+	})
+	mt.Run("Shrink Booked", func(mt *mtest.T) {
+		eventsCollection, resourcesCollection = mt.Coll, mt.Coll
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.resources", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			mtest.CreateCursorResponse(0, "db.events", mtest.FirstBatch, standup),
+		)
+		r := httptest.NewRequest("PUT", "/resources/huddle", strings.NewReader(body))
+		r.Header.Set("X-Admin-Key", "ops-secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		assert.Equal(mt, http.StatusConflict, w.Code, w.Body.String())
+		assert.Contains(mt, w.Body.String(), "booked by event standup")
+	})
+}
+
+// slotsWithResources runs findSlotsWithResources without a deadline
+func slotsWithResources(t *testing.T, event Event, resources []Resource, limit int) []SlotRecommendation {
+	t.Helper()
+	recommendations, err := findSlotsWithResources(context.Background(), event, resources, limit)
+	assert.NoError(t, err)
+	return recommendations
+}
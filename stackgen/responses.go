@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ParticipantResponse is where one participant stands on an event
+type ParticipantResponse struct {
+	UserID    string `json:"user_id"`
+	Invited   bool   `json:"invited"`   // Named in invitees
+	Responded bool   `json:"responded"` // Has given availability, even if none of it is free
+	Slots     int    `json:"slots"`
+	RSVP      string `json:"rsvp,omitempty"` // Answer to the confirmed time, if any
+}
+
+// EventResponses shows who has and hasn't given availability
+type EventResponses struct {
+	Participants []ParticipantResponse `json:"participants"`
+	Responded    []string              `json:"responded"`
+	Pending      []string              `json:"pending"`
+	ResponseRate float64               `json:"response_rate"` // Percentage of invitees who responded
+}
+
+// validateInvitees rejects blank invitees
+func validateInvitees(invitees []string) error {
+	for _, invitee := range invitees {
+		if strings.TrimSpace(invitee) == "" {
+			return fmt.Errorf("invitees cannot contain empty user IDs")
+		}
+	}
+	return nil
+}
+
+// normalizeInvitees trims, sorts and removes repeated invitees
+func normalizeInvitees(invitees []string) []string {
+	if invitees == nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(invitees))
+	for _, invitee := range invitees {
+		normalized = append(normalized, strings.TrimSpace(invitee))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// addInvitee names a user as an invitee if they aren't one yet
+func addInvitee(event *Event, userID string) {
+	if !slices.Contains(event.Invitees, userID) {
+		event.Invitees = normalizeInvitees(append(slices.Clone(event.Invitees), userID))
+	}
+}
+
+// respondedUsers counts the slots of every user who gave availability. An
+// empty entry still counts as an answer: that user is busy, not pending.
+func respondedUsers(event Event) map[string]int {
+	responded := map[string]int{}
+	for _, user := range event.UserSlots {
+		responded[user.UserID] += len(user.Slots)
+	}
+	return responded
+}
+
+// answered reports whether a user gave availability
+func answered(responded map[string]int, user string) bool {
+	_, ok := responded[user]
+	return ok
+}
+
+// pendingUsers are the invitees who have not given availability yet, sorted.
+// The scheduler cannot see them otherwise, so they would read as absent
+// rather than as not yet free.
+func pendingUsers(event Event) []string {
+	responded := respondedUsers(event)
+	pending := []string{}
+	for _, invitee := range normalizeInvitees(event.Invitees) {
+		if !answered(responded, invitee) {
+			pending = append(pending, invitee)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	return pending
+}
+
+// eventResponses lists every invitee and everyone who gave availability, by user ID
+func eventResponses(event Event) EventResponses {
+	responses := EventResponses{Participants: []ParticipantResponse{}, Responded: []string{}, Pending: []string{}}
+	responded := respondedUsers(event)
+	rsvps := map[string]string{}
+	for _, rsvp := range event.RSVPs {
+		rsvps[rsvp.UserID] = rsvp.Response
+	}
+
+	for _, user := range eventParticipants(event) {
+		participant := ParticipantResponse{
+			UserID:    user,
+			Invited:   slices.Contains(event.Invitees, user),
+			Responded: answered(responded, user),
+			Slots:     responded[user],
+			RSVP:      rsvps[user],
+		}
+		responses.Participants = append(responses.Participants, participant)
+		if participant.Responded {
+			responses.Responded = append(responses.Responded, user)
+		} else {
+			responses.Pending = append(responses.Pending, user)
+		}
+	}
+
+	invitees := normalizeInvitees(event.Invitees)
+	if len(invitees) > 0 {
+		count := 0
+		for _, invitee := range invitees {
+			if answered(responded, invitee) {
+				count++
+			}
+		}
+		responses.ResponseRate = math.Round(float64(count)*1000/float64(len(invitees))) / 10
+	}
+	return responses
+}
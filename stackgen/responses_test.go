@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func invitedEvent() Event {
+	return Event{
+		ID:           "review",
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		Invitees:     []string{"carol", "alice", "bob", "dave"},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 10:00", "2025-01-15 12:00"), utcSlot("2025-01-15 14:00", "2025-01-15 15:00")),
+			userAvailability("erin", utcSlot("2025-01-15 10:00", "2025-01-15 11:00")),
+		},
+	}
+}
+
+func TestPendingUsers(t *testing.T) {
+	event := invitedEvent()
+	assert.Equal(t, []string{"carol", "dave"}, pendingUsers(event))
+
+	// Non-responders are reported apart from those who answered and are busy
+	recommendations := optimalSlots(t, event, 0)
+	assert.NotEmpty(t, recommendations)
+	top := recommendations[0]
+	assert.Equal(t, []string{"alice", "bob", "erin"}, top.AvailableUsers)
+	assert.Empty(t, top.UnavailableUsers)
+	assert.Equal(t, []string{"carol", "dave"}, top.PendingUsers)
+
+	// A percentage quorum counts the invitees who have not answered, wherever it is applied
+	event.MinAttendees = &AttendeeThreshold{Percent: 80}
+	assert.Empty(t, optimalSlots(t, event, 0))
+	assert.Empty(t, durationTradeoffs(t, event).Tradeoffs)
+	event.MinAttendees = &AttendeeThreshold{Percent: 60}
+	assert.Len(t, optimalSlots(t, event, 0), 1)
+	assert.Len(t, durationTradeoffs(t, event).Tradeoffs, 1)
+
+	assert.Nil(t, pendingUsers(Event{UserSlots: event.UserSlots}))
+}
+
+func TestEventResponses(t *testing.T) {
+	event := invitedEvent()
+	responses := eventResponses(event)
+	assert.Equal(t, []string{"alice", "bob", "erin"}, responses.Responded)
+	assert.Equal(t, []string{"carol", "dave"}, responses.Pending)
+	assert.Equal(t, 50.0, responses.ResponseRate)
+	assert.Len(t, responses.Participants, 5)
+	assert.Equal(t, ParticipantResponse{UserID: "bob", Invited: true, Responded: true, Slots: 2}, responses.Participants[1])
+	assert.Equal(t, ParticipantResponse{UserID: "erin", Responded: true, Slots: 1}, responses.Participants[4])
+
+	// Giving no free time is an answer too, so dave is busy rather than pending
+	event.UserSlots = append(event.UserSlots, userAvailability("dave"))
+	assert.Equal(t, []string{"carol"}, pendingUsers(event))
+	responses = eventResponses(event)
+	assert.Equal(t, []string{"carol"}, responses.Pending)
+	assert.Equal(t, 75.0, responses.ResponseRate)
+	assert.Equal(t, ParticipantResponse{UserID: "dave", Invited: true, Responded: true}, responses.Participants[3])
+
+	// Without invitees there is no rate to report
+	assert.Zero(t, eventResponses(Event{UserSlots: event.UserSlots}).ResponseRate)
+}
+
+func TestInvitees(t *testing.T) {
+	assert.Equal(t, []string{"alice", "bob"}, normalizeInvitees([]string{" bob", "alice", "bob"}))
+	assert.Error(t, validateEvent(Event{Invitees: []string{"alice", " "}}))
+
+	// Issuing an invite makes the user an invitee
+	event := Event{ID: "review", Invitees: []string{"bob"}}
+	_, err := issueInvite(&event, "alice", 0, time.Now())
+	assert.NoError(t, err)
+	_, err = issueInvite(&event, "alice", 0, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"alice", "bob"}, event.Invitees)
+
+	event.Invitees = append(event.Invitees, "carol@example.com")
+	assert.Equal(t, []string{"alice", "bob", "carol@example.com"}, eventParticipants(event))
+	assert.Equal(t, []string{"carol@example.com"}, participantEmails(event))
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// RSVP responses to a confirmed time
+const (
+	RSVPAccepted  = "accepted"
+	RSVPDeclined  = "declined"
+	RSVPTentative = "tentative"
+)
+
+var rsvpResponses = []string{RSVPAccepted, RSVPDeclined, RSVPTentative}
+
+// RejectedSlot is a confirmed time given up after declines, with who declined it
+type RejectedSlot struct {
+	Slot  TimeSlot `json:"slot" bson:"slot"`
+	Users []string `json:"users" bson:"users"`
+}
+
+// RSVP is a participant's answer to the confirmed time
+type RSVP struct {
+	UserID      string    `json:"user_id" bson:"user_id"`
+	Response    string    `json:"response" bson:"response"` // accepted, declined or tentative
+	Comment     string    `json:"comment,omitempty" bson:"comment,omitempty"`
+	RespondedAt time.Time `json:"responded_at" bson:"responded_at"`
+}
+
+// RSVPSummary groups participants by their answer. Pending are participants
+// who have not answered; RequiredDeclined are the declines that count towards
+// max_declines.
+type RSVPSummary struct {
+	Accepted         []string `json:"accepted"`
+	Declined         []string `json:"declined"`
+	Tentative        []string `json:"tentative"`
+	Pending          []string `json:"pending"`
+	RequiredDeclined []string `json:"required_declined"`
+}
+
+// EventDetails is an event as getEvent returns it
+type EventDetails struct {
+	Event
+	RSVPSummary *RSVPSummary `json:"rsvp_summary,omitempty"` // Once the event is confirmed
+}
+
+// validateRSVP checks a response before it is stored
+func validateRSVP(rsvp RSVP) error {
+	if !slices.Contains(rsvpResponses, rsvp.Response) {
+		return fmt.Errorf("response must be accepted, declined or tentative")
+	}
+	return nil
+}
+
+// acceptsRSVP reports whether participants may answer, which they can only
+// once there is a confirmed time to answer to
+func acceptsRSVP(event Event) error {
+	if status := eventStatus(event); status != StatusConfirmed {
+		return fmt.Errorf("event is %s; RSVPs open once it is confirmed", status)
+	}
+	return nil
+}
+
+// eventParticipants are the invitees and the users who gave availability, sorted
+func eventParticipants(event Event) []string {
+	users := slices.Clone(event.Invitees)
+	for _, user := range event.UserSlots {
+		users = append(users, user.UserID)
+	}
+	slices.Sort(users)
+	return slices.Compact(users)
+}
+
+// requiredUsers are the users whose declines count: required_users, or every
+// participant when the event names none
+func requiredUsers(event Event) []string {
+	if len(event.RequiredUsers) > 0 {
+		return event.RequiredUsers
+	}
+	return eventParticipants(event)
+}
+
+// setRSVP stores a user's answer, replacing an earlier one, and reports whether there was one
+func setRSVP(event *Event, rsvp RSVP) bool {
+	for i, existing := range event.RSVPs {
+		if existing.UserID == rsvp.UserID {
+			event.RSVPs[i] = rsvp
+			return true
+		}
+	}
+	event.RSVPs = append(event.RSVPs, rsvp)
+	return false
+}
+
+// removeRSVP drops a user's answer and reports whether there was one
+func removeRSVP(event *Event, userID string) bool {
+	for i, existing := range event.RSVPs {
+		if existing.UserID == userID {
+			event.RSVPs = slices.Delete(slices.Clone(event.RSVPs), i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeRSVPs groups participants, and anyone else who answered, by response
+func summarizeRSVPs(event Event) RSVPSummary {
+	summary := RSVPSummary{Accepted: []string{}, Declined: []string{}, Tentative: []string{}, Pending: []string{}, RequiredDeclined: []string{}}
+	required := requiredUsers(event)
+	answered := map[string]bool{}
+	for _, rsvp := range event.RSVPs {
+		answered[rsvp.UserID] = true
+		switch rsvp.Response {
+		case RSVPAccepted:
+			summary.Accepted = append(summary.Accepted, rsvp.UserID)
+		case RSVPDeclined:
+			summary.Declined = append(summary.Declined, rsvp.UserID)
+			if slices.Contains(required, rsvp.UserID) {
+				summary.RequiredDeclined = append(summary.RequiredDeclined, rsvp.UserID)
+			}
+		case RSVPTentative:
+			summary.Tentative = append(summary.Tentative, rsvp.UserID)
+		}
+	}
+	for _, user := range eventParticipants(event) {
+		if !answered[user] {
+			summary.Pending = append(summary.Pending, user)
+		}
+	}
+	for _, users := range [][]string{summary.Accepted, summary.Declined, summary.Tentative, summary.Pending, summary.RequiredDeclined} {
+		slices.Sort(users)
+	}
+	return summary
+}
+
+// eventDetails adds the RSVP summary to a confirmed event
+func eventDetails(event Event) EventDetails {
+	details := EventDetails{Event: event}
+	if eventStatus(event) == StatusConfirmed {
+		summary := summarizeRSVPs(event)
+		details.RSVPSummary = &summary
+	}
+	return details
+}
+
+// needsReschedule reports whether enough required users declined to look for a new time
+func needsReschedule(event Event) bool {
+	return event.MaxDeclines > 0 && len(summarizeRSVPs(event).RequiredDeclined) >= event.MaxDeclines
+}
+
+// rescheduleEvent reopens an event for polling after too many declines. The
+// rejected time is kept with who declined it, and those users count as busy
+// then when ranking, so the next recommendation looks elsewhere while the
+// availability they gave stays as it was.
+func rescheduleEvent(event *Event) error {
+	rejected := RejectedSlot{Slot: *event.ScheduledSlot, Users: summarizeRSVPs(*event).Declined}
+	if err := transitionEvent(event, StatusPolling); err != nil {
+		return err
+	}
+	event.RejectedSlots = append(slices.Clone(event.RejectedSlots), rejected)
+	return nil
+}
+
+// excludeRejected takes the times users declined out of their free runs. The
+// runs are already trimmed by the buffers, so the busy time grows by them.
+func excludeRejected(event Event, index *availabilityIndex, userIndex map[string]int) {
+	bufferBefore := int64(time.Duration(event.BufferBefore) * time.Minute)
+	bufferAfter := int64(time.Duration(event.BufferAfter) * time.Minute)
+	for _, rejected := range event.RejectedSlots {
+		busy := []freeRun{{
+			start: rejected.Slot.Start_UTC.UnixNano() - bufferAfter,
+			end:   rejected.Slot.End_UTC.UnixNano() + bufferBefore,
+		}}
+		for _, user := range rejected.Users {
+			if i, ok := userIndex[user]; ok {
+				index.runs[i] = subtractRuns(index.runs[i], busy)
+			}
+		}
+	}
+}
+
+// declinedDuring reports whether a user declined a confirmed time overlapping the slot
+func declinedDuring(event Event, user string, slot TimeSlot) bool {
+	for _, rejected := range event.RejectedSlots {
+		if slices.Contains(rejected.Users, user) && rejected.Slot.Start_UTC.Before(slot.End_UTC) && slot.Start_UTC.Before(rejected.Slot.End_UTC) {
+			return true
+		}
+	}
+	return false
+}
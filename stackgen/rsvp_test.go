@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rsvpEvent() Event {
+	event := Event{
+		ID:           "review",
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+			userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+			userAvailability("carol", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+		},
+	}
+	confirmEvent(&event, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), nil, time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC))
+	return event
+}
+
+func TestSummarizeRSVPs(t *testing.T) {
+	event := rsvpEvent()
+	event.RequiredUsers = []string{"alice", "bob"}
+
+	assert.False(t, setRSVP(&event, RSVP{UserID: "carol", Response: RSVPDeclined}))
+	assert.False(t, setRSVP(&event, RSVP{UserID: "alice", Response: RSVPTentative}))
+	assert.True(t, setRSVP(&event, RSVP{UserID: "alice", Response: RSVPAccepted}))
+	assert.False(t, setRSVP(&event, RSVP{UserID: "dave", Response: RSVPAccepted}))
+
+	summary := summarizeRSVPs(event)
+	assert.Equal(t, []string{"alice", "dave"}, summary.Accepted)
+	assert.Equal(t, []string{"carol"}, summary.Declined)
+	assert.Empty(t, summary.Tentative)
+	assert.Equal(t, []string{"bob"}, summary.Pending)
+	assert.Empty(t, summary.RequiredDeclined) // carol is optional
+
+	assert.True(t, removeRSVP(&event, "dave"))
+	assert.False(t, removeRSVP(&event, "dave"))
+	assert.Equal(t, []string{"alice"}, summarizeRSVPs(event).Accepted)
+}
+
+func TestEventDetails(t *testing.T) {
+	event := rsvpEvent()
+	setRSVP(&event, RSVP{UserID: "bob", Response: RSVPDeclined})
+
+	body, err := json.Marshal(eventDetails(event))
+	assert.NoError(t, err)
+	var details map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &details))
+	assert.Equal(t, "review", details["id"])
+	assert.Equal(t, []interface{}{"bob"}, details["rsvp_summary"].(map[string]interface{})["declined"])
+
+	// Nothing to answer before a time is confirmed
+	assert.Nil(t, eventDetails(Event{ID: "draft"}).RSVPSummary)
+	assert.Error(t, acceptsRSVP(Event{Status: StatusPolling}))
+	assert.NoError(t, acceptsRSVP(event))
+	assert.Error(t, validateRSVP(RSVP{Response: "maybe"}))
+}
+
+func TestRescheduleAfterDeclines(t *testing.T) {
+	event := rsvpEvent()
+	event.MaxDeclines = 2
+	before := optimalSlots(t, event, 1)[0]
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00").Start_UTC, before.Slot.Start_UTC)
+
+	setRSVP(&event, RSVP{UserID: "alice", Response: RSVPDeclined})
+	assert.False(t, needsReschedule(event))
+	setRSVP(&event, RSVP{UserID: "bob", Response: RSVPDeclined})
+	assert.True(t, needsReschedule(event))
+
+	assert.NoError(t, rescheduleEvent(&event))
+	assert.Equal(t, StatusPolling, event.Status)
+	assert.Nil(t, event.ScheduledSlot)
+	assert.Nil(t, event.RSVPs)
+
+	// The rejected time is kept with who declined it, and the availability
+	// they gave is left as it was
+	assert.Equal(t, []RejectedSlot{{Slot: utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), Users: []string{"alice", "bob"}}}, event.RejectedSlots)
+	assert.Equal(t, rsvpEvent().UserSlots, event.UserSlots)
+
+	// The decliners are busy at the rejected time, so it is no longer the top pick
+	after := optimalSlots(t, event, 1)[0]
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 11:00").Start_UTC, after.Slot.Start_UTC)
+	assert.Len(t, after.AvailableUsers, 3)
+
+	explanation := explainedSlot(t, event, nil, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), nil)
+	assert.Equal(t, "declined this time when it was confirmed", explanation.Users[0].Reason)
+	assert.True(t, explanation.Users[2].Available)
+
+	// With buffers the decliners also need them clear of the rejected time
+	event.BufferBefore = 15
+	after = optimalSlots(t, event, 1)[0]
+	assert.Equal(t, utcSlot("2025-01-15 10:15", "2025-01-15 11:15").Start_UTC, after.Slot.Start_UTC)
+}
@@ -1,140 +1,513 @@
 package main
 
 import (
+	"cmp"
+	"container/heap"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
 	"sort"
 	"time"
 )
 
-// TimePoint represents a single point in time where availability changes
+// candidateStep is how far apart candidate meeting starts are placed inside a free window
+const candidateStep = 30 * time.Minute
+
+// maxCandidateWindows bounds how many recommendations any caller is given. A
+// busy event has far more windows than anyone can use, and materialising
+// them all costs seconds.
+const maxCandidateWindows = 200
+
+// candidateCheckInterval is how many steps of a long loop run between checks
+// that the request is still wanted
+const candidateCheckInterval = 1024
+
+// freeRun is one continuous stretch of a user's usable availability, in Unix nanoseconds
+type freeRun struct {
+	start int64
+	end   int64
+}
+
+// TimePoint represents a single point in time where a user's availability
+// changes. Start points also carry the end of the run they open.
 type TimePoint struct {
-	Time    time.Time
-	UserID  string
-	IsStart bool
+	Time int64
+	End  int64
+	User int32
+}
+
+// availabilityWindow is the longest span in which a fixed set of users is free
+// together. The set itself is not stored: it is exactly the users whose free
+// runs cover the window, and is only materialised for windows that are returned.
+type availabilityWindow struct {
+	start     int64
+	end       int64
+	count     int
+	slotStart int64   // Where the meeting is placed inside the window
+	score     float64 // Higher ranks first
 }
 
-// findOptimalSlots finds optimal meeting slots using a line sweep algorithm
-func findOptimalSlots(event Event) []SlotRecommendation {
+// availabilityIndex is the compact sweep result the scheduler ranks from
+type availabilityIndex struct {
+	users   []string
+	runs    [][]freeRun // Per user index, sorted and non-overlapping
+	windows []availabilityWindow
+	pending []string // Invitees who have not given availability
+}
+
+// findOptimalSlots finds optimal meeting slots using a line sweep algorithm.
+// At most limit recommendations are materialised, and never more than
+// maxCandidateWindows; a limit of zero asks for that many. It stops with the
+// context's error once the context is done.
+func findOptimalSlots(ctx context.Context, event Event, limit int) ([]SlotRecommendation, error) {
 	meetingDuration := time.Duration(event.DurationMins) * time.Minute
 
-	// If no users or slots, return empty recommendations
-	if len(event.UserSlots) == 0 || len(event.Slots) == 0 {
-		return []SlotRecommendation{}
+	index, ranked, err := rankWindows(ctx, event, candidateLimit(limit))
+	if err != nil {
+		return nil, err
 	}
 
-	allUsers := make(map[string]bool)
-	for _, user := range event.UserSlots {
-		allUsers[user.UserID] = true
+	recommendations := make([]SlotRecommendation, 0, len(ranked))
+	for _, window := range ranked {
+		recommendations = append(recommendations, index.recommendation(window, meetingDuration))
 	}
+	return recommendations, nil
+}
 
-	// Generate time points
-	points := []TimePoint{}
+// candidateLimit clamps a requested number of recommendations to maxCandidateWindows
+func candidateLimit(limit int) int {
+	if limit <= 0 || limit > maxCandidateWindows {
+		return maxCandidateWindows
+	}
+	return limit
+}
 
-	// For each user's availability
-	for _, user := range event.UserSlots {
-		for _, userSlot := range user.Slots {
-			// For each event slot
-			for _, eventSlot := range event.Slots {
-				// Find overlap
-				start := later(userSlot.Start_UTC, eventSlot.Start_UTC)
-				end := earlier(userSlot.End_UTC, eventSlot.End_UTC)
-
-				// Skip if no overlap
-				if start.After(end) || start.Equal(end) {
-					continue
-				}
-
-				// Add start and end points
-				points = append(points,
-					TimePoint{Time: start, UserID: user.UserID, IsStart: true},
-					TimePoint{Time: end, UserID: user.UserID, IsStart: false},
-				)
+// findRecommendationByID ranks an event's slots as recommendSlots does, with
+// resources for an event that needs one, and returns the recommendation with
+// the given ID. Only the recommendations anyone can have been shown are
+// searched, materialised best first until it turns up.
+func findRecommendationByID(ctx context.Context, event Event, resources []Resource, id string) (SlotRecommendation, bool, error) {
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+
+	// Windows without a free resource are skipped, so an event with one has
+	// to walk the whole ranking to find maxCandidateWindows that have
+	limit := maxCandidateWindows
+	if event.Resource != nil {
+		limit = 0
+	}
+	index, ranked, err := rankWindows(ctx, event, limit)
+	if err != nil {
+		return SlotRecommendation{}, false, err
+	}
+
+	found := 0
+	for i, window := range ranked {
+		if i%candidateCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return SlotRecommendation{}, false, err
 			}
 		}
+		rec, ok := index.bookedRecommendation(event, resources, window, meetingDuration)
+		if !ok {
+			continue
+		}
+		if rec.ID == id {
+			return rec, true, nil
+		}
+		if found++; found == maxCandidateWindows {
+			break
+		}
 	}
+	return SlotRecommendation{}, false, nil
+}
+
+// bookedRecommendation materialises a window as recommendSlots would, with a
+// resource for an event that needs one; ok is false when none can be booked
+func (index *availabilityIndex) bookedRecommendation(event Event, resources []Resource, window availabilityWindow, meetingDuration time.Duration) (SlotRecommendation, bool) {
+	if event.Resource != nil {
+		return index.resourceRecommendation(event, resources, window, meetingDuration)
+	}
+	return index.recommendation(window, meetingDuration), true
+}
 
-	// Sort time points
-	sort.Slice(points, func(i, j int) bool {
-		if points[i].Time.Equal(points[j].Time) {
-			return !points[i].IsStart && points[j].IsStart
+// rankWindows sweeps an event's availability and returns the windows that fit
+// the meeting and its quorum, best first. A limit above zero keeps only that
+// many of the best, which spares sorting every window of a busy event.
+func rankWindows(ctx context.Context, event Event, limit int) (*availabilityIndex, []availabilityWindow, error) {
+	index, ranked, err := scoredWindows(ctx, event)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if limit > 0 && len(ranked) > limit {
+		ranked = bestWindows(ranked, limit)
+	}
+	slices.SortFunc(ranked, compareWindows)
+
+	return index, ranked, nil
+}
+
+// scoredWindows sweeps an event's availability and scores the windows that
+// fit the meeting and its quorum, in no particular order
+func scoredWindows(ctx context.Context, event Event) (*availabilityIndex, []availabilityWindow, error) {
+	meetingDuration := int64(time.Duration(event.DurationMins) * time.Minute)
+
+	index := buildAvailabilityIndex(event)
+
+	minAttendees := index.quorum(event)
+	if err := index.sweep(ctx, meetingDuration, minAttendees); err != nil {
+		return nil, nil, err
+	}
+
+	scored := []availabilityWindow{}
+	for _, window := range index.windows {
+		if window.count >= minAttendees && window.end-window.start >= meetingDuration {
+			scored = append(scored, window)
 		}
-		return points[i].Time.Before(points[j].Time)
-	})
+	}
 
-	// Process time points to find intervals
-	var recommendations []SlotRecommendation
-	activeUsers := make(map[string]bool)
-	var startTime time.Time
-
-	for i, point := range points {
-		// Update active users
-		if point.IsStart {
-			// If this is our first user becoming available, mark the start time
-			if len(activeUsers) == 0 {
-				startTime = point.Time
-			}
-			activeUsers[point.UserID] = true
-		} else {
-			delete(activeUsers, point.UserID)
+	if err := scoreWindows(ctx, event, index, scored); err != nil {
+		return nil, nil, err
+	}
+	return index, scored, nil
+}
+
+// compareWindows ranks by score (descending), then earliest start, then
+// shortest window. Windows are unique by start and end, so the order is
+// total and repeated calls agree.
+func compareWindows(a, b availabilityWindow) int {
+	return cmp.Or(
+		cmp.Compare(b.score, a.score),
+		cmp.Compare(a.slotStart, b.slotStart),
+		cmp.Compare(a.end-a.start, b.end-b.start),
+	)
+}
+
+// windowHeap keeps the best windows seen so far with the worst on top, so a
+// better one can replace it
+type windowHeap []availabilityWindow
+
+func (h windowHeap) Len() int           { return len(h) }
+func (h windowHeap) Less(i, j int) bool { return compareWindows(h[i], h[j]) > 0 }
+func (h windowHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *windowHeap) Push(x any)        { *h = append(*h, x.(availabilityWindow)) }
+func (h *windowHeap) Pop() any {
+	old := *h
+	window := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return window
+}
+
+// bestWindows returns the limit best windows, unordered
+func bestWindows(windows []availabilityWindow, limit int) []availabilityWindow {
+	best := make(windowHeap, 0, limit)
+	for _, window := range windows {
+		if len(best) < limit {
+			heap.Push(&best, window)
+		} else if compareWindows(window, best[0]) < 0 {
+			best[0] = window
+			heap.Fix(&best, 0)
 		}
+	}
+	return best
+}
+
+// buildAvailabilityIndex clips every user slot to the event slots, giving
+// each user's free runs; sweep then finds the windows they make together
+func buildAvailabilityIndex(event Event) *availabilityIndex {
+	index := &availabilityIndex{
+		users:   []string{},
+		runs:    [][]freeRun{},
+		windows: []availabilityWindow{},
+		pending: pendingUsers(event),
+	}
 
-		// Check if we can create a valid interval
-		intervalEnd := point.Time
-		intervalDuration := intervalEnd.Sub(startTime)
+	// If no users or slots, there is nothing to sweep
+	if len(event.UserSlots) == 0 || len(event.Slots) == 0 {
+		return index
+	}
 
-		// If we have a valid interval and it's long enough for the meeting
-		if len(activeUsers) > 0 && intervalDuration >= meetingDuration && i > 0 {
-			// Create list of available and unavailable users
-			available := []string{}
-			unavailable := []string{}
+	eventWindows := mergeRuns(slotsToRuns(event.Slots))
+	if earliest := earliestStart(event); !earliest.IsZero() {
+		eventWindows = clipBefore(eventWindows, earliest.UnixNano())
+	}
+	bufferBefore := int64(time.Duration(event.BufferBefore) * time.Minute)
+	bufferAfter := int64(time.Duration(event.BufferAfter) * time.Minute)
+
+	// Give every user an integer index in name order, so user lists come out
+	// sorted; repeated entries for one user are combined
+	for _, user := range event.UserSlots {
+		index.users = append(index.users, user.UserID)
+	}
+	slices.Sort(index.users)
+	index.users = slices.Compact(index.users)
 
-			for user := range allUsers {
-				if activeUsers[user] {
-					available = append(available, user)
-				} else {
-					unavailable = append(unavailable, user)
-				}
+	userIndex := make(map[string]int, len(index.users))
+	for i, user := range index.users {
+		userIndex[user] = i
+	}
+	own := make([][]freeRun, len(index.users))
+	for _, user := range event.UserSlots {
+		i := userIndex[user.UserID]
+		own[i] = append(own[i], slotsToRuns(user.Slots)...)
+	}
+
+	// Buffers must fall inside the user's own free time, so a meeting can only
+	// start bufferBefore after it opens and end bufferAfter before it closes.
+	// Touching slots are one stretch of free time, so they are joined first.
+	index.runs = make([][]freeRun, len(index.users))
+	for i := range own {
+		for _, run := range trimRuns(mergeRuns(own[i]), bufferBefore, bufferAfter) {
+			index.runs[i] = clipRun(index.runs[i], run, eventWindows)
+		}
+	}
+	excludeHolidays(event, index, userIndex)
+	excludeRejected(event, index, userIndex)
+
+	return index
+}
+
+// sweep finds every availability window at least minLength long with at
+// least minCount users. There can be many more windows than runs, so callers
+// ask only for those they can use. It stops with the context's error once
+// the context is done.
+func (index *availabilityIndex) sweep(ctx context.Context, minLength int64, minCount int) error {
+	index.windows = []availabilityWindow{}
+	starts := []TimePoint{}
+	for i := range index.runs {
+		for _, run := range index.runs[i] {
+			starts = append(starts, TimePoint{Time: run.start, End: run.end, User: int32(i)})
+		}
+	}
+	slices.SortFunc(starts, func(a, b TimePoint) int { return cmp.Compare(a.Time, b.Time) })
+
+	// A window is the longest span in which a fixed set of users is free, so it
+	// starts where one of them becomes free and ends where one stops being free.
+	// At each start the users still free at a later end are exactly those whose
+	// current runs reach it, so keeping the runs under way sorted by end gives
+	// every window opening there, one per end, with nested sets of users. Only
+	// ends reached by a run starting here open a new window; the sets left at
+	// later ends were already free together earlier, and their windows start there.
+	active := []int64{} // Ends of the runs under way, ascending
+	for s, group := 0, 0; s < len(starts); group++ {
+		if group%candidateCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
 			}
+		}
+		current := starts[s].Time
+		expired, _ := slices.BinarySearch(active, current+1)
+		active = active[expired:]
+
+		reach := int64(0)
+		for ; s < len(starts) && starts[s].Time == current; s++ {
+			at, _ := slices.BinarySearch(active, starts[s].End)
+			active = slices.Insert(active, at, starts[s].End)
+			reach = max(reach, starts[s].End)
+		}
 
-			// Add recommendation
-			recommendations = append(recommendations, SlotRecommendation{
-				Slot: TimeSlot{
-					Start_UTC: startTime,
-					End_UTC:   startTime.Add(meetingDuration),
-				},
-				AvailableUsers:   available,
-				UnavailableUsers: unavailable,
+		// Earlier ends keep more users, so the walk can start at the quorum
+		last, _ := slices.BinarySearch(active, reach+1)
+		for i := min(last, len(active)-minCount+1) - 1; i >= 0 && active[i]-current >= minLength; {
+			end := active[i]
+			first, _ := slices.BinarySearch(active, end)
+			index.windows = append(index.windows, availabilityWindow{
+				start: current,
+				end:   end,
+				count: len(active) - first,
 			})
+			i = first - 1
+		}
+	}
+	return nil
+}
+
+// eligibleUsers counts everyone a quorum is measured against. Invitees who
+// have not answered count as if unavailable.
+func (index *availabilityIndex) eligibleUsers() int {
+	return len(index.users) + len(index.pending)
+}
+
+// quorum is the fewest users a window needs under the event's min_attendees
+func (index *availabilityIndex) quorum(event Event) int {
+	if event.MinAttendees == nil {
+		return 1
+	}
+	return event.MinAttendees.resolve(index.eligibleUsers())
+}
+
+// usersFree splits all users into those free for the whole span and the rest
+func (index *availabilityIndex) usersFree(start, end int64) ([]string, []string) {
+	available := []string{}
+	unavailable := []string{}
+	for i, runs := range index.runs {
+		j := sort.Search(len(runs), func(k int) bool { return runs[k].end >= end })
+		if j < len(runs) && runs[j].start <= start {
+			available = append(available, index.users[i])
+		} else {
+			unavailable = append(unavailable, index.users[i])
+		}
+	}
+	return available, unavailable
+}
+
+// recommendation materialises a window into a recommendation at its earliest start
+func (index *availabilityIndex) recommendation(window availabilityWindow, meetingDuration time.Duration) SlotRecommendation {
+	available, unavailable := index.usersFree(window.start, window.end)
+	start := nanosToTime(window.slotStart)
+	rec := SlotRecommendation{
+		Slot: TimeSlot{
+			Start_UTC: start,
+			End_UTC:   start.Add(meetingDuration),
+		},
+		Window: TimeSlot{
+			Start_UTC: nanosToTime(window.start),
+			End_UTC:   nanosToTime(window.end),
+		},
+		AvailableUsers:   available,
+		UnavailableUsers: unavailable,
+		PendingUsers:     index.pending,
+		Score:            window.score,
+	}
+	rec.ID = recommendationID(rec)
+	return rec
+}
+
+// recommendationID derives a stable ID from what a recommendation offers, so
+// the same slot for the same users keeps its ID between calls
+func recommendationID(rec SlotRecommendation) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d|%d|%d|%d", rec.Slot.Start_UTC.UnixNano(), rec.Slot.End_UTC.UnixNano(),
+		rec.Window.Start_UTC.UnixNano(), rec.Window.End_UTC.UnixNano())
+	for _, user := range rec.AvailableUsers {
+		fmt.Fprintf(hash, "|%s", user)
+	}
+	if rec.Resource != nil {
+		fmt.Fprintf(hash, "|resource:%s", rec.Resource.ID)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// slotsToRuns converts slots into runs, dropping empty ones
+func slotsToRuns(slots []TimeSlot) []freeRun {
+	runs := make([]freeRun, 0, len(slots))
+	for _, slot := range slots {
+		run := freeRun{
+			start: slot.Start_UTC.UnixNano(),
+			end:   slot.End_UTC.UnixNano(),
+		}
+		if run.start < run.end {
+			runs = append(runs, run)
 		}
+	}
+	return runs
+}
 
-		// If no users are active anymore, reset the start time
-		if len(activeUsers) == 0 {
-			startTime = time.Time{}
-		} else if i > 0 && !points[i-1].Time.Equal(point.Time) {
-			// Only update start time if we've moved to a new time point
-			startTime = point.Time
+// trimRuns takes the given margins off each end of every run, dropping the
+// runs they use up
+func trimRuns(runs []freeRun, trimStart, trimEnd int64) []freeRun {
+	trimmed := make([]freeRun, 0, len(runs))
+	for _, run := range runs {
+		run.start += trimStart
+		run.end -= trimEnd
+		if run.start < run.end {
+			trimmed = append(trimmed, run)
 		}
 	}
+	return trimmed
+}
 
-	// Sort recommendations by number of available users (descending)
-	sort.Slice(recommendations, func(i, j int) bool {
-		return len(recommendations[i].AvailableUsers) > len(recommendations[j].AvailableUsers)
+// mergeRuns sorts runs and joins the ones that overlap or touch
+func mergeRuns(runs []freeRun) []freeRun {
+	if len(runs) == 0 {
+		return runs
+	}
+	slices.SortFunc(runs, func(a, b freeRun) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		}
+		return 0
 	})
+	merged := runs[:1]
+	for _, run := range runs[1:] {
+		last := &merged[len(merged)-1]
+		if run.start <= last.end {
+			last.end = max(last.end, run.end)
+			continue
+		}
+		merged = append(merged, run)
+	}
+	return merged
+}
 
-	return recommendations
+// clipRun appends the intersections of a run with the sorted, merged event windows to dst
+func clipRun(dst []freeRun, run freeRun, eventWindows []freeRun) []freeRun {
+	first := sort.Search(len(eventWindows), func(i int) bool { return eventWindows[i].end > run.start })
+	for _, window := range eventWindows[first:] {
+		if window.start >= run.end {
+			break
+		}
+		dst = append(dst, freeRun{
+			start: max(run.start, window.start),
+			end:   min(run.end, window.end),
+		})
+	}
+	return dst
 }
 
-// earlier returns the earlier of two time points
-func earlier(a, b time.Time) time.Time {
-	if a.Before(b) {
-		return a
+// nanosToTime converts Unix nanoseconds back into a UTC time
+func nanosToTime(nanos int64) time.Time {
+	return time.Unix(0, nanos).UTC()
+}
+
+// windowStarts lists meeting starts every candidateStep through a window,
+// plus the latest start that still fits
+func windowStarts(windowStart, windowEnd time.Time, meetingDuration time.Duration) []time.Time {
+	latest := windowEnd.Add(-meetingDuration)
+	starts := []time.Time{}
+	for start := windowStart; !start.After(latest); start = start.Add(candidateStep) {
+		starts = append(starts, start)
+	}
+	if len(starts) > 0 && !starts[len(starts)-1].Equal(latest) {
+		starts = append(starts, latest)
 	}
-	return b
+	return starts
 }
 
-// later returns the later of two time points
-func later(a, b time.Time) time.Time {
-	if a.After(b) {
-		return a
+// candidateSlots spreads possible meeting starts across every recommended
+// window, keeping the best attended option for each start time. The result is
+// sorted by start time.
+func candidateSlots(recommendations []SlotRecommendation, meetingDuration time.Duration) []SlotRecommendation {
+	byStart := make(map[time.Time]SlotRecommendation)
+
+	for _, rec := range recommendations {
+		for _, start := range windowStarts(rec.Window.Start_UTC, rec.Window.End_UTC, meetingDuration) {
+			existing, ok := byStart[start]
+			if ok && len(existing.AvailableUsers) >= len(rec.AvailableUsers) {
+				continue
+			}
+			candidate := rec
+			candidate.Slot = TimeSlot{
+				Start_UTC: start,
+				End_UTC:   start.Add(meetingDuration),
+			}
+			candidate.ID = recommendationID(candidate)
+			byStart[start] = candidate
+		}
 	}
-	return b
+
+	candidates := make([]SlotRecommendation, 0, len(byStart))
+	for _, rec := range byStart {
+		candidates = append(candidates, rec)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Slot.Start_UTC.Before(candidates[j].Slot.Start_UTC)
+	})
+
+	return candidates
 }
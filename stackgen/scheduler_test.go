@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func utcSlot(start, end string) TimeSlot {
+	s, _ := time.Parse("2006-01-02 15:04", start)
+	e, _ := time.Parse("2006-01-02 15:04", end)
+	return TimeSlot{Start_UTC: s, End_UTC: e}
+}
+
+func userAvailability(userID string, slots ...TimeSlot) UserAvailability {
+	return UserAvailability{UserID: userID, Slots: slots}
+}
+
+func TestFindOptimalSlotsQuorum(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 13:00")),
+			userAvailability("bob", utcSlot("2025-01-15 10:00", "2025-01-15 12:00")),
+			userAvailability("carol", utcSlot("2025-01-15 11:00", "2025-01-15 15:00")),
+		},
+	}
+
+	t.Run("Absolute Threshold", func(t *testing.T) {
+		event.MinAttendees = &AttendeeThreshold{Count: 2}
+		recommendations := optimalSlots(t, event, 0)
+
+		for _, rec := range recommendations {
+			assert.GreaterOrEqual(t, len(rec.AvailableUsers), 2)
+		}
+		assert.ElementsMatch(t, []string{"alice", "bob", "carol"}, recommendations[0].AvailableUsers)
+	})
+
+	t.Run("Percentage Threshold", func(t *testing.T) {
+		event.MinAttendees = &AttendeeThreshold{Percent: 100}
+		recommendations := optimalSlots(t, event, 0)
+
+		assert.Len(t, recommendations, 1)
+		assert.Equal(t, utcSlot("2025-01-15 11:00", "2025-01-15 12:00"), recommendations[0].Window)
+	})
+
+	t.Run("Longest Window", func(t *testing.T) {
+		event.MinAttendees = &AttendeeThreshold{Count: 2}
+		recommendations := optimalSlots(t, event, 0)
+
+		// alice and bob stay free together from 10:00 to 12:00, even though carol joins at 11:00
+		for _, rec := range recommendations {
+			if len(rec.AvailableUsers) == 2 && rec.UnavailableUsers[0] == "carol" {
+				assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 12:00"), rec.Window)
+				assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 11:00"), rec.Slot)
+				return
+			}
+		}
+		t.Fatal("expected a recommendation for alice and bob")
+	})
+}
+
+func TestParseAttendeeThreshold(t *testing.T) {
+	threshold, err := parseAttendeeThreshold("60%")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, threshold.resolve(5))
+
+	threshold, err = parseAttendeeThreshold("5")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, threshold.resolve(8))
+
+	for _, invalid := range []string{"0", "-2", "150%", "lots"} {
+		_, err := parseAttendeeThreshold(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFindOptimalSlotsBuffers(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		BufferBefore: 15,
+		BufferAfter:  10,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 10:00", "2025-01-15 12:00")),
+			userAvailability("bob", utcSlot("2025-01-15 08:00", "2025-01-15 11:30")),
+		},
+	}
+
+	recommendations := optimalSlots(t, event, 0)
+
+	// bob must be free until 11:20 + 10 minutes, alice from 10:00 - 15 minutes
+	assert.ElementsMatch(t, []string{"alice", "bob"}, recommendations[0].AvailableUsers)
+	assert.Equal(t, utcSlot("2025-01-15 10:15", "2025-01-15 11:15"), recommendations[0].Slot)
+	assert.Equal(t, utcSlot("2025-01-15 10:15", "2025-01-15 11:20"), recommendations[0].Window)
+
+	// Without room for the buffers nobody can make it together
+	event.BufferAfter = 30
+	for _, rec := range optimalSlots(t, event, 0) {
+		assert.Len(t, rec.AvailableUsers, 1)
+	}
+
+	// Buffers trim the ends of continuous free time, not of each slot
+	event.BufferBefore, event.BufferAfter = 15, 15
+	event.UserSlots = []UserAvailability{
+		userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), utcSlot("2025-01-15 10:00", "2025-01-15 12:00")),
+	}
+	recommendations = optimalSlots(t, event, 0)
+	assert.Len(t, recommendations, 1)
+	assert.Equal(t, utcSlot("2025-01-15 09:15", "2025-01-15 11:45"), recommendations[0].Window)
+}
+
+func TestFindOptimalSlotsMergesOwnSlots(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots: []TimeSlot{
+			utcSlot("2025-01-15 09:00", "2025-01-15 12:00"),
+			utcSlot("2025-01-15 11:00", "2025-01-15 14:00"),
+		},
+		UserSlots: []UserAvailability{
+			// Touching and overlapping slots of one user form a single free run
+			userAvailability("alice",
+				utcSlot("2025-01-15 10:00", "2025-01-15 11:00"),
+				utcSlot("2025-01-15 11:00", "2025-01-15 12:00"),
+				utcSlot("2025-01-15 11:30", "2025-01-15 13:00"),
+			),
+			userAvailability("bob", utcSlot("2025-01-15 08:00", "2025-01-15 10:00")),
+		},
+	}
+
+	recommendations := optimalSlots(t, event, 0)
+
+	assert.Len(t, recommendations, 2)
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), recommendations[0].Window)
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 13:00"), recommendations[1].Window)
+	assert.Equal(t, []string{"alice"}, recommendations[1].AvailableUsers)
+
+	assert.Len(t, optimalSlots(t, event, 1), 1)
+}
+
+func TestFindOptimalSlotsAfterLastStart(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 13:00", "2025-01-15 15:00")),
+			userAvailability("bob", utcSlot("2025-01-15 13:00", "2025-01-15 14:00")),
+		},
+	}
+
+	// alice on her own from 14:00 comes after every start point has been seen
+	recommendations := optimalSlots(t, event, 0)
+	assert.Len(t, recommendations, 2)
+	assert.Equal(t, utcSlot("2025-01-15 13:00", "2025-01-15 15:00"), recommendations[1].Window)
+}
+
+func TestFindOptimalSlotsFindsSubsets(t *testing.T) {
+	event := Event{
+		DurationMins: 240,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 08:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 13:00")),
+			userAvailability("bob", utcSlot("2025-01-15 08:00", "2025-01-15 10:00")),
+			userAvailability("carol", utcSlot("2025-01-15 10:00", "2025-01-15 14:00")),
+			userAvailability("dave", utcSlot("2025-01-15 09:00", "2025-01-15 13:00")),
+		},
+	}
+
+	// alice and dave are never the only ones free, but they fit the meeting together
+	recommendations := optimalSlots(t, event, 0)
+	assert.Len(t, recommendations, 2)
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 13:00"), recommendations[0].Window)
+	assert.Equal(t, []string{"alice", "dave"}, recommendations[0].AvailableUsers)
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 14:00"), recommendations[1].Window)
+	assert.Equal(t, []string{"carol"}, recommendations[1].AvailableUsers)
+}
+
+// largeEvent builds an event with the given number of users, each offering slotsPerUser slots
+func largeEvent(users, slotsPerUser int) Event {
+	base := time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewSource(42))
+
+	event := Event{DurationMins: 60}
+	for day := 0; day < 10; day++ {
+		dayStart := base.AddDate(0, 0, day)
+		event.Slots = append(event.Slots, TimeSlot{
+			Start_UTC: dayStart.Add(8 * time.Hour),
+			End_UTC:   dayStart.Add(18 * time.Hour),
+		})
+	}
+
+	for u := 0; u < users; u++ {
+		user := UserAvailability{UserID: fmt.Sprintf("user%d", u)}
+		for s := 0; s < slotsPerUser; s++ {
+			start := base.AddDate(0, 0, rng.Intn(10)).Add(time.Duration(6*60+rng.Intn(12*4)*15) * time.Minute)
+			user.Slots = append(user.Slots, TimeSlot{
+				Start_UTC: start,
+				End_UTC:   start.Add(time.Duration(30+rng.Intn(8)*15) * time.Minute),
+			})
+		}
+		event.UserSlots = append(event.UserSlots, user)
+	}
+	return event
+}
+
+func BenchmarkFindOptimalSlots(b *testing.B) {
+	event := largeEvent(5000, 20)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		findOptimalSlots(context.Background(), event, 10)
+	}
+}
+
+// staircaseEvent is the sweep's worst case: every user becomes free a minute
+// after the last and all stay free together, so each start opens a window
+// for every later end
+func staircaseEvent(users int) Event {
+	base := time.Date(2025, 1, 13, 8, 0, 0, 0, time.UTC)
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{{Start_UTC: base, End_UTC: base.AddDate(0, 0, 7)}},
+	}
+	for u := 0; u < users; u++ {
+		start := base.Add(time.Duration(u) * time.Minute)
+		event.UserSlots = append(event.UserSlots, userAvailability(fmt.Sprintf("user%d", u),
+			TimeSlot{Start_UTC: start, End_UTC: start.Add(time.Duration(users) * 2 * time.Minute)}))
+	}
+	return event
+}
+
+func BenchmarkFindOptimalSlotsAll(b *testing.B) {
+	event := largeEvent(5000, 20)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		findOptimalSlots(context.Background(), event, 0)
+	}
+}
+
+func BenchmarkFindOptimalSlotsOverlapping(b *testing.B) {
+	event := staircaseEvent(1000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		findOptimalSlots(context.Background(), event, 10)
+	}
+}
+
+func BenchmarkFindOptimalSlotsOverlappingAll(b *testing.B) {
+	event := staircaseEvent(1000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		findOptimalSlots(context.Background(), event, 0)
+	}
+}
+
+func BenchmarkFindRecommendationByID(b *testing.B) {
+	event := staircaseEvent(1000)
+	recommendations, _ := findOptimalSlots(context.Background(), event, 10)
+	id := recommendations[9].ID
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		findRecommendationByID(context.Background(), event, nil, id)
+	}
+}
+
+func TestFindOptimalSlotsBounded(t *testing.T) {
+	event := staircaseEvent(100)
+
+	// A busy event is cut to the best maxCandidateWindows, and a smaller
+	// limit keeps the same best few
+	all := optimalSlots(t, event, 0)
+	assert.Len(t, all, maxCandidateWindows)
+	assert.Equal(t, all[:10], optimalSlots(t, event, 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := findOptimalSlots(ctx, event, 10)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, _, err = findRecommendationByID(ctx, event, nil, all[0].ID)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFindRecommendationByID(t *testing.T) {
+	event := largeEvent(50, 5)
+	all := optimalSlots(t, event, 0)
+	assert.NotEmpty(t, all)
+
+	for _, want := range []SlotRecommendation{all[0], all[len(all)/2], all[len(all)-1]} {
+		rec, ok := recommendationByID(t, event, nil, want.ID)
+		assert.True(t, ok)
+		assert.Equal(t, want, rec)
+	}
+
+	_, ok := recommendationByID(t, event, nil, "missing")
+	assert.False(t, ok)
+
+	// Resource recommendations carry the room in their ID
+	event = Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 12:00")},
+		UserSlots:    []UserAvailability{userAvailability("ana", utcSlot("2025-01-15 09:00", "2025-01-15 12:00"))},
+		Resource:     &ResourceRequirement{Type: "room"},
+	}
+	resources := []Resource{{ID: "r1", Name: "Room 1", Type: "room", Capacity: 4, Slots: []TimeSlot{utcSlot("2025-01-15 10:00", "2025-01-15 11:00")}}}
+	want := slotsWithResources(t, event, resources, 1)[0]
+	rec, ok := recommendationByID(t, event, resources, want.ID)
+	assert.True(t, ok)
+	assert.Equal(t, "r1", rec.Resource.ID)
+	assert.Equal(t, utcSlot("2025-01-15 10:00", "2025-01-15 11:00"), rec.Slot)
+}
+
+func TestFindOptimalSlotsDeterministic(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("zoe", utcSlot("2025-01-15 13:00", "2025-01-15 15:00")),
+			userAvailability("mia", utcSlot("2025-01-15 09:00", "2025-01-15 11:00")),
+			userAvailability("alex", utcSlot("2025-01-15 13:00", "2025-01-15 14:00")),
+			userAvailability("ben", utcSlot("2025-01-15 09:00", "2025-01-15 12:00")),
+		},
+	}
+
+	first := optimalSlots(t, event, 0)
+
+	// Ties on attendance go to the earlier start, then to the shorter window
+	assert.Equal(t, []string{"ben", "mia"}, first[0].AvailableUsers)
+	assert.Equal(t, []string{"alex", "zoe"}, first[0].UnavailableUsers)
+	assert.Equal(t, []string{"alex", "zoe"}, first[1].AvailableUsers)
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 12:00"), first[2].Window)
+	assert.Equal(t, utcSlot("2025-01-15 13:00", "2025-01-15 15:00"), first[3].Window)
+
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, first, optimalSlots(t, event, 0))
+	}
+
+	ids := map[string]bool{}
+	for _, rec := range first {
+		assert.NotEmpty(t, rec.ID)
+		assert.False(t, ids[rec.ID])
+		ids[rec.ID] = true
+	}
+}
+
+// optimalSlots runs findOptimalSlots without a deadline
+func optimalSlots(t *testing.T, event Event, limit int) []SlotRecommendation {
+	t.Helper()
+	recommendations, err := findOptimalSlots(context.Background(), event, limit)
+	assert.NoError(t, err)
+	return recommendations
+}
+
+// recommendationByID runs findRecommendationByID without a deadline
+func recommendationByID(t *testing.T, event Event, resources []Resource, id string) (SlotRecommendation, bool) {
+	t.Helper()
+	rec, ok, err := findRecommendationByID(context.Background(), event, resources, id)
+	assert.NoError(t, err)
+	return rec, ok
+}
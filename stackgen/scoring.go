@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scorer ranks the ways a meeting can be placed; higher scores are recommended first
+type Scorer interface {
+	Score(candidate *Candidate) float64
+}
+
+// PlacementScorer is implemented by scorers whose score depends on where
+// inside its window the meeting starts. Every candidate start is scored and
+// the best one kept; other scorers only see the earliest start.
+type PlacementScorer interface {
+	Scorer
+	ScoresPlacement() bool
+}
+
+// ScorerFactory prepares a Scorer for one event, so per-event lookups happen once
+type ScorerFactory func(event Event) Scorer
+
+// Candidate is one placement of the meeting, as seen by a Scorer
+type Candidate struct {
+	Slot           TimeSlot
+	Window         TimeSlot
+	AvailableCount int
+	TotalUsers     int
+
+	index *availabilityIndex
+	start int64
+	end   int64
+	users []string
+}
+
+// AvailableUsers lists the users free for the candidate. It is built on first
+// use, so scorers that only need AvailableCount stay cheap on large events.
+func (c *Candidate) AvailableUsers() []string {
+	if c.users == nil {
+		c.users, _ = c.index.usersFree(c.start, c.end)
+	}
+	return c.users
+}
+
+// Built-in strategy names
+const (
+	StrategyMaxAttendance = "max-attendance"
+	StrategyEarliest      = "earliest"
+	StrategyWeighted      = "weighted"
+	StrategyFairness      = "fairness"
+)
+
+var (
+	scorersMu sync.RWMutex
+	scorers   = map[string]ScorerFactory{
+		StrategyMaxAttendance: func(Event) Scorer { return maxAttendanceScorer{} },
+		StrategyEarliest:      func(Event) Scorer { return earliestScorer{} },
+		StrategyWeighted:      newWeightedScorer,
+		StrategyFairness:      newFairnessScorer,
+	}
+)
+
+// RegisterScorer makes a scoring strategy selectable by name, replacing any
+// strategy already registered under that name
+func RegisterScorer(name string, factory ScorerFactory) {
+	scorersMu.Lock()
+	defer scorersMu.Unlock()
+	scorers[name] = factory
+}
+
+// scorerNames lists the registered strategies in name order
+func scorerNames() []string {
+	scorersMu.RLock()
+	defer scorersMu.RUnlock()
+	names := make([]string, 0, len(scorers))
+	for name := range scorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateStrategy checks that a strategy name is registered
+func validateStrategy(name string) error {
+	scorersMu.RLock()
+	_, ok := scorers[name]
+	scorersMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown strategy: %s (available: %v)", name, scorerNames())
+	}
+	return nil
+}
+
+// eventStrategy is the strategy an event is ranked with. Recurring meetings
+// default to fairness, everything else to maximum attendance.
+func eventStrategy(event Event) string {
+	if event.Strategy != "" {
+		return event.Strategy
+	}
+	if event.RecurringID != "" {
+		return StrategyFairness
+	}
+	return StrategyMaxAttendance
+}
+
+// scorerFor builds the scorer for an event, falling back to maximum attendance
+// if its strategy is no longer registered
+func scorerFor(event Event) Scorer {
+	scorersMu.RLock()
+	factory, ok := scorers[eventStrategy(event)]
+	scorersMu.RUnlock()
+	scorer := Scorer(maxAttendanceScorer{})
+	if ok {
+		scorer = factory(event)
+	}
+	if event.HolidayPolicy == HolidayPolicyPenalize {
+		if regions := userRegions(event); len(regions) > 0 {
+			scorer = holidayScorer{inner: scorer, regions: regions, locations: userTimezones(event)}
+		}
+	}
+	return scorer
+}
+
+// maxAttendanceScorer prefers the slots the most users can attend
+type maxAttendanceScorer struct{}
+
+func (maxAttendanceScorer) Score(candidate *Candidate) float64 {
+	return float64(candidate.AvailableCount)
+}
+
+// earliestScorer prefers the earliest slot that meets the event's quorum
+type earliestScorer struct{}
+
+func (earliestScorer) Score(candidate *Candidate) float64 {
+	return -float64(candidate.Slot.Start_UTC.Unix())
+}
+
+// weightedScorer adds up the event's user_weights of everyone available,
+// counting users without a weight as 1
+type weightedScorer struct {
+	weights map[string]float64
+}
+
+func newWeightedScorer(event Event) Scorer {
+	return weightedScorer{weights: event.UserWeights}
+}
+
+func (s weightedScorer) Score(candidate *Candidate) float64 {
+	if len(s.weights) == 0 {
+		return float64(candidate.AvailableCount)
+	}
+	total := 0.0
+	for _, user := range candidate.AvailableUsers() {
+		if weight, ok := s.weights[user]; ok {
+			total += weight
+		} else {
+			total++
+		}
+	}
+	return total
+}
+
+// scoreWindows scores every ranked window with the event's scorer, placing
+// the meeting at the best start for placement-sensitive scorers. It stops
+// with the context's error once the context is done.
+func scoreWindows(ctx context.Context, event Event, index *availabilityIndex, ranked []availabilityWindow) error {
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+	scorer := scorerFor(event)
+
+	placement := false
+	if placer, ok := scorer.(PlacementScorer); ok {
+		placement = placer.ScoresPlacement()
+	}
+
+	for i := range ranked {
+		if i%candidateCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		window := &ranked[i]
+		windowStart := nanosToTime(window.start)
+		windowEnd := nanosToTime(window.end)
+
+		candidate := &Candidate{
+			Window:         TimeSlot{Start_UTC: windowStart, End_UTC: windowEnd},
+			AvailableCount: window.count,
+			TotalUsers:     len(index.users),
+			index:          index,
+			start:          window.start,
+			end:            window.end,
+		}
+
+		starts := []time.Time{windowStart}
+		if placement {
+			starts = windowStarts(windowStart, windowEnd, meetingDuration)
+		}
+
+		for j, start := range starts {
+			candidate.Slot = TimeSlot{Start_UTC: start, End_UTC: start.Add(meetingDuration)}
+			score := scorer.Score(candidate)
+			if j == 0 || score > window.score {
+				window.score = score
+				window.slotStart = start.UnixNano()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// latestScorer is a custom strategy registered by the test
+type latestScorer struct{}
+
+func (latestScorer) Score(candidate *Candidate) float64 {
+	return float64(candidate.Slot.Start_UTC.Unix())
+}
+
+func (latestScorer) ScoresPlacement() bool { return true }
+
+func TestScoringStrategies(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 10:00")),
+			userAvailability("bob", utcSlot("2025-01-15 13:00", "2025-01-15 16:00")),
+			userAvailability("carol", utcSlot("2025-01-15 13:00", "2025-01-15 15:00")),
+		},
+	}
+
+	t.Run("Max Attendance", func(t *testing.T) {
+		top := optimalSlots(t, event, 1)[0]
+		assert.Equal(t, []string{"bob", "carol"}, top.AvailableUsers)
+		assert.Equal(t, 2.0, top.Score)
+	})
+
+	t.Run("Earliest", func(t *testing.T) {
+		event.Strategy = StrategyEarliest
+		top := optimalSlots(t, event, 1)[0]
+		assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00"), top.Slot)
+	})
+
+	t.Run("Weighted", func(t *testing.T) {
+		event.Strategy = StrategyWeighted
+		event.UserWeights = map[string]float64{"alice": 5}
+		top := optimalSlots(t, event, 1)[0]
+		assert.Equal(t, []string{"alice"}, top.AvailableUsers)
+		assert.Equal(t, 5.0, top.Score)
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		RegisterScorer("latest", func(Event) Scorer { return latestScorer{} })
+		t.Cleanup(func() {
+			scorersMu.Lock()
+			defer scorersMu.Unlock()
+			delete(scorers, "latest")
+		})
+		assert.NoError(t, validateStrategy("latest"))
+
+		event.Strategy = "latest"
+		top := optimalSlots(t, event, 1)[0]
+
+		// Placement-sensitive scorers may move the meeting inside its window
+		assert.Equal(t, utcSlot("2025-01-15 15:00", "2025-01-15 16:00"), top.Slot)
+		assert.Equal(t, utcSlot("2025-01-15 13:00", "2025-01-15 16:00"), top.Window)
+	})
+
+	t.Run("Custom Unregistered", func(t *testing.T) {
+		assert.Error(t, validateStrategy("latest"))
+	})
+
+	assert.Error(t, validateStrategy("no-such-strategy"))
+}
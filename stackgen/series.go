@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// defaultSeriesAlternatives is how many ranked session sets are returned when not configured
+const defaultSeriesAlternatives = 3
+
+// Bounds on the series search, whose work grows with candidates, sessions,
+// sessions per day and alternatives
+const (
+	maxSeriesSessions     = 50
+	maxSeriesAlternatives = 10
+	maxSeriesCandidates   = 1000 // Best attended starts kept, about two weeks of half hours
+)
+
+// SeriesConfig turns an event into a series of sessions, each DurationMins long
+type SeriesConfig struct {
+	Sessions     int    `json:"sessions" bson:"sessions"`
+	MaxPerDay    int    `json:"max_per_day,omitempty" bson:"max_per_day,omitempty"`   // 0 means no daily limit
+	MinGapMins   int    `json:"min_gap_mins,omitempty" bson:"min_gap_mins,omitempty"` // Between the end of one session and the start of the next
+	TimeZone     string `json:"timezone,omitempty" bson:"timezone,omitempty"`         // Decides where days begin for MaxPerDay
+	Alternatives int    `json:"alternatives,omitempty" bson:"alternatives,omitempty"`
+}
+
+// SeriesRecommendation is one complete set of sessions for a series
+type SeriesRecommendation struct {
+	Sessions        []SlotRecommendation `json:"sessions" bson:"sessions"`
+	TotalAttendance int                  `json:"total_attendance" bson:"total_attendance"`
+}
+
+// validateSeries checks a series configuration before it is stored
+func validateSeries(series SeriesConfig) error {
+	if series.Sessions < 1 || series.Sessions > maxSeriesSessions {
+		return fmt.Errorf("series sessions must be between 1 and %d", maxSeriesSessions)
+	}
+	if series.MaxPerDay < 0 || series.MinGapMins < 0 || series.Alternatives < 0 {
+		return fmt.Errorf("series limits cannot be negative")
+	}
+	if series.Alternatives > maxSeriesAlternatives {
+		return fmt.Errorf("series alternatives cannot be more than %d", maxSeriesAlternatives)
+	}
+	if series.TimeZone != "" {
+		if _, err := time.LoadLocation(series.TimeZone); err != nil {
+			return fmt.Errorf("invalid timezone: %s", series.TimeZone)
+		}
+	}
+	return nil
+}
+
+// seriesCandidate is a possible session start with the users who can attend it
+type seriesCandidate struct {
+	recommendation SlotRecommendation
+	day            string
+}
+
+// seriesPath is one ranked partial set of sessions ending at a candidate
+type seriesPath struct {
+	score int
+	prev  *seriesPath
+	index int
+}
+
+// findSeriesSlots picks non-overlapping sessions that maximise total attendance
+// while respecting the spacing rules, and returns the best alternative sets.
+// It stops with the context's error once the context is done.
+func findSeriesSlots(ctx context.Context, event Event) ([]SeriesRecommendation, error) {
+	series := *event.Series
+	meetingDuration := time.Duration(event.DurationMins) * time.Minute
+
+	alternatives := series.Alternatives
+	if alternatives == 0 {
+		alternatives = defaultSeriesAlternatives
+	}
+	alternatives = min(alternatives, maxSeriesAlternatives)
+
+	// Sessions need the configured gap, and at least room for both buffers
+	minGap := time.Duration(max(series.MinGapMins, event.BufferBefore+event.BufferAfter)) * time.Minute
+
+	loc := time.UTC
+	if series.TimeZone != "" {
+		if l, err := time.LoadLocation(series.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	recommendations, err := findOptimalSlots(ctx, event, 0)
+	if err != nil {
+		return nil, err
+	}
+	candidates := seriesCandidates(recommendations, meetingDuration, loc)
+	if len(candidates) < series.Sessions {
+		return []SeriesRecommendation{}, nil
+	}
+
+	// Only the last day's count matters for MaxPerDay, which never needs to
+	// exceed the number of sessions or the candidates on any one day
+	perDay := series.Sessions
+	if series.MaxPerDay > 0 {
+		perDay = min(series.MaxPerDay, series.Sessions)
+	}
+	perDay = min(perDay, busiestDay(candidates))
+
+	// best[i][k][c] holds the top paths of k+1 sessions ending at candidate i,
+	// with c+1 of them on candidate i's day. Candidates are sorted by start and
+	// all last as long, so those ending early enough to precede candidate i are
+	// a prefix of them. Rather than pairing every candidate with every earlier
+	// one, the top paths of that prefix are kept as it grows: across earlier
+	// days regardless of count, and on the current day by count.
+	best := make([][][][]*seriesPath, len(candidates))
+	earlier := make([][]*seriesPath, series.Sessions)
+	var today [][][]*seriesPath
+	var complete []*seriesPath
+	ready, earlierNext, todayNext, dayStart := 0, 0, 0, 0
+
+	for i, cand := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i == 0 || cand.day != candidates[i-1].day {
+			dayStart, todayNext = i, i
+			today = make([][][]*seriesPath, series.Sessions)
+			for k := range today {
+				today[k] = make([][]*seriesPath, perDay)
+			}
+		}
+		for ready < i && cand.recommendation.Slot.Start_UTC.Sub(candidates[ready].recommendation.Slot.End_UTC) >= minGap {
+			ready++
+		}
+
+		// Candidates of earlier days join regardless of their day's count, and
+		// are not needed again after that
+		for ; earlierNext < min(ready, dayStart); earlierNext++ {
+			for k, counts := range best[earlierNext] {
+				for _, paths := range counts {
+					for _, path := range paths {
+						earlier[k] = insertSeriesPath(earlier[k], path, alternatives)
+					}
+				}
+			}
+			best[earlierNext] = nil
+		}
+		for ; todayNext < ready; todayNext++ {
+			for k, counts := range best[todayNext] {
+				for c, paths := range counts {
+					for _, path := range paths {
+						today[k][c] = insertSeriesPath(today[k][c], path, alternatives)
+					}
+				}
+			}
+		}
+
+		best[i] = make([][][]*seriesPath, series.Sessions)
+		for k := range best[i] {
+			best[i][k] = make([][]*seriesPath, perDay)
+		}
+		attendance := len(cand.recommendation.AvailableUsers)
+		best[i][0][0] = []*seriesPath{{score: attendance, index: i}}
+
+		extend := func(into []*seriesPath, from []*seriesPath) []*seriesPath {
+			for _, path := range from {
+				into = insertSeriesPath(into, &seriesPath{score: path.score + attendance, prev: path, index: i}, alternatives)
+			}
+			return into
+		}
+		for k := 1; k < series.Sessions; k++ {
+			best[i][k][0] = extend(best[i][k][0], earlier[k-1])
+			for c := 0; c+1 < perDay; c++ {
+				best[i][k][c+1] = extend(best[i][k][c+1], today[k-1][c])
+			}
+		}
+
+		for _, path := range slices.Concat(best[i][series.Sessions-1]...) {
+			complete = insertSeriesPath(complete, path, alternatives)
+		}
+	}
+
+	results := []SeriesRecommendation{}
+	for _, path := range complete {
+		sessions := make([]SlotRecommendation, 0, series.Sessions)
+		for p := path; p != nil; p = p.prev {
+			sessions = append(sessions, candidates[p.index].recommendation)
+		}
+		// Paths are built back to front
+		slices.Reverse(sessions)
+		results = append(results, SeriesRecommendation{
+			Sessions:        sessions,
+			TotalAttendance: path.score,
+		})
+	}
+
+	return results, nil
+}
+
+// busiestDay is the most candidates that start on one day
+func busiestDay(candidates []seriesCandidate) int {
+	busiest, run := 0, 0
+	for i, cand := range candidates {
+		if i > 0 && cand.day == candidates[i-1].day {
+			run++
+		} else {
+			run = 1
+		}
+		busiest = max(busiest, run)
+	}
+	return busiest
+}
+
+// seriesCandidates tags every candidate slot with the day it starts on. Past
+// maxSeriesCandidates only the best attended are kept, earliest first on ties.
+func seriesCandidates(recommendations []SlotRecommendation, meetingDuration time.Duration, loc *time.Location) []seriesCandidate {
+	slots := candidateSlots(recommendations, meetingDuration)
+	if len(slots) > maxSeriesCandidates {
+		slices.SortStableFunc(slots, func(a, b SlotRecommendation) int {
+			return len(b.AvailableUsers) - len(a.AvailableUsers)
+		})
+		slots = slots[:maxSeriesCandidates]
+		slices.SortFunc(slots, func(a, b SlotRecommendation) int {
+			return a.Slot.Start_UTC.Compare(b.Slot.Start_UTC)
+		})
+	}
+
+	candidates := make([]seriesCandidate, 0, len(slots))
+	for _, rec := range slots {
+		candidates = append(candidates, seriesCandidate{
+			recommendation: rec,
+			day:            rec.Slot.Start_UTC.In(loc).Format("2006-01-02"),
+		})
+	}
+	return candidates
+}
+
+// insertSeriesPath adds a path to a list kept sorted by score, capped at limit entries
+func insertSeriesPath(paths []*seriesPath, path *seriesPath, limit int) []*seriesPath {
+	pos := sort.Search(len(paths), func(i int) bool {
+		return paths[i].score < path.score
+	})
+	if pos >= limit {
+		return paths
+	}
+	paths = append(paths, nil)
+	copy(paths[pos+1:], paths[pos:])
+	paths[pos] = path
+	if len(paths) > limit {
+		paths = paths[:limit]
+	}
+	return paths
+}
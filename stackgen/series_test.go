@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindSeriesSlots(t *testing.T) {
+	event := Event{
+		DurationMins: 90,
+		Series:       &SeriesConfig{Sessions: 3, MaxPerDay: 1, Alternatives: 2},
+		Slots: []TimeSlot{
+			utcSlot("2025-01-13 09:00", "2025-01-13 17:00"),
+			utcSlot("2025-01-14 09:00", "2025-01-14 17:00"),
+			utcSlot("2025-01-15 09:00", "2025-01-15 17:00"),
+			utcSlot("2025-01-16 09:00", "2025-01-16 17:00"),
+		},
+		UserSlots: []UserAvailability{
+			userAvailability("alice",
+				utcSlot("2025-01-13 09:00", "2025-01-13 12:00"),
+				utcSlot("2025-01-14 13:00", "2025-01-14 17:00"),
+				utcSlot("2025-01-16 09:00", "2025-01-16 11:00"),
+			),
+			userAvailability("bob",
+				utcSlot("2025-01-13 10:00", "2025-01-13 15:00"),
+				utcSlot("2025-01-14 14:00", "2025-01-14 16:00"),
+				utcSlot("2025-01-15 09:00", "2025-01-15 17:00"),
+			),
+		},
+	}
+
+	results := seriesSlots(t, event)
+	assert.Len(t, results, 2)
+
+	best := results[0]
+	// Both are only free together on the 13th and 14th
+	assert.Equal(t, 5, best.TotalAttendance)
+	assert.Len(t, best.Sessions, 3)
+
+	// Sessions are in order, never overlap and never share a day
+	days := map[string]bool{}
+	for i, session := range best.Sessions {
+		day := session.Slot.Start_UTC.Format("2006-01-02")
+		assert.False(t, days[day], "two sessions on %s", day)
+		days[day] = true
+		if i > 0 {
+			assert.False(t, session.Slot.Start_UTC.Before(best.Sessions[i-1].Slot.End_UTC))
+		}
+	}
+
+	assert.LessOrEqual(t, results[1].TotalAttendance, best.TotalAttendance)
+}
+
+func TestFindSeriesSlotsMinGap(t *testing.T) {
+	event := Event{
+		DurationMins: 60,
+		Series:       &SeriesConfig{Sessions: 2, MinGapMins: 120},
+		Slots:        []TimeSlot{utcSlot("2025-01-13 09:00", "2025-01-13 13:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-13 09:00", "2025-01-13 13:00")),
+		},
+	}
+
+	results := seriesSlots(t, event)
+	assert.NotEmpty(t, results)
+	assert.Equal(t, utcSlot("2025-01-13 09:00", "2025-01-13 10:00"), results[0].Sessions[0].Slot)
+	assert.Equal(t, utcSlot("2025-01-13 12:00", "2025-01-13 13:00"), results[0].Sessions[1].Slot)
+
+	event.Series.MinGapMins = 180
+	assert.Empty(t, seriesSlots(t, event))
+}
+
+func TestSeriesLimits(t *testing.T) {
+	assert.NoError(t, validateSeries(SeriesConfig{Sessions: maxSeriesSessions}))
+	assert.Error(t, validateSeries(SeriesConfig{Sessions: maxSeriesSessions + 1}))
+	assert.Error(t, validateSeries(SeriesConfig{Sessions: 0}))
+
+	// A daily limit above the number of sessions is no limit at all
+	event := Event{
+		DurationMins: 60,
+		Series:       &SeriesConfig{Sessions: 2, MaxPerDay: 5000000},
+		Slots:        []TimeSlot{utcSlot("2025-01-13 09:00", "2025-01-13 18:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-13 09:00", "2025-01-13 18:00")),
+		},
+	}
+	results := seriesSlots(t, event)
+	assert.NotEmpty(t, results)
+	assert.Len(t, results[0].Sessions, 2)
+
+	assert.NoError(t, validateSeries(SeriesConfig{Sessions: 1, Alternatives: maxSeriesAlternatives}))
+	assert.Error(t, validateSeries(SeriesConfig{Sessions: 1, Alternatives: maxSeriesAlternatives + 1}))
+
+	// Long ranges keep only the best attended starts
+	event = everyoneFreeSeries(30, 50)
+	event.UserSlots[0].Slots = []TimeSlot{utcSlot("2025-01-20 09:00", "2025-01-20 12:00")}
+	candidates := seriesCandidates(optimalSlots(t, event, 0), time.Hour, time.UTC)
+	assert.Len(t, candidates, maxSeriesCandidates)
+	assert.True(t, slices.IsSortedFunc(candidates, func(a, b seriesCandidate) int {
+		return a.recommendation.Slot.Start_UTC.Compare(b.recommendation.Slot.Start_UTC)
+	}))
+	assert.Equal(t, 5, len(candidates[slices.IndexFunc(candidates, func(c seriesCandidate) bool {
+		return c.recommendation.Slot.Start_UTC.Equal(utcSlot("2025-01-20 10:00", "2025-01-20 11:00").Start_UTC)
+	})].recommendation.AvailableUsers))
+
+	// The search gives up once its request does
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := findSeriesSlots(ctx, everyoneFreeSeries(14, 50))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// everyoneFreeSeries is a series over whole days on which five users are always free
+func everyoneFreeSeries(days, sessions int) Event {
+	base := time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC)
+	event := Event{DurationMins: 60, Series: &SeriesConfig{Sessions: sessions}}
+	for day := 0; day < days; day++ {
+		event.Slots = append(event.Slots, TimeSlot{Start_UTC: base.AddDate(0, 0, day), End_UTC: base.AddDate(0, 0, day+1)})
+	}
+	for u := 0; u < 5; u++ {
+		event.UserSlots = append(event.UserSlots, userAvailability(fmt.Sprintf("user%d", u), TimeSlot{Start_UTC: base, End_UTC: base.AddDate(0, 0, days)}))
+	}
+	return event
+}
+
+func BenchmarkFindSeriesSlots(b *testing.B) {
+	event := everyoneFreeSeries(14, maxSeriesSessions)
+	event.Series.Alternatives = maxSeriesAlternatives
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		findSeriesSlots(context.Background(), event)
+	}
+}
+
+// seriesSlots runs findSeriesSlots without a deadline
+func seriesSlots(t *testing.T, event Event) []SeriesRecommendation {
+	t.Helper()
+	results, err := findSeriesSlots(context.Background(), event)
+	assert.NoError(t, err)
+	return results
+}
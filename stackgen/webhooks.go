@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Webhook event types
+const (
+	WebhookEventCreated          = "event.created"
+	WebhookEventUpdated          = "event.updated"
+	WebhookEventDeleted          = "event.deleted"
+	WebhookAvailabilityAdded     = "availability.added"
+	WebhookAvailabilityUpdated   = "availability.updated"
+	WebhookAvailabilityDeleted   = "availability.deleted"
+	WebhookRecommendationChanged = "recommendation.changed"
+	WebhookRSVPUpdated           = "rsvp.updated"
+	WebhookRSVPDeleted           = "rsvp.deleted"
+)
+
+var webhookEventTypes = []string{
+	WebhookEventCreated, WebhookEventUpdated, WebhookEventDeleted,
+	WebhookAvailabilityAdded, WebhookAvailabilityUpdated, WebhookAvailabilityDeleted,
+	WebhookRecommendationChanged, WebhookRSVPUpdated, WebhookRSVPDeleted,
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription sends matching changes to a URL. Without an event_id it
+// covers every event; without event types it receives all of them.
+type WebhookSubscription struct {
+	ID         string    `json:"id" bson:"_id"`
+	URL        string    `json:"url" bson:"url"`
+	EventID    string    `json:"event_id,omitempty" bson:"event_id"`
+	EventTypes []string  `json:"event_types,omitempty" bson:"event_types,omitempty"`
+	Secret     string    `json:"secret,omitempty" bson:"secret"` // Signs payloads; only returned when generated
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// WebhookPayload is the JSON body of every delivery
+type WebhookPayload struct {
+	ID         string      `json:"id"` // Delivery ID, the same across retries and redeliveries
+	Type       string      `json:"type"`
+	EventID    string      `json:"event_id"`
+	UserID     string      `json:"user_id,omitempty"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data,omitempty"`
+}
+
+// WebhookAttempt is one try at delivering a payload
+type WebhookAttempt struct {
+	At         time.Time `json:"at" bson:"at"`
+	StatusCode int       `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms" bson:"duration_ms"`
+}
+
+// WebhookDelivery is the delivery log entry of one payload to one subscription
+type WebhookDelivery struct {
+	ID             string           `json:"id" bson:"_id"`
+	MessageID      string           `json:"message_id" bson:"message_id"` // Outbox message it delivers
+	SubscriptionID string           `json:"subscription_id" bson:"subscription_id"`
+	Type           string           `json:"type" bson:"type"`
+	EventID        string           `json:"event_id" bson:"event_id"`
+	Payload        string           `json:"payload" bson:"payload"`
+	Status         string           `json:"status" bson:"status"`
+	Attempts       []WebhookAttempt `json:"attempts" bson:"attempts"`
+	CreatedAt      time.Time        `json:"created_at" bson:"created_at"`
+}
+
+// webhookSender posts signed payloads
+type webhookSender struct {
+	client *http.Client
+}
+
+var webhooks = &webhookSender{client: publicHTTPClient(10 * time.Second)}
+
+// adminKey manages the webhooks of every event and the resources; set from
+// ADMIN_API_KEY. While it is empty, neither can be managed.
+var adminKey string
+
+// adminFor checks that a request carries the admin key in X-Admin-Key. On
+// failure it also returns the HTTP status to answer with.
+func adminFor(r *http.Request) (int, error) {
+	if adminKey == "" {
+		return http.StatusForbidden, fmt.Errorf("this action needs ADMIN_API_KEY to be set")
+	}
+	key := r.Header.Get("X-Admin-Key")
+	if key == "" {
+		return http.StatusUnauthorized, fmt.Errorf("this action needs the admin key")
+	}
+	if !hmac.Equal([]byte(key), []byte(adminKey)) {
+		return http.StatusForbidden, fmt.Errorf("invalid admin key")
+	}
+	return 0, nil
+}
+
+// validateWebhookSubscription checks a subscription before it is stored
+func validateWebhookSubscription(sub WebhookSubscription) error {
+	parsed, err := url.Parse(sub.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("webhook url must be an http or https URL")
+	}
+	if err := checkPublicHost(parsed.Hostname()); err != nil {
+		return fmt.Errorf("webhook url: %v", err)
+	}
+	for _, eventType := range sub.EventTypes {
+		if !slices.Contains(webhookEventTypes, eventType) {
+			return fmt.Errorf("unknown webhook event type: %s", eventType)
+		}
+	}
+	return nil
+}
+
+// newWebhookID returns a random identifier for secrets and deliveries
+func newWebhookID(bytes int) string {
+	b := make([]byte, bytes)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// webhookMatches reports whether a subscription wants a change
+func webhookMatches(sub WebhookSubscription, eventType, eventID string) bool {
+	if sub.EventID != "" && sub.EventID != eventID {
+		return false
+	}
+	return len(sub.EventTypes) == 0 || slices.Contains(sub.EventTypes, eventType)
+}
+
+// signWebhook computes the X-Scheduler-Signature header: the hex HMAC-SHA256
+// of "<timestamp>.<body>" under the subscription's secret
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// attempt makes a single signed POST
+func (s *webhookSender) attempt(ctx context.Context, sub WebhookSubscription, delivery WebhookDelivery) WebhookAttempt {
+	started := clock()
+	result := WebhookAttempt{At: started.UTC()}
+	defer func() { result.DurationMs = clock().Sub(started).Milliseconds() }()
+
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", sub.URL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stackgen-scheduler-webhooks")
+	req.Header.Set("X-Scheduler-Event", delivery.Type)
+	req.Header.Set("X-Scheduler-Delivery", delivery.ID)
+	req.Header.Set("X-Scheduler-Signature", signWebhook(sub.Secret, started.Unix(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	result.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		result.Error = "unexpected status " + strconv.Itoa(resp.StatusCode)
+	}
+	return result
+}
+
+// newWebhookDelivery builds the delivery of an outbox message to a
+// subscription. Its ID, sent as X-Scheduler-Delivery, is the same on every
+// retry so receivers can drop repeats.
+func newWebhookDelivery(sub WebhookSubscription, message OutboxMessage) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{
+		ID:             message.ID + "." + sub.ID,
+		MessageID:      message.ID,
+		SubscriptionID: sub.ID,
+		Type:           message.Type,
+		EventID:        message.EventID,
+		Status:         DeliveryPending,
+		Attempts:       []WebhookAttempt{},
+		CreatedAt:      message.CreatedAt,
+	}
+	payload, err := json.Marshal(WebhookPayload{
+		ID:         delivery.ID,
+		Type:       message.Type,
+		EventID:    message.EventID,
+		UserID:     message.UserID,
+		OccurredAt: message.CreatedAt,
+		Data:       json.RawMessage(message.Payload),
+	})
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = string(payload)
+	return delivery, nil
+}
+
+// webhookSink delivers outbox messages to every matching subscription. Each
+// dispatch makes one attempt per subscription still waiting for the message;
+// the outbox retries the rest with backoff.
+type webhookSink struct{}
+
+func (webhookSink) Name() string { return "webhook" }
+
+func (webhookSink) Deliver(ctx context.Context, message OutboxMessage) error {
+	if !slices.Contains(webhookEventTypes, message.Type) {
+		return nil
+	}
+	filter := bson.M{"event_id": bson.M{"$in": []string{"", message.EventID}}}
+	cursor, err := webhooksCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var subs []WebhookSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return err
+	}
+
+	undelivered := []string{}
+	for _, sub := range subs {
+		if !webhookMatches(sub, message.Type, message.EventID) {
+			continue
+		}
+		delivery, err := newWebhookDelivery(sub, message)
+		if err != nil {
+			return err
+		}
+
+		var logged WebhookDelivery
+		err = webhookDeliveriesCollection.FindOne(ctx, bson.M{"_id": delivery.ID}).Decode(&logged)
+		switch {
+		case err == nil && logged.Status == DeliveryDelivered:
+			continue
+		case errors.Is(err, mongo.ErrNoDocuments):
+			if _, err := webhookDeliveriesCollection.InsertOne(ctx, delivery); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		attempt := webhooks.attempt(ctx, sub, delivery)
+		status := DeliveryPending
+		if attempt.Error == "" {
+			status = DeliveryDelivered
+		} else {
+			undelivered = append(undelivered, sub.ID)
+		}
+		update := bson.M{
+			"$push": bson.M{"attempts": attempt},
+			"$set":  bson.M{"status": status},
+		}
+		if _, err := webhookDeliveriesCollection.UpdateByID(ctx, delivery.ID, update); err != nil {
+			return err
+		}
+	}
+
+	if len(undelivered) > 0 {
+		return fmt.Errorf("not delivered to %s", strings.Join(undelivered, ", "))
+	}
+	return nil
+}
+
+// Failed marks the deliveries of a message that ran out of attempts
+func (webhookSink) Failed(ctx context.Context, message OutboxMessage) {
+	filter := bson.M{"message_id": message.ID, "status": DeliveryPending}
+	if _, err := webhookDeliveriesCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"status": DeliveryFailed}}); err != nil {
+		log.Println("Webhook delivery log failed:", err)
+	}
+}
+
+// snapshotEvent copies an event before an edit changes its availability in place
+func snapshotEvent(event Event) Event {
+	event.UserSlots = slices.Clone(event.UserSlots)
+	return event
+}
+
+// RecommendationChange is the data of a recommendation.changed webhook
+type RecommendationChange struct {
+	Previous *SlotRecommendation `json:"previous"`
+	Current  *SlotRecommendation `json:"current"`
+}
+
+// topRecommendation is the event's best slot as the recommendations endpoint
+// ranks it, with its resource and notice, or nil when nothing fits
+func topRecommendation(ctx context.Context, event Event) (*SlotRecommendation, error) {
+	if len(event.Slots) == 0 || len(event.UserSlots) == 0 || event.Series != nil {
+		return nil, nil
+	}
+	recommendations, err := recommendSlots(ctx, event, 1)
+	if err != nil || len(recommendations) == 0 {
+		return nil, err
+	}
+	return &recommendations[0], nil
+}
+
+// recommendationChange compares the top recommendation before and after an
+// edit; ok is false when it stayed the same. Both are ranked at the same
+// instant and against the same history of the recurring meeting.
+func recommendationChange(ctx context.Context, before, after Event) (RecommendationChange, bool, error) {
+	before.now, after.now = clock(), clock()
+	if err := loadInconvenienceHistory(ctx, &after); err != nil {
+		return RecommendationChange{}, false, err
+	}
+	if before.RecurringID == after.RecurringID {
+		before.inconvenienceHistory = after.inconvenienceHistory
+	} else if err := loadInconvenienceHistory(ctx, &before); err != nil {
+		return RecommendationChange{}, false, err
+	}
+
+	var change RecommendationChange
+	var err error
+	if change.Previous, err = topRecommendation(ctx, before); err != nil {
+		return change, false, err
+	}
+	if change.Current, err = topRecommendation(ctx, after); err != nil {
+		return change, false, err
+	}
+	switch {
+	case change.Previous == nil && change.Current == nil:
+		return change, false, nil
+	case change.Previous != nil && change.Current != nil && change.Previous.ID == change.Current.ID:
+		return change, false, nil
+	}
+	return change, true, nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"event.created"}`)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte("1736928000." + string(body)))
+
+	assert.Equal(t, "t=1736928000,v1="+hex.EncodeToString(mac.Sum(nil)), signWebhook("s3cret", 1736928000, body))
+	assert.NotEqual(t, signWebhook("s3cret", 1736928000, body), signWebhook("other", 1736928000, body))
+}
+
+func TestWebhookMatches(t *testing.T) {
+	global := WebhookSubscription{}
+	scoped := WebhookSubscription{EventID: "standup", EventTypes: []string{WebhookAvailabilityAdded}}
+
+	assert.True(t, webhookMatches(global, WebhookEventDeleted, "anything"))
+	assert.True(t, webhookMatches(scoped, WebhookAvailabilityAdded, "standup"))
+	assert.False(t, webhookMatches(scoped, WebhookAvailabilityAdded, "review"))
+	assert.False(t, webhookMatches(scoped, WebhookEventUpdated, "standup"))
+
+	assert.NoError(t, validateWebhookSubscription(WebhookSubscription{URL: "https://hooks.example.com/x", EventTypes: []string{WebhookRecommendationChanged}}))
+	assert.Error(t, validateWebhookSubscription(WebhookSubscription{URL: "hooks.example.com"}))
+	assert.Error(t, validateWebhookSubscription(WebhookSubscription{URL: "https://hooks.example.com", EventTypes: []string{"event.renamed"}}))
+	assert.ErrorContains(t, validateWebhookSubscription(WebhookSubscription{URL: "http://127.0.0.1:8082/events/x"}), "not a public host")
+	assert.ErrorContains(t, validateWebhookSubscription(WebhookSubscription{URL: "http://localhost/hook"}), "not a public host")
+}
+
+func TestAdminFor(t *testing.T) {
+	defer func(original string) { adminKey = original }(adminKey)
+	request := func(key string) *http.Request {
+		r := httptest.NewRequest("POST", "/webhooks/all", nil)
+		if key != "" {
+			r.Header.Set("X-Admin-Key", key)
+		}
+		return r
+	}
+
+	// Without a configured key nobody can manage webhooks for every event
+	adminKey = ""
+	status, err := adminFor(request(""))
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	adminKey = "ops-secret"
+	status, err = adminFor(request("ops-secret"))
+	assert.NoError(t, err)
+	assert.Zero(t, status)
+	status, _ = adminFor(request(""))
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = adminFor(request("guess"))
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestWebhookAttempt(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		// Receivers check the signature against the timestamp it carries
+		signature := r.Header.Get("X-Scheduler-Signature")
+		timestamp := strings.TrimPrefix(strings.Split(signature, ",")[0], "t=")
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		assert.True(t, strings.HasSuffix(signature, ",v1="+hex.EncodeToString(mac.Sum(nil))))
+		assert.Equal(t, WebhookAvailabilityAdded, r.Header.Get("X-Scheduler-Event"))
+
+		var payload WebhookPayload
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, r.Header.Get("X-Scheduler-Delivery"), payload.ID)
+
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sender := &webhookSender{client: server.Client()}
+	sub := WebhookSubscription{ID: "hook", URL: server.URL, Secret: "s3cret"}
+	message, err := newOutboxMessage(WebhookAvailabilityAdded, "standup", "alice", UserAvailability{UserID: "alice"}, time.Now())
+	assert.NoError(t, err)
+	delivery, err := newWebhookDelivery(sub, message)
+	assert.NoError(t, err)
+
+	attempt := sender.attempt(context.Background(), sub, delivery)
+	assert.Equal(t, http.StatusServiceUnavailable, attempt.StatusCode)
+	assert.NotEmpty(t, attempt.Error)
+
+	status = http.StatusNoContent
+	attempt = sender.attempt(context.Background(), sub, delivery)
+	assert.Equal(t, http.StatusNoContent, attempt.StatusCode)
+	assert.Empty(t, attempt.Error)
+}
+
+func TestNewWebhookDelivery(t *testing.T) {
+	message, err := newOutboxMessage(WebhookAvailabilityAdded, "standup", "alice", UserAvailability{UserID: "alice"}, time.Now())
+	assert.NoError(t, err)
+	sub := WebhookSubscription{ID: "hook"}
+
+	// Redelivering the same message to the same subscription keeps its ID
+	delivery, _ := newWebhookDelivery(sub, message)
+	again, _ := newWebhookDelivery(sub, message)
+	assert.Equal(t, message.ID+".hook", delivery.ID)
+	assert.Equal(t, delivery.Payload, again.Payload)
+	assert.Equal(t, message.ID, delivery.MessageID)
+
+	var payload struct {
+		WebhookPayload
+		Data UserAvailability `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(delivery.Payload), &payload))
+	assert.Equal(t, delivery.ID, payload.ID)
+	assert.Equal(t, "alice", payload.UserID)
+	assert.Equal(t, "alice", payload.Data.UserID)
+}
+
+func TestRecommendationChange(t *testing.T) {
+	defer func(original func() time.Time) { clock = original }(clock)
+	clock = func() time.Time { return time.Date(2025, 1, 10, 8, 0, 0, 0, time.UTC) }
+	before := Event{
+		ID:           "standup",
+		DurationMins: 60,
+		Slots:        []TimeSlot{utcSlot("2025-01-15 09:00", "2025-01-15 17:00")},
+		UserSlots: []UserAvailability{
+			userAvailability("alice", utcSlot("2025-01-15 09:00", "2025-01-15 17:00")),
+		},
+	}
+
+	// Bob joining later in the day moves the best slot
+	after := snapshotEvent(before)
+	after.UserSlots = append(after.UserSlots, userAvailability("bob", utcSlot("2025-01-15 14:00", "2025-01-15 17:00")))
+	change, ok, err := recommendationChange(context.Background(), before, after)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, utcSlot("2025-01-15 09:00", "2025-01-15 10:00").Start_UTC, change.Previous.Slot.Start_UTC)
+	assert.Equal(t, utcSlot("2025-01-15 14:00", "2025-01-15 15:00").Start_UTC, change.Current.Slot.Start_UTC)
+
+	// Carol being free when alice already is changes nothing
+	same := snapshotEvent(before)
+	same.UserSlots = append(same.UserSlots, userAvailability("carol", utcSlot("2025-01-16 09:00", "2025-01-16 10:00")))
+	_, ok, _ = recommendationChange(context.Background(), before, same)
+	assert.False(t, ok)
+
+	// Losing the last slot is a change to nothing
+	empty := snapshotEvent(before)
+	empty.UserSlots = nil
+	change, ok, _ = recommendationChange(context.Background(), before, empty)
+	assert.True(t, ok)
+	assert.Nil(t, change.Current)
+
+	// Both sides are ranked as the recommendations endpoint would, so time that
+	// has already passed cannot move the recommendation
+	clock = func() time.Time { return time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC) }
+	past := snapshotEvent(before)
+	past.UserSlots = append(past.UserSlots, userAvailability("bob", utcSlot("2025-01-15 09:00", "2025-01-15 11:00")))
+	change, ok, _ = recommendationChange(context.Background(), before, past)
+	assert.False(t, ok)
+	assert.Equal(t, utcSlot("2025-01-15 12:00", "2025-01-15 13:00").Start_UTC, change.Current.Slot.Start_UTC)
+}
+
+func TestUpdateWebhookKeepsSecret(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer func(webhooks *mongo.Collection, key string) {
+		webhooksCollection, adminKey = webhooks, key
+	}(webhooksCollection, adminKey)
+	adminKey = "ops-secret"
+
+	router := mux.NewRouter()
+	router.HandleFunc("/webhooks/{id}", handleWebhook).Methods("POST", "PUT")
+
+	created := time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC)
+	existing := bson.D{
+		{Key: "_id", Value: "ops"},
+		{Key: "url", Value: "https://93.184.216.34/hook"},
+		{Key: "secret", Value: "old-secret"},
+		{Key: "created_at", Value: created},
+	}
+	update := func(mt *mtest.T, target string) (*httptest.ResponseRecorder, bson.Raw) {
+		webhooksCollection = mt.Coll
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "db.webhooks", mtest.FirstBatch, existing),
+			mtest.CreateSuccessResponse(),
+		)
+		body := `{"url": "https://93.184.216.34/other", "event_types": ["event.updated"]}`
+		r := httptest.NewRequest("PUT", target, strings.NewReader(body))
+		r.Header.Set("X-Admin-Key", "ops-secret")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w, replacedEvent(mt)
+	}
+
+	// Subscribers keep verifying with the secret they have
+	mt.Run("Keep", func(mt *mtest.T) {
+		w, written := update(mt, "/webhooks/ops")
+		assert.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(mt, "old-secret", written.Lookup("secret").StringValue())
+		assert.True(mt, created.Equal(written.Lookup("created_at").Time()))
+		assert.Equal(mt, "https://93.184.216.34/other", written.Lookup("url").StringValue())
+		assert.NotContains(mt, w.Body.String(), "old-secret")
+	})
+
+	// Only an explicit request generates a new one, returned once
+	mt.Run("Rotate", func(mt *mtest.T) {
+		w, written := update(mt, "/webhooks/ops?rotate_secret=true")
+		assert.Equal(mt, http.StatusOK, w.Code, w.Body.String())
+		secret := written.Lookup("secret").StringValue()
+		assert.NotEqual(mt, "old-secret", secret)
+		assert.Contains(mt, w.Body.String(), secret)
+		assert.True(mt, created.Equal(written.Lookup("created_at").Time()))
+	})
+}
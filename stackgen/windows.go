@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type FreeWindow struct {
+	Slot         TimeSlot `json:"slot"`
+	DurationMins int      `json:"duration_mins"`
+}
+
+// commonFreeWindows returns every maximal interval, inside the event's slots,
+// in which all the given users are free at once. No users means everyone who
+// has submitted availability.
+func commonFreeWindows(event Event, users []string) ([]FreeWindow, error) {
+	// Raw intersection: buffers, duration, notice, holidays and declined times only matter for recommendations
+	event.BufferBefore, event.BufferAfter = 0, 0
+	event.NotBefore = nil
+	event.HolidayPolicy = HolidayPolicyIgnore
+	event.RejectedSlots = nil
+	index := buildAvailabilityIndex(event)
+
+	userIndex := make(map[string]int, len(index.users))
+	for i, user := range index.users {
+		userIndex[user] = i
+	}
+
+	if len(users) == 0 {
+		users = index.users
+	}
+	if len(users) == 0 {
+		return []FreeWindow{}, nil
+	}
+
+	var common []freeRun
+	for i, user := range users {
+		u, ok := userIndex[user]
+		if !ok {
+			return nil, fmt.Errorf("no availability submitted for user: %s", user)
+		}
+		if i == 0 {
+			common = index.runs[u]
+			continue
+		}
+		common = intersectRuns(common, index.runs[u])
+	}
+
+	windows := make([]FreeWindow, 0, len(common))
+	for _, run := range common {
+		windows = append(windows, FreeWindow{
+			Slot:         TimeSlot{Start_UTC: nanosToTime(run.start), End_UTC: nanosToTime(run.end)},
+			DurationMins: int(time.Duration(run.end - run.start).Minutes()),
+		})
+	}
+	return windows, nil
+}
+
+// intersectRuns intersects two sorted, non-overlapping lists of runs
+func intersectRuns(a, b []freeRun) []freeRun {
+	result := []freeRun{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start := max(a[i].start, b[j].start)
+		end := min(a[i].end, b[j].end)
+		if start < end {
+			result = append(result, freeRun{start: start, end: end})
+		}
+		if a[i].end < b[j].end {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
+
+// parseUserList splits a comma separated users= parameter, ignoring blanks
+func parseUserList(value string) []string {
+	users := []string{}
+	for _, user := range strings.Split(value, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+	return users
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommonFreeWindows(t *testing.T) {
+	event := Event{
+		DurationMins: 120,
+		Slots: []TimeSlot{
+			utcSlot("2025-01-15 09:00", "2025-01-15 17:00"),
+			utcSlot("2025-01-16 09:00", "2025-01-16 17:00"),
+		},
+		UserSlots: []UserAvailability{
+			userAvailability("alice",
+				utcSlot("2025-01-15 08:00", "2025-01-15 12:00"),
+				utcSlot("2025-01-16 14:00", "2025-01-16 18:00"),
+			),
+			userAvailability("bob",
+				utcSlot("2025-01-15 10:00", "2025-01-15 15:00"),
+				utcSlot("2025-01-16 09:00", "2025-01-16 14:30"),
+			),
+			userAvailability("carol", utcSlot("2025-01-15 11:30", "2025-01-15 13:00")),
+		},
+	}
+
+	t.Run("Everyone", func(t *testing.T) {
+		windows, err := commonFreeWindows(event, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []FreeWindow{{Slot: utcSlot("2025-01-15 11:30", "2025-01-15 12:00"), DurationMins: 30}}, windows)
+	})
+
+	t.Run("Subset", func(t *testing.T) {
+		// Shorter than the event's duration, still reported
+		windows, err := commonFreeWindows(event, []string{"alice", "bob"})
+		assert.NoError(t, err)
+		assert.Equal(t, []FreeWindow{
+			{Slot: utcSlot("2025-01-15 10:00", "2025-01-15 12:00"), DurationMins: 120},
+			{Slot: utcSlot("2025-01-16 14:00", "2025-01-16 14:30"), DurationMins: 30},
+		}, windows)
+	})
+
+	t.Run("Unknown User", func(t *testing.T) {
+		_, err := commonFreeWindows(event, []string{"alice", "dave"})
+		assert.Error(t, err)
+	})
+}